@@ -0,0 +1,83 @@
+package integration_test
+
+import (
+	stdcmp "cmp"
+	"context"
+	"iter"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+type messageAttributeValue struct {
+	DataType string
+	Value    string
+}
+
+func staticCredentials(keyID, secret, sessionToken string) *awsCredentials {
+	return &awsCredentials{Credentials: aws.Credentials{
+		AccessKeyID:     keyID,
+		SecretAccessKey: secret,
+		SessionToken:    sessionToken,
+	}}
+}
+
+type awsCredentials struct {
+	aws.Credentials
+}
+
+var _ aws.CredentialsProvider = (*awsCredentials)(nil)
+
+func (c *awsCredentials) Retrieve(_ context.Context) (aws.Credentials, error) {
+	return c.Credentials, nil
+}
+
+func iterateSortedMapEntries[K stdcmp.Ordered, V any](m map[K]V) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		for _, k := range slices.Sorted(maps.Keys(m)) {
+			if !yield(k, m[k]) {
+				return
+			}
+		}
+	}
+}
+
+func aggregateMessageAttributeValues(pairs iter.Seq2[string, []string]) map[string]messageAttributeValue {
+	idx2name := map[string]string{}
+	ret := map[string]messageAttributeValue{}
+	for key, values := range pairs {
+		rest, ok := strings.CutPrefix(key, "MessageAttributes.entry.")
+		if !ok {
+			continue
+		}
+		idx, field, ok := strings.Cut(rest, ".")
+		if !ok {
+			continue
+		}
+		switch field {
+		case "Name":
+			name := values[0]
+			idx2name[idx] = name
+			ret[name] = messageAttributeValue{}
+		case "Value.DataType":
+			name, ok := idx2name[idx]
+			if !ok {
+				continue
+			}
+			av := ret[name]
+			av.DataType = values[0]
+			ret[name] = av
+		case "Value.StringValue", "Value.BinaryValue":
+			name, ok := idx2name[idx]
+			if !ok {
+				continue
+			}
+			av := ret[name]
+			av.Value = values[0]
+			ret[name] = av
+		}
+	}
+	return ret
+}
@@ -0,0 +1,97 @@
+package integration_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aereal/otelpubsub/amazonsns/internal/utils"
+	"github.com/aereal/otelpubsub/amazonsns/pub"
+	"github.com/aereal/otelpubsub/amazonsns/sub"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/aws/aws-sdk-go-v2/otelaws"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestMiddleware_withOtelaws(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name         string
+		placement    pub.InjectionPlacement
+		wantLinkKind trace.SpanKind
+	}{
+		{name: "initialize", placement: pub.InjectionPlacementInitialize, wantLinkKind: trace.SpanKindProducer},
+		{name: "serialize", placement: pub.InjectionPlacementSerialize, wantLinkKind: trace.SpanKindClient},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var received *sub.Entity
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if err := r.ParseForm(); err != nil {
+					t.Errorf("ParseForm: %s", err)
+					return
+				}
+				received = &sub.Entity{MessageAttributes: sub.MessageAttributes{}}
+				for name, av := range aggregateMessageAttributeValues(iterateSortedMapEntries(r.PostForm)) {
+					received.MessageAttributes[name] = sub.StringAttributeValue(av.Value)
+				}
+				_, _ = io.WriteString(w, `<PublishResponse><PublishResult><MessageId>msg-1</MessageId></PublishResult></PublishResponse>`)
+			}))
+			t.Cleanup(srv.Close)
+			exporter := tracetest.NewInMemoryExporter()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+			cfg := aws.Config{
+				Region:       "us-east-1",
+				Credentials:  staticCredentials("id", "secret", "token"),
+				BaseEndpoint: &srv.URL,
+			}
+			otelaws.AppendMiddlewares(&cfg.APIOptions, otelaws.WithTracerProvider(tp))
+			pub.AppendMiddlewares(&cfg.APIOptions,
+				pub.WithTracerProvider(tp),
+				pub.WithPropagator(propagation.TraceContext{}),
+				pub.WithInjectionPlacement(tc.placement))
+			client := sns.NewFromConfig(cfg)
+
+			input := &sns.PublishInput{
+				TopicArn: utils.Ptr("arn:aws:sns:us-east-1:1234567890123:topic-1"),
+				Message:  utils.Ptr("hello"),
+			}
+			if _, err := client.Publish(t.Context(), input); err != nil {
+				t.Fatal(err)
+			}
+			_, processSpan := sub.StartProcessSpan(t.Context(), received, sub.WithTracerProvider(tp), sub.WithPropagator(propagation.TraceContext{}))
+			processSpan.End()
+
+			spans := exporter.GetSpans()
+			var process tracetest.SpanStub
+			spanByID := map[trace.SpanID]tracetest.SpanStub{}
+			for _, span := range spans {
+				spanByID[span.SpanContext.SpanID()] = span
+				if span.Name == "process" {
+					process = span
+				}
+			}
+			if len(process.Links) != 1 {
+				t.Fatalf("want 1 link but got %d", len(process.Links))
+			}
+			linked, ok := spanByID[process.Links[0].SpanContext.SpanID()]
+			if !ok {
+				t.Fatalf("the linked span %s is not exported", process.Links[0].SpanContext.SpanID())
+			}
+			if linked.SpanKind != tc.wantLinkKind {
+				t.Errorf("linked span: want kind=%s got kind=%s (name=%q)", tc.wantLinkKind, linked.SpanKind, linked.Name)
+			}
+			if tc.placement == pub.InjectionPlacementSerialize && linked.Name != "SNS.Publish" {
+				t.Errorf("linked span: want the otelaws client span but got %q", linked.Name)
+			}
+		})
+	}
+}
@@ -0,0 +1,6 @@
+// Package origin names the message attributes that keep the trace context of the message originator
+// when a relay republishes the message with its own trace context.
+package origin
+
+// AttributePrefix is prepended to the names of the propagation fields of the originator.
+const AttributePrefix = "otel.origin."
@@ -0,0 +1,93 @@
+// Package packed encodes the whole propagation fields into a single message attribute value.
+//
+// The binary form is a version byte (1) followed by repeated key/value pairs,
+// each of which is prefixed with its length as an unsigned varint.
+package packed
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// AttributeName is the name of the message attribute that holds the packed fields.
+const AttributeName = "otelpubsub.propagation"
+
+const binaryVersion byte = 1
+
+var (
+	// ErrUnsupportedVersion is returned when the binary form has an unknown version byte.
+	ErrUnsupportedVersion = errors.New("packed: unsupported version")
+	// ErrMalformed is returned when the binary form is truncated or otherwise broken.
+	ErrMalformed = errors.New("packed: malformed value")
+)
+
+// MarshalJSON encodes the fields as a JSON object.
+func MarshalJSON(fields map[string]string) (string, error) {
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// UnmarshalJSON decodes the fields encoded by [MarshalJSON].
+func UnmarshalJSON(s string) (map[string]string, error) {
+	var fields map[string]string
+	if err := json.Unmarshal([]byte(s), &fields); err != nil {
+		return nil, fmt.Errorf("packed: %w", err)
+	}
+	return fields, nil
+}
+
+// MarshalBinary encodes the fields in the compact binary form.
+// Keys are written in sorted order so that the output is stable.
+func MarshalBinary(fields map[string]string) []byte {
+	buf := []byte{binaryVersion}
+	for _, k := range slices.Sorted(maps.Keys(fields)) {
+		buf = appendString(buf, k)
+		buf = appendString(buf, fields[k])
+	}
+	return buf
+}
+
+// UnmarshalBinary decodes the fields encoded by [MarshalBinary].
+func UnmarshalBinary(b []byte) (map[string]string, error) {
+	if len(b) == 0 {
+		return nil, ErrMalformed
+	}
+	if b[0] != binaryVersion {
+		return nil, ErrUnsupportedVersion
+	}
+	rest := b[1:]
+	fields := map[string]string{}
+	for len(rest) > 0 {
+		var k, v string
+		var ok bool
+		if k, rest, ok = readString(rest); !ok {
+			return nil, ErrMalformed
+		}
+		if v, rest, ok = readString(rest); !ok {
+			return nil, ErrMalformed
+		}
+		fields[k] = v
+	}
+	return fields, nil
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+func readString(b []byte) (string, []byte, bool) {
+	n, size := binary.Uvarint(b)
+	if size <= 0 || n > uint64(len(b)-size) {
+		return "", nil, false
+	}
+	b = b[size:]
+	return string(b[:n]), b[n:], true
+}
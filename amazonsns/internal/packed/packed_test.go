@@ -0,0 +1,50 @@
+package packed_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aereal/otelpubsub/amazonsns/internal/packed"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBinary(t *testing.T) {
+	t.Parallel()
+
+	fields := map[string]string{
+		"traceparent": "00-abcdef121234567890abcdef12345678-1234567890abcdef-01",
+		"tracestate":  "vendor=value",
+		"empty":       "",
+	}
+	got, err := packed.UnmarshalBinary(packed.MarshalBinary(fields))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(fields, got); diff != "" {
+		t.Errorf("(-want, +got):\n%s", diff)
+	}
+}
+
+func TestUnmarshalBinary_error(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		want  error
+		name  string
+		input []byte
+	}{
+		{name: "empty", input: nil, want: packed.ErrMalformed},
+		{name: "unknown version", input: []byte{0xff}, want: packed.ErrUnsupportedVersion},
+		{name: "truncated key", input: []byte{1, 5, 'a'}, want: packed.ErrMalformed},
+		{name: "missing value", input: []byte{1, 1, 'a'}, want: packed.ErrMalformed},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if _, err := packed.UnmarshalBinary(tc.input); !errors.Is(err, tc.want) {
+				t.Errorf("want=%v got=%v", tc.want, err)
+			}
+		})
+	}
+}
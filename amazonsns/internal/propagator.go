@@ -1,5 +1,36 @@
 package internal
 
-import "go.opentelemetry.io/otel/propagation"
+import (
+	"context"
 
-var Propagator = propagation.TraceContext{}
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// Propagator is the propagator used when none is specified.
+// It delegates to the global propagator, or propagates W3C Trace Context and Baggage
+// while no global propagator is set with [otel.SetTextMapPropagator].
+var Propagator propagation.TextMapPropagator = globalPropagator{}
+
+var fallbackPropagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+type globalPropagator struct{}
+
+// current returns the global propagator, or the fallback if the global one is the no-op default.
+// It is resolved on each call so that the global propagator set after the clients are configured takes effect.
+func (globalPropagator) current() propagation.TextMapPropagator {
+	if p := otel.GetTextMapPropagator(); len(p.Fields()) > 0 {
+		return p
+	}
+	return fallbackPropagator
+}
+
+func (g globalPropagator) Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	g.current().Inject(ctx, carrier)
+}
+
+func (g globalPropagator) Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	return g.current().Extract(ctx, carrier)
+}
+
+func (g globalPropagator) Fields() []string { return g.current().Fields() }
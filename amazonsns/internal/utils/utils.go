@@ -1,12 +1,18 @@
 package utils
 
-import "github.com/aws/aws-sdk-go-v2/service/sns/types"
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/sns/types"
+)
 
 func Ptr[V any](v V) *V { return &v }
 
 const (
 	DataTypeString string = "String"
 	DataTypeNumber string = "Number"
+	DataTypeBinary string = "Binary"
 )
 
 func StringAttributeValue(s string) types.MessageAttributeValue {
@@ -22,3 +28,48 @@ func NumberAttributeValue(s string) types.MessageAttributeValue {
 		StringValue: Ptr(s),
 	}
 }
+
+func BinaryAttributeValue(b []byte) types.MessageAttributeValue {
+	return types.MessageAttributeValue{
+		DataType:    Ptr(DataTypeBinary),
+		BinaryValue: b,
+	}
+}
+
+// DestinationNameOf returns the resource part of the topic ARN, or the target ARN if the topic ARN is empty.
+func DestinationNameOf(topicARN, targetARN string) string {
+	destinationARN := targetARN
+	if topicARN != "" {
+		destinationARN = topicARN
+	}
+	parsed, err := arn.Parse(destinationARN)
+	if err != nil {
+		return ""
+	}
+	return parsed.Resource
+}
+
+// PhoneNumberDestinationTemplate is the destination template of the messages published to phone numbers.
+const PhoneNumberDestinationTemplate = "phone_number"
+
+// DestinationTemplateOf returns the low-cardinality template of the destination of a message published directly to a phone number
+// or a platform endpoint: [PhoneNumberDestinationTemplate], or endpoint/PLATFORM/APPLICATION without the endpoint ID.
+// It returns an empty string for the other destinations, whose names are low-cardinality.
+func DestinationTemplateOf(topicARN, targetARN, phoneNumber string) string {
+	if topicARN != "" {
+		return ""
+	}
+	if phoneNumber != "" {
+		return PhoneNumberDestinationTemplate
+	}
+	parsed, err := arn.Parse(targetARN)
+	if err != nil {
+		return ""
+	}
+	// the resource of a platform endpoint is endpoint/PLATFORM/APPLICATION/ID
+	parts := strings.SplitN(parsed.Resource, "/", 4)
+	if parts[0] != "endpoint" {
+		return ""
+	}
+	return strings.Join(parts[:min(len(parts), 3)], "/")
+}
@@ -0,0 +1,58 @@
+package pub
+
+import (
+	"iter"
+
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SNSPublishSpanAttributeProducer produces attributes set on the spans started by [AppendMiddlewares].
+// The attributes are produced after the API call.
+type SNSPublishSpanAttributeProducer interface {
+	// ProduceSNSPublishSpanAttributes produces attributes for the span of a Publish API call.
+	// output is nil if the API call fails.
+	ProduceSNSPublishSpanAttributes(input *sns.PublishInput, output *sns.PublishOutput) iter.Seq[attribute.KeyValue]
+	// ProduceSNSPublishBatchEntrySpanAttributes produces attributes for the "create" span of an entry of a PublishBatch API call.
+	// result is nil if the entry or the API call fails.
+	ProduceSNSPublishBatchEntrySpanAttributes(input *sns.PublishBatchInput, entry *types.PublishBatchRequestEntry, result *types.PublishBatchResultEntry) iter.Seq[attribute.KeyValue]
+}
+
+func (i *instrumenter) producePublishAttributes(span trace.Span, input *sns.PublishInput, output *sns.PublishOutput) {
+	var attrs []attribute.KeyValue
+	for _, producer := range i.attributeProducers {
+		for kv := range producer.ProduceSNSPublishSpanAttributes(input, output) {
+			attrs = append(attrs, kv)
+		}
+	}
+	if len(attrs) > 0 {
+		span.SetAttributes(attrs...)
+	}
+}
+
+// produceBatchEntryAttributes sets the produced attributes on createSpans, which are in the same order as the input entries.
+func (i *instrumenter) produceBatchEntryAttributes(createSpans []trace.Span, input *sns.PublishBatchInput, output *sns.PublishBatchOutput) {
+	if len(i.attributeProducers) == 0 {
+		return
+	}
+	results := map[string]*types.PublishBatchResultEntry{}
+	if output != nil {
+		for idx := range output.Successful {
+			results[deref(output.Successful[idx].Id)] = &output.Successful[idx]
+		}
+	}
+	for idx, createSpan := range createSpans {
+		entry := &input.PublishBatchRequestEntries[idx]
+		var attrs []attribute.KeyValue
+		for _, producer := range i.attributeProducers {
+			for kv := range producer.ProduceSNSPublishBatchEntrySpanAttributes(input, entry, results[deref(entry.Id)]) {
+				attrs = append(attrs, kv)
+			}
+		}
+		if len(attrs) > 0 {
+			createSpan.SetAttributes(attrs...)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package pub
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// MaxMessageAttributes is the maximum number of message attributes delivered to Amazon SQS subscriptions with raw message delivery.
+// Amazon SQS rejects messages with more attributes, so the same limit applies to the published message.
+const MaxMessageAttributes = 10
+
+// AttributeBudgetPolicy determines what to do when injecting trace context would exceed [MaxMessageAttributes].
+type AttributeBudgetPolicy int
+
+const (
+	// AttributeBudgetPolicyDropOptional drops optional propagation fields (tracestate, then baggage) until the rest fits.
+	// If it still does not fit, injection is skipped.
+	AttributeBudgetPolicyDropOptional AttributeBudgetPolicy = iota
+	// AttributeBudgetPolicySkip skips injection entirely.
+	AttributeBudgetPolicySkip
+	// AttributeBudgetPolicyFail fails the API call with [*AttributeBudgetExceededError] before sending the request.
+	AttributeBudgetPolicyFail
+	// AttributeBudgetPolicyPack falls back to packing all fields into the single attribute named [PackedAttributeName]
+	// with [PackedEncodingJSON]. If even the single attribute does not fit, injection is skipped.
+	AttributeBudgetPolicyPack
+)
+
+// optionalFields lists the propagation fields that can be dropped, in the order of dropping.
+var optionalFields = []string{"tracestate", "baggage"}
+
+type injectionDecision string
+
+const (
+	injectionDecisionFull            injectionDecision = "full"
+	injectionDecisionDroppedOptional injectionDecision = "dropped_optional"
+	injectionDecisionPacked          injectionDecision = "packed"
+	injectionDecisionSkipped         injectionDecision = "skipped"
+	injectionDecisionPreserved       injectionDecision = "preserved"
+	injectionDecisionEnvelope        injectionDecision = "envelope"
+	injectionDecisionFiltered        injectionDecision = "filtered"
+	injectionDecisionUnsampled       injectionDecision = "unsampled"
+	// injectionDecisionPayload means the trace context is embedded into the payload for the platform.
+	injectionDecisionPayload injectionDecision = "payload"
+	// injectionDecisionUnsupportedDestination means injection is skipped for the phone number or the platform endpoint.
+	injectionDecisionUnsupportedDestination injectionDecision = "unsupported_destination"
+)
+
+var (
+	attrKeyInjectionDecision = attribute.Key("otelpubsub.injection.decision")
+	attrKeyBatchEntryID      = attribute.Key("otelpubsub.batch.entry_id")
+)
+
+func (d injectionDecision) attribute() attribute.KeyValue {
+	return attrKeyInjectionDecision.String(string(d))
+}
+
+// inject injects the trace context into attrs within the budget of [MaxMessageAttributes].
+// entryID identifies the batch entry in the returned error; it is empty for a single message.
+// The returned decision is empty if the propagator has nothing to inject.
+func (i *instrumenter) inject(ctx context.Context, entryID string, attrs map[string]types.MessageAttributeValue) (injectionDecision, error) {
+	fields := propagation.MapCarrier{}
+	i.propagator.Inject(ctx, fields)
+	if len(fields) == 0 {
+		return "", nil
+	}
+	if existing := i.existingFields(attrs); len(existing) > 0 {
+		switch i.existingTraceContextPolicy {
+		case ExistingTraceContextPolicyPreserve:
+			return injectionDecisionPreserved, nil
+		case ExistingTraceContextPolicyPreserveOrigin:
+			moveToOrigin(attrs, existing)
+		case ExistingTraceContextPolicyOverwrite:
+		}
+	}
+	if i.packedEncoding != PackedEncodingNone {
+		return i.injectPacked(entryID, attrs, fields, i.packedEncoding)
+	}
+	if countAttributes(attrs, fields) <= MaxMessageAttributes {
+		setFields(attrs, fields)
+		return injectionDecisionFull, nil
+	}
+	switch i.budgetPolicy {
+	case AttributeBudgetPolicyFail:
+		return "", &AttributeBudgetExceededError{EntryID: entryID, Count: countAttributes(attrs, fields), Limit: MaxMessageAttributes}
+	case AttributeBudgetPolicyDropOptional:
+		for _, field := range optionalFields {
+			delete(fields, field)
+			if countAttributes(attrs, fields) <= MaxMessageAttributes {
+				setFields(attrs, fields)
+				return injectionDecisionDroppedOptional, nil
+			}
+		}
+	case AttributeBudgetPolicyPack:
+		return i.injectPacked(entryID, attrs, fields, PackedEncodingJSON)
+	case AttributeBudgetPolicySkip:
+	}
+	return injectionDecisionSkipped, nil
+}
+
+func (i *instrumenter) injectPacked(entryID string, attrs map[string]types.MessageAttributeValue, fields propagation.MapCarrier, encoding PackedEncoding) (injectionDecision, error) {
+	packedFields := propagation.MapCarrier{PackedAttributeName: ""}
+	if count := countAttributes(attrs, packedFields); count > MaxMessageAttributes {
+		if i.budgetPolicy == AttributeBudgetPolicyFail {
+			return "", &AttributeBudgetExceededError{EntryID: entryID, Count: count, Limit: MaxMessageAttributes}
+		}
+		return injectionDecisionSkipped, nil
+	}
+	av, err := encoding.attributeValue(fields)
+	if err != nil {
+		return "", err
+	}
+	attrs[PackedAttributeName] = av
+	return injectionDecisionPacked, nil
+}
+
+// countAttributes returns the number of message attributes after the fields are set.
+func countAttributes(attrs map[string]types.MessageAttributeValue, fields propagation.MapCarrier) int {
+	n := len(attrs)
+	for k := range fields {
+		if _, ok := attrs[k]; !ok {
+			n++
+		}
+	}
+	return n
+}
+
+func setFields(attrs map[string]types.MessageAttributeValue, fields propagation.MapCarrier) {
+	carrier := NewMessageAttributeCarrier(attrs)
+	for k, v := range fields {
+		carrier.Set(k, v)
+	}
+}
+
+// AttributeBudgetExceededError indicates injecting trace context would exceed [MaxMessageAttributes]
+// under [AttributeBudgetPolicyFail].
+type AttributeBudgetExceededError struct {
+	// EntryID is the ID of the batch entry, or empty for a single message.
+	EntryID string
+	Count   int
+	Limit   int
+}
+
+var _ error = (*AttributeBudgetExceededError)(nil) //nolint:errcheck
+
+func (e *AttributeBudgetExceededError) Error() string {
+	if e.EntryID == "" {
+		return fmt.Sprintf("injecting trace context makes %d message attributes, exceeding the limit of %d", e.Count, e.Limit)
+	}
+	return fmt.Sprintf("injecting trace context makes %d message attributes for entry %q, exceeding the limit of %d", e.Count, e.EntryID, e.Limit)
+}
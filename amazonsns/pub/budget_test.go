@@ -0,0 +1,175 @@
+package pub_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/aereal/otelpubsub/amazonsns/internal/utils"
+	"github.com/aereal/otelpubsub/amazonsns/pub"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"github.com/google/go-cmp/cmp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestMiddleware_attributeBudget(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name         string
+		policy       pub.AttributeBudgetPolicy
+		numAttrs     int
+		wantKeys     []string
+		wantDecision string
+		wantErr      bool
+	}{
+		{name: "fits", policy: pub.AttributeBudgetPolicyDropOptional, numAttrs: 8, wantKeys: []string{"traceparent", "tracestate"}, wantDecision: "full"},
+		{name: "drop optional", policy: pub.AttributeBudgetPolicyDropOptional, numAttrs: 9, wantKeys: []string{"traceparent"}, wantDecision: "dropped_optional"},
+		{name: "drop optional/no room", policy: pub.AttributeBudgetPolicyDropOptional, numAttrs: 10, wantKeys: []string{}, wantDecision: "skipped"},
+		{name: "skip", policy: pub.AttributeBudgetPolicySkip, numAttrs: 9, wantKeys: []string{}, wantDecision: "skipped"},
+		{name: "fail", policy: pub.AttributeBudgetPolicyFail, numAttrs: 9, wantErr: true},
+		{name: "fail/fits", policy: pub.AttributeBudgetPolicyFail, numAttrs: 8, wantKeys: []string{"traceparent", "tracestate"}, wantDecision: "full"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var gotKeys []string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if err := r.ParseForm(); err != nil {
+					t.Errorf("ParseForm: %s", err)
+					return
+				}
+				gotKeys = []string{}
+				for k := range aggregateMessageAttributeValues(iterateSortedMapEntries(r.PostForm)) {
+					if k == "traceparent" || k == "tracestate" {
+						gotKeys = append(gotKeys, k)
+					}
+				}
+				slices.Sort(gotKeys)
+			}))
+			t.Cleanup(srv.Close)
+			exporter := tracetest.NewInMemoryExporter()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+			cfg := aws.Config{
+				Region:       "us-east-1",
+				Credentials:  staticCredentials("id", "secret", "token"),
+				BaseEndpoint: &srv.URL,
+			}
+			pub.AppendMiddlewares(&cfg.APIOptions,
+				pub.WithTracerProvider(tp),
+				pub.WithPropagator(propagation.TraceContext{}),
+				pub.WithAttributeBudgetPolicy(tc.policy))
+			client := sns.NewFromConfig(cfg)
+
+			input := &sns.PublishInput{
+				TopicArn:          utils.Ptr("arn:aws:sns:us-east-1:1234567890123:topic-1"),
+				Message:           utils.Ptr("msg"),
+				MessageAttributes: userAttributes(tc.numAttrs),
+			}
+			_, err := client.Publish(contextWithTraceState(t), input)
+			if tc.wantErr {
+				var budgetErr *pub.AttributeBudgetExceededError
+				if !errors.As(err, &budgetErr) {
+					t.Fatalf("want AttributeBudgetExceededError but got %v", err)
+				}
+				if budgetErr.Count != 11 || budgetErr.Limit != pub.MaxMessageAttributes {
+					t.Errorf("unexpected error: %#v", budgetErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.wantKeys, gotKeys); diff != "" {
+				t.Errorf("injected keys (-want, +got):\n%s", diff)
+			}
+			spans := exporter.GetSpans()
+			if len(spans) != 1 {
+				t.Fatalf("got %d spans, want 1", len(spans))
+			}
+			gotAttrs := attribute.NewSet(spans[0].Attributes...)
+			gotDecision, _ := gotAttrs.Value("otelpubsub.injection.decision")
+			if gotDecision.AsString() != tc.wantDecision {
+				t.Errorf("decision: want=%q got=%q", tc.wantDecision, gotDecision.AsString())
+			}
+		})
+	}
+}
+
+func TestMiddleware_attributeBudget_batch(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(srv.Close)
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	cfg := aws.Config{
+		Region:       "us-east-1",
+		Credentials:  staticCredentials("id", "secret", "token"),
+		BaseEndpoint: &srv.URL,
+	}
+	pub.AppendMiddlewares(&cfg.APIOptions, pub.WithTracerProvider(tp), pub.WithPropagator(propagation.TraceContext{}))
+	client := sns.NewFromConfig(cfg)
+
+	input := &sns.PublishBatchInput{
+		TopicArn: utils.Ptr("arn:aws:sns:us-east-1:1234567890123:topic-1"),
+		PublishBatchRequestEntries: []types.PublishBatchRequestEntry{
+			{Id: utils.Ptr("1"), Message: utils.Ptr("msg-1")},
+			{Id: utils.Ptr("2"), Message: utils.Ptr("msg-2"), MessageAttributes: userAttributes(10)},
+		},
+	}
+	if _, err := client.PublishBatch(contextWithTraceState(t), input); err != nil {
+		t.Fatal(err)
+	}
+	spans := exporter.GetSpans()
+	if len(spans) != 3 {
+		t.Fatalf("got %d spans, want 3", len(spans))
+	}
+	want := map[string]string{"1": "full", "2": "skipped"}
+	got := map[string]string{}
+	for _, span := range spans[1:] {
+		attrs := attribute.NewSet(span.Attributes...)
+		entryID, _ := attrs.Value("otelpubsub.batch.entry_id")
+		decision, _ := attrs.Value("otelpubsub.injection.decision")
+		got[entryID.AsString()] = decision.AsString()
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("decisions by entry ID (-want, +got):\n%s", diff)
+	}
+}
+
+func userAttributes(n int) map[string]types.MessageAttributeValue {
+	attrs := make(map[string]types.MessageAttributeValue, n)
+	for i := range n {
+		attrs[fmt.Sprintf("attr-%d", i)] = utils.StringAttributeValue("v")
+	}
+	return attrs
+}
+
+func contextWithTraceState(t *testing.T) context.Context {
+	t.Helper()
+
+	ts, err := trace.ParseTraceState("vendor=value")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    dummyTraceID,
+		SpanID:     dummySpanID,
+		TraceFlags: trace.FlagsSampled,
+		TraceState: ts,
+		Remote:     true,
+	})
+	return trace.ContextWithRemoteSpanContext(t.Context(), sc)
+}
@@ -0,0 +1,66 @@
+package pub
+
+import (
+	"context"
+
+	"github.com/aereal/otelpubsub/amazonsns/internal/envelope"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// BodyEnvelopeFieldName is the name of the JSON field of the message body that holds the propagation fields
+// injected according to [BodyEnvelopeMode].
+const BodyEnvelopeFieldName = envelope.FieldName
+
+// messageStructureJSON is the MessageStructure value with which the message holds a message for each protocol.
+const messageStructureJSON = "json"
+
+// BodyEnvelopeMode determines whether the trace context is also injected into the message body.
+//
+// The envelope lets consumers find the trace context on delivery paths that drop message attributes,
+// such as raw message delivery to HTTP/S endpoints or Amazon Data Firehose.
+// A body that is a JSON object gets the field named [BodyEnvelopeFieldName];
+// any other body is wrapped into a JSON object. Either object is marked with the "otelpubsub.envelope" field.
+// The processors of the sub package receive the body as delivered, and sub.Entity.UnwrappedMessage returns the original body.
+// Messages with the "json" MessageStructure are left as is.
+// Injecting into the body changes it, so FIFO topics with content-based deduplication no longer deduplicate the messages.
+type BodyEnvelopeMode int
+
+const (
+	// BodyEnvelopeModeNone does not touch the message body.
+	BodyEnvelopeModeNone BodyEnvelopeMode = iota
+	// BodyEnvelopeModeFallback injects into the body only when injection into the message attributes is skipped
+	// because of [MaxMessageAttributes].
+	BodyEnvelopeModeFallback
+	// BodyEnvelopeModeAlways injects into the body in addition to the message attributes.
+	BodyEnvelopeModeAlways
+)
+
+// injectBody returns the body with the trace context injected according to the [BodyEnvelopeMode],
+// and the decision updated from the one made for the message attributes.
+func (i *instrumenter) injectBody(ctx context.Context, body, messageStructure *string, decision injectionDecision) (*string, injectionDecision, error) {
+	if body == nil || deref(messageStructure) == messageStructureJSON {
+		return body, decision, nil
+	}
+	switch i.bodyEnvelopeMode {
+	case BodyEnvelopeModeAlways:
+	case BodyEnvelopeModeFallback:
+		if decision != injectionDecisionSkipped {
+			return body, decision, nil
+		}
+	case BodyEnvelopeModeNone:
+		return body, decision, nil
+	}
+	fields := propagation.MapCarrier{}
+	i.propagator.Inject(ctx, fields)
+	if len(fields) == 0 {
+		return body, decision, nil
+	}
+	wrapped, err := envelope.Wrap(*body, fields)
+	if err != nil {
+		return nil, "", err
+	}
+	if decision == injectionDecisionSkipped {
+		decision = injectionDecisionEnvelope
+	}
+	return &wrapped, decision, nil
+}
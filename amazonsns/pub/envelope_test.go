@@ -0,0 +1,195 @@
+package pub_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aereal/otelpubsub/amazonsns/internal/utils"
+	"github.com/aereal/otelpubsub/amazonsns/pub"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"github.com/google/go-cmp/cmp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestMiddleware_bodyEnvelope(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		messageStructure *string
+		wantMessage      func(sc trace.SpanContext) any
+		name             string
+		message          string
+		wantDecision     string
+		mode             pub.BodyEnvelopeMode
+		numAttrs         int
+	}{
+		{
+			name:         "none",
+			mode:         pub.BodyEnvelopeModeNone,
+			numAttrs:     10,
+			message:      "hello",
+			wantMessage:  func(trace.SpanContext) any { return "hello" },
+			wantDecision: "skipped",
+		},
+		{
+			name:         "fallback/attributes fit",
+			mode:         pub.BodyEnvelopeModeFallback,
+			message:      "hello",
+			wantMessage:  func(trace.SpanContext) any { return "hello" },
+			wantDecision: "full",
+		},
+		{
+			name:     "fallback/attributes skipped",
+			mode:     pub.BodyEnvelopeModeFallback,
+			numAttrs: 10,
+			message:  "hello",
+			wantMessage: func(sc trace.SpanContext) any {
+				return map[string]any{
+					"otelpubsub.body":        "hello",
+					"otelpubsub.propagation": map[string]any{"traceparent": traceparentOf(sc)},
+					"otelpubsub.envelope":    1.0,
+				}
+			},
+			wantDecision: "envelope",
+		},
+		{
+			name:    "always",
+			mode:    pub.BodyEnvelopeModeAlways,
+			message: `{"id":1}`,
+			wantMessage: func(sc trace.SpanContext) any {
+				return map[string]any{
+					"id":                     1.0,
+					"otelpubsub.propagation": map[string]any{"traceparent": traceparentOf(sc)},
+					"otelpubsub.envelope":    1.0,
+				}
+			},
+			wantDecision: "full",
+		},
+		{
+			name:             "always/message structure",
+			mode:             pub.BodyEnvelopeModeAlways,
+			messageStructure: utils.Ptr("json"),
+			message:          `{"default":"hello"}`,
+			wantMessage:      func(trace.SpanContext) any { return map[string]any{"default": "hello"} },
+			wantDecision:     "full",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var gotMessage string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if err := r.ParseForm(); err != nil {
+					t.Errorf("ParseForm: %s", err)
+					return
+				}
+				gotMessage = r.PostForm.Get("Message")
+			}))
+			t.Cleanup(srv.Close)
+			exporter := tracetest.NewInMemoryExporter()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+			cfg := aws.Config{
+				Region:       "us-east-1",
+				Credentials:  staticCredentials("id", "secret", "token"),
+				BaseEndpoint: &srv.URL,
+			}
+			pub.AppendMiddlewares(&cfg.APIOptions, pub.WithTracerProvider(tp), pub.WithPropagator(propagation.TraceContext{}), pub.WithBodyEnvelope(tc.mode))
+			client := sns.NewFromConfig(cfg)
+
+			input := &sns.PublishInput{
+				TopicArn:          utils.Ptr("arn:aws:sns:us-east-1:1234567890123:topic-1"),
+				Message:           utils.Ptr(tc.message),
+				MessageStructure:  tc.messageStructure,
+				MessageAttributes: userAttributes(tc.numAttrs),
+			}
+			if _, err := client.Publish(t.Context(), input); err != nil {
+				t.Fatal(err)
+			}
+			spans := exporter.GetSpans()
+			if len(spans) != 1 {
+				t.Fatalf("got %d spans, want 1", len(spans))
+			}
+			if diff := cmp.Diff(tc.wantMessage(spans[0].SpanContext), decodeMessage(gotMessage)); diff != "" {
+				t.Errorf("message (-want, +got):\n%s", diff)
+			}
+			if got := *input.Message; got != tc.message {
+				t.Errorf("input message is modified: %q", got)
+			}
+			gotAttrs := attribute.NewSet(spans[0].Attributes...)
+			gotDecision, _ := gotAttrs.Value("otelpubsub.injection.decision")
+			if gotDecision.AsString() != tc.wantDecision {
+				t.Errorf("decision: want=%q got=%q", tc.wantDecision, gotDecision.AsString())
+			}
+		})
+	}
+}
+
+func TestMiddleware_bodyEnvelope_batch(t *testing.T) {
+	t.Parallel()
+
+	var gotMessages []any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("ParseForm: %s", err)
+			return
+		}
+		gotMessages = []any{
+			decodeMessage(r.PostForm.Get("PublishBatchRequestEntries.member.1.Message")),
+			decodeMessage(r.PostForm.Get("PublishBatchRequestEntries.member.2.Message")),
+		}
+	}))
+	t.Cleanup(srv.Close)
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	cfg := aws.Config{
+		Region:       "us-east-1",
+		Credentials:  staticCredentials("id", "secret", "token"),
+		BaseEndpoint: &srv.URL,
+	}
+	pub.AppendMiddlewares(&cfg.APIOptions, pub.WithTracerProvider(tp), pub.WithPropagator(propagation.TraceContext{}), pub.WithBodyEnvelope(pub.BodyEnvelopeModeFallback))
+	client := sns.NewFromConfig(cfg)
+
+	input := &sns.PublishBatchInput{
+		TopicArn: utils.Ptr("arn:aws:sns:us-east-1:1234567890123:topic-1"),
+		PublishBatchRequestEntries: []types.PublishBatchRequestEntry{
+			{Id: utils.Ptr("1"), Message: utils.Ptr("msg-1")},
+			{Id: utils.Ptr("2"), Message: utils.Ptr("msg-2"), MessageAttributes: userAttributes(10)},
+		},
+	}
+	if _, err := client.PublishBatch(t.Context(), input); err != nil {
+		t.Fatal(err)
+	}
+	spans := exporter.GetSpans()
+	if len(spans) != 3 {
+		t.Fatalf("got %d spans, want 3", len(spans))
+	}
+	want := []any{
+		"msg-1",
+		map[string]any{
+			"otelpubsub.body":        "msg-2",
+			"otelpubsub.propagation": map[string]any{"traceparent": traceparentOf(spans[2].SpanContext)},
+			"otelpubsub.envelope":    1.0,
+		},
+	}
+	if diff := cmp.Diff(want, gotMessages); diff != "" {
+		t.Errorf("messages (-want, +got):\n%s", diff)
+	}
+}
+
+// decodeMessage returns the message decoded as a JSON object, or the message as is.
+func decodeMessage(message string) any {
+	var object map[string]any
+	if err := json.Unmarshal([]byte(message), &object); err != nil {
+		return message
+	}
+	return object
+}
@@ -0,0 +1,18 @@
+package pub
+
+import "go.opentelemetry.io/otel/trace"
+
+// DestinationFilter reports whether the trace context should be injected into the messages published to the topic or the target.
+// Either of topicARN and targetARN is empty; targetARN is always empty for PublishBatch.
+type DestinationFilter func(topicARN, targetARN string) bool
+
+// skipDecision returns the decision to skip injection regardless of the message, or empty if the message should be injected.
+func (i *instrumenter) skipDecision(topicARN, targetARN string, sc trace.SpanContext) injectionDecision {
+	if i.destinationFilter != nil && !i.destinationFilter(topicARN, targetARN) {
+		return injectionDecisionFiltered
+	}
+	if i.sampledOnly && !sc.IsSampled() {
+		return injectionDecisionUnsampled
+	}
+	return ""
+}
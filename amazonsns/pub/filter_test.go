@@ -0,0 +1,156 @@
+package pub_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aereal/otelpubsub/amazonsns/internal/utils"
+	"github.com/aereal/otelpubsub/amazonsns/pub"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata/metricdatatest"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestMiddleware_skipInjection(t *testing.T) {
+	t.Parallel()
+
+	internalOnly := pub.DestinationFilter(func(topicARN, targetARN string) bool { return strings.HasSuffix(topicARN, ":internal-topic") })
+	testCases := []struct {
+		sampler         sdktrace.Sampler
+		name            string
+		topicARN        string
+		wantDecision    string
+		opts            []pub.AppendMiddlewaresOption
+		wantTraceparent bool
+	}{
+		{
+			name:            "filter/allowed",
+			opts:            []pub.AppendMiddlewaresOption{pub.WithDestinationFilter(internalOnly)},
+			topicARN:        "arn:aws:sns:us-east-1:1234567890123:internal-topic",
+			wantTraceparent: true,
+		},
+		{
+			name:         "filter/denied",
+			opts:         []pub.AppendMiddlewaresOption{pub.WithDestinationFilter(internalOnly)},
+			topicARN:     "arn:aws:sns:us-east-1:1234567890123:partner-topic",
+			wantDecision: "filtered",
+		},
+		{
+			name:            "sampled only/sampled",
+			opts:            []pub.AppendMiddlewaresOption{pub.WithSampledOnlyInjection()},
+			sampler:         sdktrace.AlwaysSample(),
+			topicARN:        "arn:aws:sns:us-east-1:1234567890123:internal-topic",
+			wantTraceparent: true,
+		},
+		{
+			name:         "sampled only/unsampled",
+			opts:         []pub.AppendMiddlewaresOption{pub.WithSampledOnlyInjection()},
+			sampler:      sdktrace.NeverSample(),
+			topicARN:     "arn:aws:sns:us-east-1:1234567890123:internal-topic",
+			wantDecision: "unsampled",
+		},
+		{
+			name:            "unsampled without option",
+			sampler:         sdktrace.NeverSample(),
+			topicARN:        "arn:aws:sns:us-east-1:1234567890123:internal-topic",
+			wantTraceparent: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var gotTraceparent bool
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if err := r.ParseForm(); err != nil {
+					t.Errorf("ParseForm: %s", err)
+					return
+				}
+				_, gotTraceparent = aggregateMessageAttributeValues(iterateSortedMapEntries(r.PostForm))["traceparent"]
+			}))
+			t.Cleanup(srv.Close)
+			sampler := tc.sampler
+			if sampler == nil {
+				sampler = sdktrace.AlwaysSample()
+			}
+			exporter := tracetest.NewInMemoryExporter()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter), sdktrace.WithSampler(sampler))
+			reader := sdkmetric.NewManualReader()
+			mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+			cfg := aws.Config{
+				Region:       "us-east-1",
+				Credentials:  staticCredentials("id", "secret", "token"),
+				BaseEndpoint: &srv.URL,
+			}
+			opts := append([]pub.AppendMiddlewaresOption{pub.WithTracerProvider(tp), pub.WithMeterProvider(mp), pub.WithPropagator(propagation.TraceContext{})}, tc.opts...)
+			pub.AppendMiddlewares(&cfg.APIOptions, opts...)
+			client := sns.NewFromConfig(cfg)
+
+			input := &sns.PublishInput{TopicArn: utils.Ptr(tc.topicARN), Message: utils.Ptr("body")}
+			if _, err := client.Publish(t.Context(), input); err != nil {
+				t.Fatal(err)
+			}
+			if gotTraceparent != tc.wantTraceparent {
+				t.Errorf("traceparent presence: want=%v got=%v", tc.wantTraceparent, gotTraceparent)
+			}
+			if spans := exporter.GetSpans(); len(spans) == 1 {
+				gotAttrs := attribute.NewSet(spans[0].Attributes...)
+				gotDecision, _ := gotAttrs.Value("otelpubsub.injection.decision")
+				if tc.wantDecision != "" && gotDecision.AsString() != tc.wantDecision {
+					t.Errorf("decision: want=%q got=%q", tc.wantDecision, gotDecision.AsString())
+				}
+			}
+
+			var rm metricdata.ResourceMetrics
+			if err := reader.Collect(t.Context(), &rm); err != nil {
+				t.Fatal(err)
+			}
+			var got *metricdata.Metrics
+			for _, sm := range rm.ScopeMetrics {
+				for _, m := range sm.Metrics {
+					if m.Name == "otelpubsub.injection.skipped" {
+						got = &m
+					}
+				}
+			}
+			if tc.wantDecision == "" {
+				if got != nil {
+					t.Errorf("want no skipped counter but got %#v", got)
+				}
+				return
+			}
+			if got == nil {
+				t.Fatal("the skipped counter is not recorded")
+			}
+			topicName := tc.topicARN[strings.LastIndex(tc.topicARN, ":")+1:]
+			want := metricdata.Metrics{
+				Name:        "otelpubsub.injection.skipped",
+				Description: "Number of messages published without trace context because of the destination filter, the sampling decision or the unsupported destination.",
+				Unit:        "{message}",
+				Data: metricdata.Sum[int64]{
+					Temporality: metricdata.CumulativeTemporality,
+					IsMonotonic: true,
+					DataPoints: []metricdata.DataPoint[int64]{
+						{
+							Attributes: attribute.NewSet(
+								attribute.String("messaging.system", "aws.sns"),
+								attribute.String("messaging.destination.name", topicName),
+								attribute.String("otelpubsub.injection.decision", tc.wantDecision),
+							),
+							Value: 1,
+						},
+					},
+				},
+			}
+			metricdatatest.AssertEqual(t, want, *got, metricdatatest.IgnoreTimestamp(), metricdatatest.IgnoreExemplars())
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package pub
+
+import (
+	"context"
+	"time"
+
+	"github.com/aereal/otelpubsub/amazonsns/internal/utils"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.39.0"
+	"go.opentelemetry.io/otel/semconv/v1.39.0/messagingconv"
+)
+
+const (
+	meterName = tracerName
+
+	// metricNameMessageBodySize is the name of the histogram of the message body size.
+	// The messaging semantic conventions have no such metric, so it is named after the library.
+	metricNameMessageBodySize = "otelpubsub.message.body.size"
+	// metricNameInjectionSkipped is the name of the counter of the messages published without trace context
+	// because of the destination filter, the sampling decision or the unsupported destination.
+	metricNameInjectionSkipped = "otelpubsub.injection.skipped"
+)
+
+// metricDestination is the destination recorded on the metrics.
+// Messages published directly to phone numbers or platform endpoints are recorded with the destination template instead of the name,
+// so that the metrics do not get a time series for each phone number or device.
+type metricDestination struct {
+	name     string
+	template string
+}
+
+func metricDestinationOf(topicARN, targetARN, phoneNumber string) metricDestination {
+	if template := utils.DestinationTemplateOf(topicARN, targetARN, phoneNumber); template != "" {
+		return metricDestination{template: template}
+	}
+	return metricDestination{name: utils.DestinationNameOf(topicARN, targetARN)}
+}
+
+func (d metricDestination) attributes() []attribute.KeyValue {
+	switch {
+	case d.template != "":
+		return []attribute.KeyValue{semconv.MessagingDestinationTemplate(d.template)}
+	case d.name != "":
+		return []attribute.KeyValue{semconv.MessagingDestinationName(d.name)}
+	default:
+		return nil
+	}
+}
+
+type metrics struct {
+	sentMessages      messagingconv.ClientSentMessages
+	operationDuration messagingconv.ClientOperationDuration
+	bodySize          metric.Int64Histogram
+	injectionSkipped  metric.Int64Counter
+}
+
+// newMetrics creates the instruments.
+// Errors are passed to [otel.Handle] and the failed instruments fall back to no-op ones.
+func newMetrics(mp metric.MeterProvider) *metrics {
+	meter := mp.Meter(meterName)
+	m := &metrics{}
+	var err error
+	if m.sentMessages, err = messagingconv.NewClientSentMessages(meter); err != nil {
+		otel.Handle(err)
+	}
+	if m.operationDuration, err = messagingconv.NewClientOperationDuration(meter); err != nil {
+		otel.Handle(err)
+	}
+	if m.bodySize, err = meter.Int64Histogram(metricNameMessageBodySize,
+		metric.WithDescription("Size of the message body."),
+		metric.WithUnit("By"),
+	); err != nil {
+		otel.Handle(err)
+	}
+	if m.injectionSkipped, err = meter.Int64Counter(metricNameInjectionSkipped,
+		metric.WithDescription("Number of messages published without trace context because of the destination filter, the sampling decision or the unsupported destination."),
+		metric.WithUnit("{message}"),
+	); err != nil {
+		otel.Handle(err)
+	}
+	return m
+}
+
+// recordOperation records the duration of the publish operation to the destination.
+func (m *metrics) recordOperation(ctx context.Context, destination metricDestination, duration time.Duration, err error) {
+	attrs := append([]attribute.KeyValue{m.operationDuration.AttrOperationType(messagingconv.OperationTypeSend)}, destination.attributes()...)
+	if err != nil {
+		attrs = append(attrs, errorType(err))
+	}
+	m.operationDuration.Record(ctx, duration.Seconds(), operationPublish.name, messagingconv.SystemAWSSNS, attrs...)
+}
+
+// addSentMessages counts n messages published to the destination.
+// errType is empty if the messages are published successfully.
+func (m *metrics) addSentMessages(ctx context.Context, destination metricDestination, n int, errType string) {
+	if n == 0 {
+		return
+	}
+	attrs := destination.attributes()
+	if errType != "" {
+		attrs = append(attrs, m.sentMessages.AttrErrorType(messagingconv.ErrorTypeAttr(errType)))
+	}
+	m.sentMessages.Add(ctx, int64(n), operationPublish.name, messagingconv.SystemAWSSNS, attrs...)
+}
+
+// recordBodySize records the size of the message body published to the destination in bytes.
+func (m *metrics) recordBodySize(ctx context.Context, destination metricDestination, body *string) {
+	attrs := append([]attribute.KeyValue{
+		semconv.MessagingSystemAWSSNS,
+		semconv.MessagingOperationName(operationPublish.name),
+	}, destination.attributes()...)
+	m.bodySize.Record(ctx, int64(len(deref(body))), metric.WithAttributes(attrs...))
+}
+
+// addInjectionSkipped counts a message published to the destination without trace context because of the decision.
+func (m *metrics) addInjectionSkipped(ctx context.Context, destination metricDestination, decision injectionDecision) {
+	attrs := append([]attribute.KeyValue{
+		semconv.MessagingSystemAWSSNS,
+		decision.attribute(),
+	}, destination.attributes()...)
+	m.injectionSkipped.Add(ctx, 1, metric.WithAttributes(attrs...))
+}
+
+// addPlatformInjectionSkipped counts a message published directly to the platform without trace context because of the decision.
+// It is counted by the platform rather than the destination, as most of such messages are skipped by default.
+func (m *metrics) addPlatformInjectionSkipped(ctx context.Context, platform Platform, decision injectionDecision) {
+	m.injectionSkipped.Add(ctx, 1, metric.WithAttributes(
+		semconv.MessagingSystemAWSSNS,
+		decision.attribute(),
+		attrKeyPlatform.String(string(platform)),
+	))
+}
@@ -0,0 +1,231 @@
+package pub_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aereal/otelpubsub/amazonsns/internal/utils"
+	"github.com/aereal/otelpubsub/amazonsns/pub"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata/metricdatatest"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestMiddleware_metrics(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("ParseForm: %s", err)
+			return
+		}
+		switch r.PostForm.Get("Action") {
+		case "Publish":
+			_, _ = io.WriteString(w, `<PublishResponse><PublishResult><MessageId>msg-1</MessageId></PublishResult></PublishResponse>`)
+		case "PublishBatch":
+			_, _ = io.WriteString(w, `<PublishBatchResponse><PublishBatchResult><Successful><member><Id>1</Id><MessageId>msg-1</MessageId></member></Successful><Failed><member><Id>2</Id><Code>InvalidParameterValue</Code><SenderFault>true</SenderFault><Message>invalid message</Message></member></Failed></PublishBatchResult></PublishBatchResponse>`)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(tracetest.NewInMemoryExporter()))
+	cfg := aws.Config{
+		Region:       "us-east-1",
+		Credentials:  staticCredentials("id", "secret", "token"),
+		BaseEndpoint: &srv.URL,
+	}
+	pub.AppendMiddlewares(&cfg.APIOptions, pub.WithTracerProvider(tp), pub.WithMeterProvider(mp), pub.WithPropagator(propagation.TraceContext{}))
+	client := sns.NewFromConfig(cfg)
+
+	topicARN := utils.Ptr("arn:aws:sns:us-east-1:1234567890123:topic-1")
+	if _, err := client.Publish(t.Context(), &sns.PublishInput{TopicArn: topicARN, Message: utils.Ptr("hello")}); err != nil {
+		t.Fatal(err)
+	}
+	batchInput := &sns.PublishBatchInput{
+		TopicArn: topicARN,
+		PublishBatchRequestEntries: []types.PublishBatchRequestEntry{
+			{Id: utils.Ptr("1"), Message: utils.Ptr("msg-1")},
+			{Id: utils.Ptr("2"), Message: utils.Ptr("msg-2")},
+		},
+	}
+	if _, err := client.PublishBatch(t.Context(), batchInput); err != nil {
+		t.Fatal(err)
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(t.Context(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	if len(rm.ScopeMetrics) != 1 {
+		t.Fatalf("got %d scope metrics, want 1", len(rm.ScopeMetrics))
+	}
+	got := map[string]metricdata.Metrics{}
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		got[m.Name] = m
+	}
+
+	baseAttrs := []attribute.KeyValue{
+		attribute.String("messaging.system", "aws.sns"),
+		attribute.String("messaging.operation.name", "publish"),
+		attribute.String("messaging.destination.name", "topic-1"),
+	}
+	wantSentMessages := metricdata.Metrics{
+		Name:        "messaging.client.sent.messages",
+		Description: "Number of messages producer attempted to send to the broker.",
+		Unit:        "{message}",
+		Data: metricdata.Sum[int64]{
+			Temporality: metricdata.CumulativeTemporality,
+			IsMonotonic: true,
+			DataPoints: []metricdata.DataPoint[int64]{
+				{Attributes: attribute.NewSet(baseAttrs...), Value: 2},
+				{Attributes: attribute.NewSet(append(baseAttrs, attribute.String("error.type", "InvalidParameterValue"))...), Value: 1},
+			},
+		},
+	}
+	metricdatatest.AssertEqual(t, wantSentMessages, got["messaging.client.sent.messages"], metricdatatest.IgnoreTimestamp(), metricdatatest.IgnoreExemplars())
+
+	wantDuration := metricdata.Metrics{
+		Name:        "messaging.client.operation.duration",
+		Description: "Duration of messaging operation initiated by a producer or consumer client.",
+		Unit:        "s",
+		Data: metricdata.Histogram[float64]{
+			Temporality: metricdata.CumulativeTemporality,
+			DataPoints: []metricdata.HistogramDataPoint[float64]{
+				{Attributes: attribute.NewSet(append(baseAttrs, attribute.String("messaging.operation.type", "send"))...), Count: 2},
+			},
+		},
+	}
+	metricdatatest.AssertEqual(t, wantDuration, got["messaging.client.operation.duration"], metricdatatest.IgnoreTimestamp(), metricdatatest.IgnoreExemplars(), metricdatatest.IgnoreValue())
+
+	bodySize, ok := got["otelpubsub.message.body.size"].Data.(metricdata.Histogram[int64])
+	if !ok || len(bodySize.DataPoints) != 1 {
+		t.Fatalf("unexpected body size data: %#v", got["otelpubsub.message.body.size"].Data)
+	}
+	if dp := bodySize.DataPoints[0]; dp.Count != 3 || dp.Sum != int64(len("hello")+len("msg-1")+len("msg-2")) {
+		t.Errorf("body size: count=%d sum=%d", dp.Count, dp.Sum)
+	}
+}
+
+func TestMiddleware_metrics_platformEndpoints(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `<PublishResponse><PublishResult><MessageId>msg-1</MessageId></PublishResult></PublishResponse>`)
+	}))
+	t.Cleanup(srv.Close)
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(tracetest.NewInMemoryExporter()))
+	cfg := aws.Config{
+		Region:       "us-east-1",
+		Credentials:  staticCredentials("id", "secret", "token"),
+		BaseEndpoint: &srv.URL,
+	}
+	pub.AppendMiddlewares(&cfg.APIOptions, pub.WithTracerProvider(tp), pub.WithMeterProvider(mp), pub.WithPropagator(propagation.TraceContext{}))
+	client := sns.NewFromConfig(cfg)
+
+	for _, targetARN := range []string{
+		"arn:aws:sns:us-east-1:1234567890123:endpoint/GCM/app-1/11111111-2222-3333-4444-555555555555",
+		"arn:aws:sns:us-east-1:1234567890123:endpoint/GCM/app-1/66666666-7777-8888-9999-000000000000",
+	} {
+		if _, err := client.Publish(t.Context(), &sns.PublishInput{TargetArn: utils.Ptr(targetARN), Message: utils.Ptr("hello")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(t.Context(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	wantAttrs := attribute.NewSet(
+		attribute.String("messaging.system", "aws.sns"),
+		attribute.String("messaging.operation.name", "publish"),
+		attribute.String("messaging.destination.template", "endpoint/GCM/app-1"),
+	)
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		if m.Name != "messaging.client.sent.messages" {
+			continue
+		}
+		want := metricdata.Metrics{
+			Name:        "messaging.client.sent.messages",
+			Description: "Number of messages producer attempted to send to the broker.",
+			Unit:        "{message}",
+			Data: metricdata.Sum[int64]{
+				Temporality: metricdata.CumulativeTemporality,
+				IsMonotonic: true,
+				DataPoints:  []metricdata.DataPoint[int64]{{Attributes: wantAttrs, Value: 2}},
+			},
+		}
+		metricdatatest.AssertEqual(t, want, m, metricdatatest.IgnoreTimestamp(), metricdatatest.IgnoreExemplars())
+		return
+	}
+	t.Error("messaging.client.sent.messages is not recorded")
+}
+
+func TestMiddleware_metrics_platformInjectionSkipped(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `<PublishResponse><PublishResult><MessageId>msg-1</MessageId></PublishResult></PublishResponse>`)
+	}))
+	t.Cleanup(srv.Close)
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(tracetest.NewInMemoryExporter()))
+	cfg := aws.Config{
+		Region:       "us-east-1",
+		Credentials:  staticCredentials("id", "secret", "token"),
+		BaseEndpoint: &srv.URL,
+	}
+	pub.AppendMiddlewares(&cfg.APIOptions, pub.WithTracerProvider(tp), pub.WithMeterProvider(mp), pub.WithPropagator(propagation.TraceContext{}))
+	client := sns.NewFromConfig(cfg)
+
+	for _, targetARN := range []string{
+		"arn:aws:sns:us-east-1:1234567890123:endpoint/GCM/app-1/11111111-2222-3333-4444-555555555555",
+		"arn:aws:sns:us-east-1:1234567890123:endpoint/GCM/app-2/66666666-7777-8888-9999-000000000000",
+	} {
+		if _, err := client.Publish(t.Context(), &sns.PublishInput{TargetArn: utils.Ptr(targetARN), Message: utils.Ptr("hello")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(t.Context(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		if m.Name != "otelpubsub.injection.skipped" {
+			continue
+		}
+		want := metricdata.Metrics{
+			Name:        "otelpubsub.injection.skipped",
+			Description: "Number of messages published without trace context because of the destination filter, the sampling decision or the unsupported destination.",
+			Unit:        "{message}",
+			Data: metricdata.Sum[int64]{
+				Temporality: metricdata.CumulativeTemporality,
+				IsMonotonic: true,
+				DataPoints: []metricdata.DataPoint[int64]{{
+					Attributes: attribute.NewSet(
+						attribute.String("messaging.system", "aws.sns"),
+						attribute.String("otelpubsub.injection.decision", "unsupported_destination"),
+						attribute.String("otelpubsub.platform", "GCM"),
+					),
+					Value: 2,
+				}},
+			},
+		}
+		metricdatatest.AssertEqual(t, want, m, metricdatatest.IgnoreTimestamp(), metricdatatest.IgnoreExemplars())
+		return
+	}
+	t.Error("otelpubsub.injection.skipped is not recorded")
+}
@@ -2,53 +2,358 @@ package pub
 
 import (
 	"context"
+	"errors"
+	"maps"
+	"time"
 
-	"github.com/aereal/otelpubsub/amazonsns/internal"
+	"github.com/aereal/otelpubsub/amazonsns/internal/utils"
 	"github.com/aws/aws-sdk-go-v2/service/sns"
 	"github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"github.com/aws/smithy-go"
 	"github.com/aws/smithy-go/middleware"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.39.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// AppendMiddlewares registers a middleware that injects trace context into SNS message attributes
-// before Publish and PublishBatch API calls.
+const tracerName = "github.com/aereal/otelpubsub/amazonsns/pub"
+
+// AppendMiddlewares registers a middleware that starts a PRODUCER span and injects its trace context into SNS message attributes
+// before Publish API calls.
+// For PublishBatch API calls it starts a "create" span for each entry, injects each span's trace context into the entry,
+// and starts a "publish" span linked to all of them.
+// Calls that succeed or fail after retries record each attempt as an event on the publish span.
 // Pass the APIOptions field from [sns.Options] to this function.
-func AppendMiddlewares(apiOptions *[]func(*middleware.Stack) error) {
+// By default the global TracerProvider and TextMapPropagator are used, falling back to W3C Trace Context and Baggage
+// while no global TextMapPropagator is set; see [AppendMiddlewaresOption] to override them.
+func AppendMiddlewares(apiOptions *[]func(*middleware.Stack) error, opts ...AppendMiddlewaresOption) {
+	cfg := newConfig(opts)
+	inst := &instrumenter{
+		tracer:                     cfg.tracerProvider.Tracer(tracerName),
+		propagator:                 cfg.propagator,
+		budgetPolicy:               cfg.budgetPolicy,
+		packedEncoding:             cfg.packedEncoding,
+		metrics:                    newMetrics(cfg.meterProvider),
+		existingTraceContextPolicy: cfg.existingTraceContextPolicy,
+		attributeProducers:         cfg.attributeProducers,
+		bodyEnvelopeMode:           cfg.bodyEnvelopeMode,
+		destinationFilter:          cfg.destinationFilter,
+		sampledOnly:                cfg.sampledOnly,
+		injectionPlacement:         cfg.injectionPlacement,
+		platformInjectionModes:     cfg.platformInjectionModes,
+	}
 	*apiOptions = append(*apiOptions, func(stack *middleware.Stack) error {
-		return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("InstrumentPub", instrumentPublish), middleware.Before)
+		if err := stack.Initialize.Add(middleware.InitializeMiddlewareFunc("InstrumentPub", inst.instrumentPublish), middleware.Before); err != nil {
+			return err
+		}
+		if err := addTrackAttempt(stack); err != nil {
+			return err
+		}
+		if cfg.injectionPlacement == InjectionPlacementSerialize {
+			return stack.Serialize.Add(middleware.SerializeMiddlewareFunc("InjectPub", inst.injectSerialize), middleware.Before)
+		}
+		return nil
 	})
+	if cfg.preflightValidation {
+		*apiOptions = append(*apiOptions, func(stack *middleware.Stack) error {
+			if cfg.injectionPlacement == InjectionPlacementSerialize {
+				return stack.Serialize.Insert(middleware.SerializeMiddlewareFunc("ValidatePub", validateSerialize), "InjectPub", middleware.After)
+			}
+			return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("ValidatePub", validate), middleware.After)
+		})
+	}
 }
 
-func instrumentPublish(ctx context.Context, input middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+type instrumenter struct {
+	tracer                     trace.Tracer
+	propagator                 propagation.TextMapPropagator
+	budgetPolicy               AttributeBudgetPolicy
+	packedEncoding             PackedEncoding
+	metrics                    *metrics
+	existingTraceContextPolicy ExistingTraceContextPolicy
+	attributeProducers         []SNSPublishSpanAttributeProducer
+	bodyEnvelopeMode           BodyEnvelopeMode
+	destinationFilter          DestinationFilter
+	sampledOnly                bool
+	injectionPlacement         InjectionPlacement
+	platformInjectionModes     map[Platform]PlatformInjectionMode
+}
+
+func (i *instrumenter) instrumentPublish(ctx context.Context, input middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
 	switch params := input.Parameters.(type) {
 	case *sns.PublishInput:
-		mas := params.MessageAttributes
-		if mas == nil {
-			mas = map[string]types.MessageAttributeValue{}
-		}
-		internal.Propagator.Inject(ctx, NewMessageAttributeCarrier(mas))
-		params.MessageAttributes = mas
-		input.Parameters = params
+		return i.instrumentPublishMessage(ctx, params, input, next)
 	case *sns.PublishBatchInput:
-		entries := make([]types.PublishBatchRequestEntry, 0, len(params.PublishBatchRequestEntries))
-		for _, original := range params.PublishBatchRequestEntries {
-			entry := cloneEntry(original)
-			if entry.MessageAttributes == nil {
-				entry.MessageAttributes = map[string]types.MessageAttributeValue{}
+		return i.instrumentPublishBatch(ctx, params, input, next)
+	default:
+		return next.HandleInitialize(ctx, input)
+	}
+}
+
+func (i *instrumenter) instrumentPublishMessage(ctx context.Context, params *sns.PublishInput, input middleware.InitializeInput, next middleware.InitializeHandler) (_ middleware.InitializeOutput, _ middleware.Metadata, err error) {
+	params = cloneInput(params)
+	input.Parameters = params
+
+	destination := metricDestinationOf(deref(params.TopicArn), deref(params.TargetArn), deref(params.PhoneNumber))
+	ctx, span := i.startSpan(ctx, operationPublish, deref(params.TopicArn), deref(params.TargetArn), deref(params.PhoneNumber), trace.WithSpanKind(trace.SpanKindProducer))
+	defer func() { endSpan(span, err) }()
+
+	if i.injectionPlacement == InjectionPlacementInitialize {
+		if injectErr := i.injectPublishMessage(ctx, span, params); injectErr != nil {
+			return middleware.InitializeOutput{}, middleware.Metadata{}, injectErr
+		}
+	}
+
+	i.metrics.recordBodySize(ctx, destination, params.Message)
+	ctx, tracker := withAttemptTracker(ctx)
+	startedAt := time.Now()
+	out, md, err := next.HandleInitialize(ctx, input)
+	recordAttempts(span, tracker, md)
+	i.metrics.recordOperation(ctx, destination, time.Since(startedAt), err)
+	i.metrics.addSentMessages(ctx, destination, 1, errorTypeOf(err))
+	res, _ := out.Result.(*sns.PublishOutput)
+	if res != nil && res.MessageId != nil {
+		span.SetAttributes(semconv.MessagingMessageID(*res.MessageId))
+	}
+	i.producePublishAttributes(span, params, res)
+	return out, md, err
+}
+
+// instrumentPublishBatch starts a "create" span for each entry and injects its trace context into the entry,
+// then starts a "publish" span linked to all of the "create" spans.
+// Entries reported as failed in the output mark their "create" spans as errors.
+func (i *instrumenter) instrumentPublishBatch(ctx context.Context, params *sns.PublishBatchInput, input middleware.InitializeInput, next middleware.InitializeHandler) (_ middleware.InitializeOutput, _ middleware.Metadata, err error) {
+	params = cloneInput(params)
+	input.Parameters = params
+
+	topicARN := deref(params.TopicArn)
+	entries := make([]types.PublishBatchRequestEntry, 0, len(params.PublishBatchRequestEntries))
+	createSpans := make([]trace.Span, 0, len(params.PublishBatchRequestEntries))
+	createSpanByID := make(map[string]trace.Span, len(params.PublishBatchRequestEntries))
+	links := make([]trace.Link, 0, len(params.PublishBatchRequestEntries))
+	defer func() {
+		for _, createSpan := range createSpans {
+			endSpan(createSpan, err)
+		}
+	}()
+	for _, original := range params.PublishBatchRequestEntries {
+		entry := cloneEntry(original)
+		if entry.MessageAttributes == nil {
+			entry.MessageAttributes = map[string]types.MessageAttributeValue{}
+		}
+		entryID := deref(entry.Id)
+		createCtx, createSpan := i.startSpan(ctx, operationCreate, topicARN, "", "",
+			trace.WithSpanKind(trace.SpanKindProducer),
+			trace.WithAttributes(attrKeyBatchEntryID.String(entryID)),
+		)
+		createSpans = append(createSpans, createSpan)
+		createSpanByID[entryID] = createSpan
+		links = append(links, trace.Link{SpanContext: createSpan.SpanContext()})
+		if injectErr := i.injectBatchEntry(createCtx, createSpan, topicARN, &entry); injectErr != nil {
+			return middleware.InitializeOutput{}, middleware.Metadata{}, injectErr
+		}
+		entries = append(entries, entry)
+	}
+	params.PublishBatchRequestEntries = entries
+
+	ctx, span := i.startSpan(ctx, operationPublish, topicARN, "", "",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithLinks(links...),
+		trace.WithAttributes(semconv.MessagingBatchMessageCount(len(entries))),
+	)
+	defer func() { endSpan(span, err) }()
+
+	destination := metricDestinationOf(topicARN, "", "")
+	for _, entry := range entries {
+		i.metrics.recordBodySize(ctx, destination, entry.Message)
+	}
+	ctx, tracker := withAttemptTracker(ctx)
+	startedAt := time.Now()
+	out, md, err := next.HandleInitialize(ctx, input)
+	recordAttempts(span, tracker, md)
+	i.metrics.recordOperation(ctx, destination, time.Since(startedAt), err)
+	if err != nil {
+		i.metrics.addSentMessages(ctx, destination, len(entries), errorTypeOf(err))
+	}
+	res, _ := out.Result.(*sns.PublishBatchOutput)
+	if res != nil {
+		i.metrics.addSentMessages(ctx, destination, len(res.Successful), "")
+		for _, entry := range res.Failed {
+			i.metrics.addSentMessages(ctx, destination, 1, deref(entry.Code))
+		}
+		for _, entry := range res.Successful {
+			if createSpan, ok := createSpanByID[deref(entry.Id)]; ok && entry.MessageId != nil {
+				createSpan.SetAttributes(semconv.MessagingMessageID(*entry.MessageId))
 			}
-			internal.Propagator.Inject(ctx, NewMessageAttributeCarrier(entry.MessageAttributes))
-			entries = append(entries, entry)
 		}
-		params.PublishBatchRequestEntries = entries
-		input.Parameters = params
+		for _, entry := range res.Failed {
+			if createSpan, ok := createSpanByID[deref(entry.Id)]; ok {
+				createSpan.SetStatus(codes.Error, deref(entry.Message))
+				createSpan.SetAttributes(
+					semconv.ErrorTypeKey.String(deref(entry.Code)),
+					attrKeyBatchSenderFault.Bool(entry.SenderFault),
+				)
+			}
+		}
+		span.SetAttributes(attrKeyBatchFailedCount.Int(len(res.Failed)))
 	}
-	return next.HandleInitialize(ctx, input)
+	i.produceBatchEntryAttributes(createSpans, params, res)
+	return out, md, err
+}
+
+// injectPublishMessage injects the trace context of the span into the message and records the decision on the span.
+func (i *instrumenter) injectPublishMessage(ctx context.Context, span trace.Span, params *sns.PublishInput) error {
+	topicARN, targetARN := deref(params.TopicArn), deref(params.TargetArn)
+	if decision := i.skipDecision(topicARN, targetARN, span.SpanContext()); decision != "" {
+		span.SetAttributes(decision.attribute())
+		i.metrics.addInjectionSkipped(ctx, metricDestinationOf(topicARN, targetARN, deref(params.PhoneNumber)), decision)
+		return nil
+	}
+	if platform, ok := platformOf(params); ok {
+		switch i.platformInjectionModes[platform] {
+		case PlatformInjectionModeAttributes:
+		case PlatformInjectionModePayload:
+			decision, err := i.injectPayload(ctx, platform, params)
+			if err != nil {
+				return err
+			}
+			i.recordPlatformDecision(ctx, span, platform, decision)
+			return nil
+		default:
+			i.recordPlatformDecision(ctx, span, platform, injectionDecisionUnsupportedDestination)
+			return nil
+		}
+	}
+	mas := maps.Clone(params.MessageAttributes)
+	if mas == nil {
+		mas = map[string]types.MessageAttributeValue{}
+	}
+	decision, err := i.inject(ctx, "", mas)
+	if err != nil {
+		return err
+	}
+	params.MessageAttributes = mas
+	params.Message, decision, err = i.injectBody(ctx, params.Message, params.MessageStructure, decision)
+	if err != nil {
+		return err
+	}
+	if decision != "" {
+		span.SetAttributes(decision.attribute())
+	}
+	return nil
+}
+
+// injectBatchEntry injects the trace context of the "create" span into the entry and records the decision on the span.
+// The message attributes of the entry must be already cloned.
+func (i *instrumenter) injectBatchEntry(ctx context.Context, span trace.Span, topicARN string, entry *types.PublishBatchRequestEntry) error {
+	if decision := i.skipDecision(topicARN, "", span.SpanContext()); decision != "" {
+		span.SetAttributes(decision.attribute())
+		i.metrics.addInjectionSkipped(ctx, metricDestinationOf(topicARN, "", ""), decision)
+		return nil
+	}
+	decision, err := i.inject(ctx, deref(entry.Id), entry.MessageAttributes)
+	if err != nil {
+		return err
+	}
+	entry.Message, decision, err = i.injectBody(ctx, entry.Message, entry.MessageStructure, decision)
+	if err != nil {
+		return err
+	}
+	if decision != "" {
+		span.SetAttributes(decision.attribute())
+	}
+	return nil
+}
+
+var (
+	attrKeyBatchSenderFault = attribute.Key("otelpubsub.batch.sender_fault")
+	attrKeyBatchFailedCount = attribute.Key("otelpubsub.batch.failed_count")
+)
+
+type operation struct {
+	name          string
+	operationType attribute.KeyValue
+}
+
+var (
+	operationPublish = operation{name: "publish", operationType: semconv.MessagingOperationTypeSend}
+	operationCreate  = operation{name: "create", operationType: semconv.MessagingOperationTypeCreate}
+)
+
+// startSpan starts a span for the destination.
+// The span of a message published directly to a phone number or a platform endpoint is named after the destination template,
+// so that the span names stay low-cardinality.
+func (i *instrumenter) startSpan(ctx context.Context, op operation, topicARN, targetARN, phoneNumber string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{
+		semconv.MessagingSystemAWSSNS,
+		op.operationType,
+		semconv.MessagingOperationName(op.name),
+	}
+	if topicARN != "" {
+		attrs = append(attrs, semconv.AWSSNSTopicARN(topicARN))
+	}
+	spanName := op.name
+	destinationName := utils.DestinationNameOf(topicARN, targetARN)
+	if destinationName != "" {
+		attrs = append(attrs, semconv.MessagingDestinationName(destinationName))
+	}
+	if template := utils.DestinationTemplateOf(topicARN, targetARN, phoneNumber); template != "" {
+		attrs = append(attrs, semconv.MessagingDestinationTemplate(template))
+		spanName += " " + template
+	} else if destinationName != "" {
+		spanName += " " + destinationName
+	}
+	return i.tracer.Start(ctx, spanName, append(opts, trace.WithAttributes(attrs...))...)
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "")
+		span.SetAttributes(errorType(err))
+	}
+	span.End()
+}
+
+func errorType(err error) attribute.KeyValue {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() != "" {
+		return semconv.ErrorTypeKey.String(apiErr.ErrorCode())
+	}
+	return semconv.ErrorType(err)
+}
+
+// errorTypeOf returns the value of [errorType] or an empty string if err is nil.
+func errorTypeOf(err error) string {
+	if err == nil {
+		return ""
+	}
+	return errorType(err).Value.AsString()
+}
+
+func deref[V any](ptr *V) V {
+	var zero V
+	if ptr == nil {
+		return zero
+	}
+	return *ptr
+}
+
+// cloneInput returns a shallow copy of the input to inject the trace context into,
+// so that the caller can reuse the input concurrently or across retries.
+func cloneInput[T any](params *T) *T {
+	cloned := *params
+	return &cloned
 }
 
+// cloneEntry is the [cloneInput] for a batch entry, which also clones the message attributes.
 func cloneEntry(original types.PublishBatchRequestEntry) types.PublishBatchRequestEntry {
 	return types.PublishBatchRequestEntry{
 		Id:                     original.Id,
 		Message:                original.Message,
-		MessageAttributes:      original.MessageAttributes,
+		MessageAttributes:      maps.Clone(original.MessageAttributes),
 		MessageDeduplicationId: original.MessageDeduplicationId,
 		MessageGroupId:         original.MessageGroupId,
 		MessageStructure:       original.MessageStructure,
@@ -4,22 +4,28 @@ import (
 	stdcmp "cmp"
 	"context"
 	"fmt"
+	"io"
 	"iter"
 	"maps"
 	"net/http"
 	"net/http/httptest"
 	"slices"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/aereal/otelpubsub/amazonsns/internal/utils"
 	"github.com/aereal/otelpubsub/amazonsns/pub"
+	pubsemconv "github.com/aereal/otelpubsub/amazonsns/pub/semconv/v1.39.0"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/sns"
 	"github.com/aws/aws-sdk-go-v2/service/sns/types"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/sdk/instrumentation"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
@@ -40,6 +46,9 @@ type messageAttributeValue struct {
 func TestMiddleware_publish(t *testing.T) {
 	t.Parallel()
 
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
 	var gotMsgAttrs map[string]messageAttributeValue
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if err := r.ParseForm(); err != nil {
@@ -47,6 +56,7 @@ func TestMiddleware_publish(t *testing.T) {
 			return
 		}
 		gotMsgAttrs = aggregateMessageAttributeValues(iterateSortedMapEntries(r.PostForm))
+		_, _ = io.WriteString(w, `<PublishResponse><PublishResult><MessageId>msg-1</MessageId></PublishResult></PublishResponse>`)
 	}))
 	t.Cleanup(srv.Close)
 	cfg := aws.Config{
@@ -54,14 +64,12 @@ func TestMiddleware_publish(t *testing.T) {
 		Credentials:  staticCredentials("id", "secret", "token"),
 		BaseEndpoint: &srv.URL,
 	}
-	pub.AppendMiddlewares(&cfg.APIOptions)
+	pub.AppendMiddlewares(&cfg.APIOptions, pub.WithTracerProvider(tp), pub.WithPropagator(propagation.TraceContext{}))
 	client := sns.NewFromConfig(cfg)
 
-	exporter := tracetest.NewInMemoryExporter()
-	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
-
 	input := &sns.PublishInput{
-		Message: utils.Ptr("msg"),
+		TopicArn: utils.Ptr("arn:aws:sns:us-east-1:1234567890123:topic-1"),
+		Message:  utils.Ptr("msg"),
 	}
 
 	ctx, span := tp.Tracer("test").Start(t.Context(), "parent")
@@ -72,13 +80,41 @@ func TestMiddleware_publish(t *testing.T) {
 	if err := tp.ForceFlush(t.Context()); err != nil {
 		t.Fatal(err)
 	}
+	gotSpans := exporter.GetSpans()
+	if len(gotSpans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(gotSpans))
+	}
 	wantMsgAttrs := map[string]messageAttributeValue{
-		"traceparent": {DataType: utils.DataTypeString, Value: fmt.Sprintf("00-%s-%s-01", span.SpanContext().TraceID(), span.SpanContext().SpanID())},
+		"traceparent": {DataType: utils.DataTypeString, Value: traceparentOf(gotSpans[0].SpanContext)},
 	}
 	if diff := cmp.Diff(wantMsgAttrs, gotMsgAttrs); diff != "" {
 		t.Errorf("message attributes (-want, +got):\n%s", diff)
 	}
 	wantSpans := []tracetest.SpanStub{
+		{
+			Name:        "publish topic-1",
+			SpanContext: trace.NewSpanContext(trace.SpanContextConfig{TraceFlags: trace.FlagsSampled, TraceID: dummyTraceID, SpanID: dummySpanID}),
+			Parent:      trace.NewSpanContext(trace.SpanContextConfig{TraceFlags: trace.FlagsSampled, TraceID: dummyTraceID, SpanID: dummySpanID}),
+			SpanKind:    trace.SpanKindProducer,
+			Attributes: []attribute.KeyValue{
+				attribute.String("messaging.system", "aws.sns"),
+				attribute.String("messaging.operation.type", "send"),
+				attribute.String("messaging.operation.name", "publish"),
+				attribute.String("aws.sns.topic.arn", "arn:aws:sns:us-east-1:1234567890123:topic-1"),
+				attribute.String("messaging.destination.name", "topic-1"),
+				attribute.String("otelpubsub.injection.decision", "full"),
+				attribute.String("messaging.message.id", "msg-1"),
+			},
+			Resource: resource.NewSchemaless(
+				attribute.String("service.name", "unknown_service:pub.test"),
+				attribute.String("telemetry.sdk.language", "go"),
+				attribute.String("telemetry.sdk.name", "opentelemetry"),
+				attribute.String("telemetry.sdk.version", "1.43.0"),
+			),
+			InstrumentationScope: instrumentation.Scope{
+				Name: "github.com/aereal/otelpubsub/amazonsns/pub",
+			},
+		},
 		{
 			Name:        "parent",
 			SpanContext: trace.NewSpanContext(trace.SpanContextConfig{TraceFlags: trace.FlagsSampled, TraceID: dummyTraceID, SpanID: dummySpanID}),
@@ -89,19 +125,88 @@ func TestMiddleware_publish(t *testing.T) {
 				attribute.String("telemetry.sdk.name", "opentelemetry"),
 				attribute.String("telemetry.sdk.version", "1.43.0"),
 			),
+			ChildSpanCount: 1,
 			InstrumentationScope: instrumentation.Scope{
 				Name: "test",
 			},
 		},
 	}
-	if diff := diffSpans(wantSpans, exporter.GetSpans()); diff != "" {
+	if diff := diffSpans(wantSpans, gotSpans); diff != "" {
 		t.Errorf("spans (-want, +got):\n%s", diff)
 	}
 }
 
+func TestMiddleware_publish_directDestination(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		input     *sns.PublishInput
+		name      string
+		wantName  string
+		wantAttrs map[attribute.Key]string
+	}{
+		{
+			name:     "platform endpoint",
+			input:    &sns.PublishInput{TargetArn: utils.Ptr("arn:aws:sns:us-east-1:1234567890123:endpoint/GCM/app-1/11111111-2222-3333-4444-555555555555"), Message: utils.Ptr("msg")},
+			wantName: "publish endpoint/GCM/app-1",
+			wantAttrs: map[attribute.Key]string{
+				"messaging.destination.name":     "endpoint/GCM/app-1/11111111-2222-3333-4444-555555555555",
+				"messaging.destination.template": "endpoint/GCM/app-1",
+			},
+		},
+		{
+			name:      "phone number",
+			input:     &sns.PublishInput{PhoneNumber: utils.Ptr("+15555550100"), Message: utils.Ptr("msg")},
+			wantName:  "publish phone_number",
+			wantAttrs: map[attribute.Key]string{"messaging.destination.template": "phone_number"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = io.WriteString(w, `<PublishResponse><PublishResult><MessageId>msg-1</MessageId></PublishResult></PublishResponse>`)
+			}))
+			t.Cleanup(srv.Close)
+			exporter := tracetest.NewInMemoryExporter()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+			cfg := aws.Config{
+				Region:       "us-east-1",
+				Credentials:  staticCredentials("id", "secret", "token"),
+				BaseEndpoint: &srv.URL,
+			}
+			pub.AppendMiddlewares(&cfg.APIOptions, pub.WithTracerProvider(tp), pub.WithPropagator(propagation.TraceContext{}))
+			client := sns.NewFromConfig(cfg)
+			if _, err := client.Publish(t.Context(), tc.input); err != nil {
+				t.Fatal(err)
+			}
+			spans := exporter.GetSpans()
+			if len(spans) != 1 {
+				t.Fatalf("got %d spans, want 1", len(spans))
+			}
+			if spans[0].Name != tc.wantName {
+				t.Errorf("name: want=%q got=%q", tc.wantName, spans[0].Name)
+			}
+			gotAttrs := map[attribute.Key]string{}
+			for _, kv := range spans[0].Attributes {
+				if kv.Key == "messaging.destination.name" || kv.Key == "messaging.destination.template" {
+					gotAttrs[kv.Key] = kv.Value.AsString()
+				}
+			}
+			if diff := cmp.Diff(tc.wantAttrs, gotAttrs); diff != "" {
+				t.Errorf("destination attributes (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
 func TestMiddleware_publish_batch(t *testing.T) {
 	t.Parallel()
 
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
 	gotMsgAttrs := map[string]map[string]messageAttributeValue{}
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if err := r.ParseForm(); err != nil {
@@ -112,6 +217,7 @@ func TestMiddleware_publish_batch(t *testing.T) {
 			got := aggregateMessageAttributeValues(iterateSortedMapEntries(members))
 			gotMsgAttrs[entryIdx] = got
 		}
+		_, _ = io.WriteString(w, `<PublishBatchResponse><PublishBatchResult><Successful><member><Id>1</Id><MessageId>msg-1</MessageId></member><member><Id>2</Id><MessageId>msg-2</MessageId></member></Successful></PublishBatchResult></PublishBatchResponse>`)
 	}))
 	t.Cleanup(srv.Close)
 	cfg := aws.Config{
@@ -119,12 +225,9 @@ func TestMiddleware_publish_batch(t *testing.T) {
 		Credentials:  staticCredentials("id", "secret", "token"),
 		BaseEndpoint: &srv.URL,
 	}
-	pub.AppendMiddlewares(&cfg.APIOptions)
+	pub.AppendMiddlewares(&cfg.APIOptions, pub.WithTracerProvider(tp), pub.WithPropagator(propagation.TraceContext{}))
 	client := sns.NewFromConfig(cfg)
 
-	exporter := tracetest.NewInMemoryExporter()
-	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
-
 	input := &sns.PublishBatchInput{
 		TopicArn: utils.Ptr("arn:aws:sns:us-east-1:1234567890123:topic-1"),
 		PublishBatchRequestEntries: []types.PublishBatchRequestEntry{
@@ -146,38 +249,315 @@ func TestMiddleware_publish_batch(t *testing.T) {
 	if err := tp.ForceFlush(t.Context()); err != nil {
 		t.Fatal(err)
 	}
+	gotSpans := exporter.GetSpans()
+	if len(gotSpans) != 4 {
+		t.Fatalf("got %d spans, want 4", len(gotSpans))
+	}
+	publishSpan, createSpans := gotSpans[0], gotSpans[1:3]
 	wantMsgAttrs := map[string]map[string]messageAttributeValue{
 		"1": {
-			"traceparent": {DataType: utils.DataTypeString, Value: fmt.Sprintf("00-%s-%s-01", span.SpanContext().TraceID(), span.SpanContext().SpanID())},
+			"traceparent": {DataType: utils.DataTypeString, Value: traceparentOf(createSpans[0].SpanContext)},
 		},
 		"2": {
-			"traceparent": {DataType: utils.DataTypeString, Value: fmt.Sprintf("00-%s-%s-01", span.SpanContext().TraceID(), span.SpanContext().SpanID())},
+			"traceparent": {DataType: utils.DataTypeString, Value: traceparentOf(createSpans[1].SpanContext)},
 		},
 	}
 	if diff := cmp.Diff(wantMsgAttrs, gotMsgAttrs); diff != "" {
 		t.Errorf("message attributes (-want, +got):\n%s", diff)
 	}
+	for i, link := range publishSpan.Links {
+		if got, want := link.SpanContext.SpanID(), createSpans[i].SpanContext.SpanID(); got != want {
+			t.Errorf("link #%d: want=%s got=%s", i, want, got)
+		}
+	}
+	res := resource.NewSchemaless(
+		attribute.String("service.name", "unknown_service:pub.test"),
+		attribute.String("telemetry.sdk.language", "go"),
+		attribute.String("telemetry.sdk.name", "opentelemetry"),
+		attribute.String("telemetry.sdk.version", "1.43.0"),
+	)
 	wantSpans := []tracetest.SpanStub{
 		{
-			Name:        "parent",
+			Name:        "publish topic-1",
 			SpanContext: trace.NewSpanContext(trace.SpanContextConfig{TraceFlags: trace.FlagsSampled, TraceID: dummyTraceID, SpanID: dummySpanID}),
-			SpanKind:    trace.SpanKindInternal,
-			Resource: resource.NewSchemaless(
-				attribute.String("service.name", "unknown_service:pub.test"),
-				attribute.String("telemetry.sdk.language", "go"),
-				attribute.String("telemetry.sdk.name", "opentelemetry"),
-				attribute.String("telemetry.sdk.version", "1.43.0"),
-			),
-			InstrumentationScope: instrumentation.Scope{
-				Name: "test",
+			Parent:      trace.NewSpanContext(trace.SpanContextConfig{TraceFlags: trace.FlagsSampled, TraceID: dummyTraceID, SpanID: dummySpanID}),
+			SpanKind:    trace.SpanKindClient,
+			Attributes: []attribute.KeyValue{
+				attribute.Int("messaging.batch.message_count", 2),
+				attribute.String("messaging.system", "aws.sns"),
+				attribute.String("messaging.operation.type", "send"),
+				attribute.String("messaging.operation.name", "publish"),
+				attribute.String("aws.sns.topic.arn", "arn:aws:sns:us-east-1:1234567890123:topic-1"),
+				attribute.String("messaging.destination.name", "topic-1"),
+				attribute.Int("otelpubsub.batch.failed_count", 0),
+			},
+			Links: []sdktrace.Link{
+				{SpanContext: trace.NewSpanContext(trace.SpanContextConfig{TraceFlags: trace.FlagsSampled, TraceID: dummyTraceID, SpanID: dummySpanID})},
+				{SpanContext: trace.NewSpanContext(trace.SpanContextConfig{TraceFlags: trace.FlagsSampled, TraceID: dummyTraceID, SpanID: dummySpanID})},
+			},
+			Resource:             res,
+			InstrumentationScope: instrumentation.Scope{Name: "github.com/aereal/otelpubsub/amazonsns/pub"},
+		},
+		{
+			Name:        "create topic-1",
+			SpanContext: trace.NewSpanContext(trace.SpanContextConfig{TraceFlags: trace.FlagsSampled, TraceID: dummyTraceID, SpanID: dummySpanID}),
+			Parent:      trace.NewSpanContext(trace.SpanContextConfig{TraceFlags: trace.FlagsSampled, TraceID: dummyTraceID, SpanID: dummySpanID}),
+			SpanKind:    trace.SpanKindProducer,
+			Attributes: []attribute.KeyValue{
+				attribute.String("otelpubsub.batch.entry_id", "1"),
+				attribute.String("messaging.system", "aws.sns"),
+				attribute.String("messaging.operation.type", "create"),
+				attribute.String("messaging.operation.name", "create"),
+				attribute.String("aws.sns.topic.arn", "arn:aws:sns:us-east-1:1234567890123:topic-1"),
+				attribute.String("messaging.destination.name", "topic-1"),
+				attribute.String("otelpubsub.injection.decision", "full"),
+				attribute.String("messaging.message.id", "msg-1"),
 			},
+			Resource:             res,
+			InstrumentationScope: instrumentation.Scope{Name: "github.com/aereal/otelpubsub/amazonsns/pub"},
+		},
+		{
+			Name:        "create topic-1",
+			SpanContext: trace.NewSpanContext(trace.SpanContextConfig{TraceFlags: trace.FlagsSampled, TraceID: dummyTraceID, SpanID: dummySpanID}),
+			Parent:      trace.NewSpanContext(trace.SpanContextConfig{TraceFlags: trace.FlagsSampled, TraceID: dummyTraceID, SpanID: dummySpanID}),
+			SpanKind:    trace.SpanKindProducer,
+			Attributes: []attribute.KeyValue{
+				attribute.String("otelpubsub.batch.entry_id", "2"),
+				attribute.String("messaging.system", "aws.sns"),
+				attribute.String("messaging.operation.type", "create"),
+				attribute.String("messaging.operation.name", "create"),
+				attribute.String("aws.sns.topic.arn", "arn:aws:sns:us-east-1:1234567890123:topic-1"),
+				attribute.String("messaging.destination.name", "topic-1"),
+				attribute.String("otelpubsub.injection.decision", "full"),
+				attribute.String("messaging.message.id", "msg-2"),
+			},
+			Resource:             res,
+			InstrumentationScope: instrumentation.Scope{Name: "github.com/aereal/otelpubsub/amazonsns/pub"},
+		},
+		{
+			Name:                 "parent",
+			SpanContext:          trace.NewSpanContext(trace.SpanContextConfig{TraceFlags: trace.FlagsSampled, TraceID: dummyTraceID, SpanID: dummySpanID}),
+			SpanKind:             trace.SpanKindInternal,
+			Resource:             res,
+			ChildSpanCount:       3,
+			InstrumentationScope: instrumentation.Scope{Name: "test"},
 		},
 	}
-	if diff := diffSpans(wantSpans, exporter.GetSpans()); diff != "" {
+	if diff := diffSpans(wantSpans, gotSpans); diff != "" {
 		t.Errorf("spans (-want, +got):\n%s", diff)
 	}
 }
 
+func TestMiddleware_publish_batch_partialFailure(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `<PublishBatchResponse><PublishBatchResult><Successful><member><Id>1</Id><MessageId>msg-1</MessageId></member></Successful><Failed><member><Id>2</Id><Code>InvalidParameterValue</Code><SenderFault>true</SenderFault><Message>invalid message</Message></member></Failed></PublishBatchResult></PublishBatchResponse>`)
+	}))
+	t.Cleanup(srv.Close)
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	cfg := aws.Config{
+		Region:       "us-east-1",
+		Credentials:  staticCredentials("id", "secret", "token"),
+		BaseEndpoint: &srv.URL,
+	}
+	pub.AppendMiddlewares(&cfg.APIOptions, pub.WithTracerProvider(tp), pub.WithPropagator(propagation.TraceContext{}))
+	client := sns.NewFromConfig(cfg)
+
+	input := &sns.PublishBatchInput{
+		TopicArn: utils.Ptr("arn:aws:sns:us-east-1:1234567890123:topic-1"),
+		PublishBatchRequestEntries: []types.PublishBatchRequestEntry{
+			{Id: utils.Ptr("1"), Message: utils.Ptr("msg-1")},
+			{Id: utils.Ptr("2"), Message: utils.Ptr("msg-2")},
+		},
+	}
+	if _, err := client.PublishBatch(t.Context(), input); err != nil {
+		t.Fatal(err)
+	}
+	spans := exporter.GetSpans()
+	if len(spans) != 3 {
+		t.Fatalf("got %d spans, want 3", len(spans))
+	}
+	batchAttrs := attribute.NewSet(spans[0].Attributes...)
+	if got, _ := batchAttrs.Value("otelpubsub.batch.failed_count"); got.AsInt64() != 1 {
+		t.Errorf("failed count: got=%d", got.AsInt64())
+	}
+	if got := spans[1].Status; got.Code != codes.Unset {
+		t.Errorf("succeeded entry status: got=%#v", got)
+	}
+	wantStatus := sdktrace.Status{Code: codes.Error, Description: "invalid message"}
+	if diff := cmp.Diff(wantStatus, spans[2].Status); diff != "" {
+		t.Errorf("failed entry status (-want, +got):\n%s", diff)
+	}
+	failedAttrs := attribute.NewSet(spans[2].Attributes...)
+	if got, _ := failedAttrs.Value("error.type"); got.AsString() != "InvalidParameterValue" {
+		t.Errorf("error.type: got=%q", got.AsString())
+	}
+	if got, _ := failedAttrs.Value("otelpubsub.batch.sender_fault"); !got.AsBool() {
+		t.Errorf("sender fault: got=%v", got.AsBool())
+	}
+}
+
+func TestMiddleware_publish_concurrentReuse(t *testing.T) {
+	t.Parallel()
+
+	var mux sync.Mutex
+	gotTraceparents := map[string]struct{}{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("ParseForm: %s", err)
+			return
+		}
+		attrs := aggregateMessageAttributeValues(iterateSortedMapEntries(r.PostForm))
+		mux.Lock()
+		defer mux.Unlock()
+		gotTraceparents[attrs["traceparent"].Value] = struct{}{}
+	}))
+	t.Cleanup(srv.Close)
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(tracetest.NewInMemoryExporter()))
+	cfg := aws.Config{
+		Region:       "us-east-1",
+		Credentials:  staticCredentials("id", "secret", "token"),
+		BaseEndpoint: &srv.URL,
+	}
+	pub.AppendMiddlewares(&cfg.APIOptions, pub.WithTracerProvider(tp), pub.WithPropagator(propagation.TraceContext{}))
+	client := sns.NewFromConfig(cfg)
+
+	input := &sns.PublishInput{
+		TopicArn:          utils.Ptr("arn:aws:sns:us-east-1:1234567890123:topic-1"),
+		Message:           utils.Ptr("body"),
+		MessageAttributes: map[string]types.MessageAttributeValue{"user": utils.StringAttributeValue("v")},
+	}
+	const concurrency = 8
+	var wg sync.WaitGroup
+	for range concurrency {
+		wg.Go(func() {
+			ctx, span := tp.Tracer("test").Start(t.Context(), "parent")
+			defer span.End()
+			if _, err := client.Publish(ctx, input); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	wg.Wait()
+
+	if got := len(gotTraceparents); got != concurrency {
+		t.Errorf("distinct traceparents: want=%d got=%d", concurrency, got)
+	}
+	wantAttrs := map[string]types.MessageAttributeValue{"user": utils.StringAttributeValue("v")}
+	if diff := cmp.Diff(wantAttrs, input.MessageAttributes, cmpopts.IgnoreUnexported(types.MessageAttributeValue{})); diff != "" {
+		t.Errorf("the input is modified (-want, +got):\n%s", diff)
+	}
+}
+
+func TestMiddleware_publish_batch_concurrentReuse(t *testing.T) {
+	t.Parallel()
+
+	var mux sync.Mutex
+	gotTraceparents := map[string]struct{}{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("ParseForm: %s", err)
+			return
+		}
+		mux.Lock()
+		defer mux.Unlock()
+		for _, members := range iterateMembers(iterateSortedMapEntries(r.PostForm)) {
+			attrs := aggregateMessageAttributeValues(iterateSortedMapEntries(members))
+			gotTraceparents[attrs["traceparent"].Value] = struct{}{}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(tracetest.NewInMemoryExporter()))
+	cfg := aws.Config{
+		Region:       "us-east-1",
+		Credentials:  staticCredentials("id", "secret", "token"),
+		BaseEndpoint: &srv.URL,
+	}
+	pub.AppendMiddlewares(&cfg.APIOptions, pub.WithTracerProvider(tp), pub.WithPropagator(propagation.TraceContext{}))
+	client := sns.NewFromConfig(cfg)
+
+	input := &sns.PublishBatchInput{
+		TopicArn: utils.Ptr("arn:aws:sns:us-east-1:1234567890123:topic-1"),
+		PublishBatchRequestEntries: []types.PublishBatchRequestEntry{
+			{Id: utils.Ptr("1"), Message: utils.Ptr("msg-1"), MessageAttributes: map[string]types.MessageAttributeValue{"user": utils.StringAttributeValue("v")}},
+			{Id: utils.Ptr("2"), Message: utils.Ptr("msg-2")},
+		},
+	}
+	const concurrency = 8
+	var wg sync.WaitGroup
+	for range concurrency {
+		wg.Go(func() {
+			ctx, span := tp.Tracer("test").Start(t.Context(), "parent")
+			defer span.End()
+			if _, err := client.PublishBatch(ctx, input); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	wg.Wait()
+
+	if got := len(gotTraceparents); got != concurrency*2 {
+		t.Errorf("distinct traceparents: want=%d got=%d", concurrency*2, got)
+	}
+	wantAttrs := map[string]types.MessageAttributeValue{"user": utils.StringAttributeValue("v")}
+	if diff := cmp.Diff(wantAttrs, input.PublishBatchRequestEntries[0].MessageAttributes, cmpopts.IgnoreUnexported(types.MessageAttributeValue{})); diff != "" {
+		t.Errorf("the input is modified (-want, +got):\n%s", diff)
+	}
+	if input.PublishBatchRequestEntries[1].MessageAttributes != nil {
+		t.Errorf("the input is modified: %#v", input.PublishBatchRequestEntries[1].MessageAttributes)
+	}
+}
+
+func TestMiddleware_withAttributeProducers(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `<PublishBatchResponse><PublishBatchResult><Successful><member><Id>1</Id><MessageId>msg-1</MessageId></member><member><Id>2</Id><MessageId>msg-2</MessageId></member></Successful></PublishBatchResult></PublishBatchResponse>`)
+	}))
+	t.Cleanup(srv.Close)
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	cfg := aws.Config{
+		Region:       "us-east-1",
+		Credentials:  staticCredentials("id", "secret", "token"),
+		BaseEndpoint: &srv.URL,
+	}
+	pub.AppendMiddlewares(&cfg.APIOptions,
+		pub.WithTracerProvider(tp),
+		pub.WithPropagator(propagation.TraceContext{}),
+		pub.WithAttributeProducers(pubsemconv.PublishSpanAttributeProducer{}),
+	)
+	client := sns.NewFromConfig(cfg)
+
+	input := &sns.PublishBatchInput{
+		TopicArn: utils.Ptr("arn:aws:sns:us-east-1:1234567890123:topic-1.fifo"),
+		PublishBatchRequestEntries: []types.PublishBatchRequestEntry{
+			{Id: utils.Ptr("1"), Message: utils.Ptr("msg-1"), MessageGroupId: utils.Ptr("group-1")},
+			{Id: utils.Ptr("2"), Message: utils.Ptr("msg-2"), MessageGroupId: utils.Ptr("group-2")},
+		},
+	}
+	if _, err := client.PublishBatch(t.Context(), input); err != nil {
+		t.Fatal(err)
+	}
+	spans := exporter.GetSpans()
+	if len(spans) != 3 {
+		t.Fatalf("got %d spans, want 3", len(spans))
+	}
+	want := map[string]string{"1": "group-1", "2": "group-2"}
+	got := map[string]string{}
+	for _, span := range spans[1:] {
+		attrs := attribute.NewSet(span.Attributes...)
+		entryID, _ := attrs.Value("otelpubsub.batch.entry_id")
+		groupID, _ := attrs.Value("aws.sns.message.group_id")
+		got[entryID.AsString()] = groupID.AsString()
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("group IDs by entry ID (-want, +got):\n%s", diff)
+	}
+}
+
 func diffSpans(want, got []tracetest.SpanStub) string {
 	return cmp.Diff(want, got,
 		cmpopts.IgnoreFields(
@@ -188,6 +568,9 @@ func diffSpans(want, got []tracetest.SpanStub) string {
 		cmp.Comparer(func(a, b attribute.Set) bool {
 			return a.Equals(&b)
 		}),
+		cmp.Comparer(func(a, b attribute.Value) bool {
+			return a.Type() == b.Type() && a.Emit() == b.Emit()
+		}),
 		cmp.Comparer(func(a, b *resource.Resource) bool {
 			return a.Equal(b)
 		}),
@@ -201,6 +584,112 @@ func diffSpans(want, got []tracetest.SpanStub) string {
 	)
 }
 
+func TestMiddleware_publish_withPropagator(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+		opts []pub.AppendMiddlewaresOption
+	}{
+		{name: "specified", opts: []pub.AppendMiddlewaresOption{pub.WithPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))}},
+		// no global propagator is set in the tests
+		{name: "default falls back to trace context and baggage"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var gotMsgAttrs map[string]messageAttributeValue
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if err := r.ParseForm(); err != nil {
+					t.Errorf("ParseForm: %s", err)
+					return
+				}
+				gotMsgAttrs = aggregateMessageAttributeValues(iterateSortedMapEntries(r.PostForm))
+			}))
+			t.Cleanup(srv.Close)
+			cfg := aws.Config{
+				Region:       "us-east-1",
+				Credentials:  staticCredentials("id", "secret", "token"),
+				BaseEndpoint: &srv.URL,
+			}
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(tracetest.NewInMemoryExporter()))
+			pub.AppendMiddlewares(&cfg.APIOptions, append([]pub.AppendMiddlewaresOption{pub.WithTracerProvider(tp)}, tc.opts...)...)
+			client := sns.NewFromConfig(cfg)
+
+			member, err := baggage.NewMember("tenant", "t-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			bag, err := baggage.New(member)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx := baggage.ContextWithBaggage(t.Context(), bag)
+			input := &sns.PublishInput{
+				TopicArn: utils.Ptr("arn:aws:sns:us-east-1:1234567890123:topic-1"),
+				Message:  utils.Ptr("msg"),
+			}
+			if _, err := client.Publish(ctx, input); err != nil {
+				t.Fatal(err)
+			}
+			if got := gotMsgAttrs["baggage"]; got.Value != "tenant=t-1" {
+				t.Errorf("baggage: got=%#v", got)
+			}
+			if _, ok := gotMsgAttrs["traceparent"]; !ok {
+				t.Error("traceparent is not injected")
+			}
+		})
+	}
+}
+
+func TestMiddleware_publish_error(t *testing.T) {
+	t.Parallel()
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = io.WriteString(w, `<ErrorResponse><Error><Type>Sender</Type><Code>NotFound</Code><Message>Topic does not exist</Message></Error><RequestId>req-1</RequestId></ErrorResponse>`)
+	}))
+	t.Cleanup(srv.Close)
+	cfg := aws.Config{
+		Region:           "us-east-1",
+		Credentials:      staticCredentials("id", "secret", "token"),
+		BaseEndpoint:     &srv.URL,
+		RetryMaxAttempts: 1,
+	}
+	pub.AppendMiddlewares(&cfg.APIOptions, pub.WithTracerProvider(tp), pub.WithPropagator(propagation.TraceContext{}))
+	client := sns.NewFromConfig(cfg)
+
+	input := &sns.PublishInput{
+		TopicArn: utils.Ptr("arn:aws:sns:us-east-1:1234567890123:topic-1"),
+		Message:  utils.Ptr("msg"),
+	}
+	if _, err := client.Publish(t.Context(), input); err == nil {
+		t.Fatal("expected an error but got nil")
+	}
+	if err := tp.ForceFlush(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	gotSpans := exporter.GetSpans()
+	if len(gotSpans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(gotSpans))
+	}
+	if got := gotSpans[0].Status.Code; got != codes.Error {
+		t.Errorf("status code: want=%s got=%s", codes.Error, got)
+	}
+	gotAttrs := attribute.NewSet(gotSpans[0].Attributes...)
+	if got, _ := gotAttrs.Value("error.type"); got.AsString() != "NotFound" {
+		t.Errorf("error.type: got=%q", got.AsString())
+	}
+}
+
+func traceparentOf(sc trace.SpanContext) string {
+	return fmt.Sprintf("00-%s-%s-%s", sc.TraceID(), sc.SpanID(), sc.TraceFlags())
+}
+
 func staticCredentials(keyID, secret, sessionToken string) *awsCredentials {
 	return &awsCredentials{Credentials: aws.Credentials{
 		AccessKeyID:     keyID,
@@ -254,7 +743,7 @@ func aggregateMessageAttributeValues(pairs iter.Seq2[string, []string]) map[stri
 			av := ret[name]
 			av.DataType = values[0]
 			ret[name] = av
-		case "Value.StringValue":
+		case "Value.StringValue", "Value.BinaryValue":
 			name, ok := idx2name[idx]
 			if !ok {
 				continue
@@ -0,0 +1,209 @@
+package pub
+
+import (
+	"github.com/aereal/otelpubsub/amazonsns/internal"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type config struct {
+	tracerProvider             trace.TracerProvider
+	meterProvider              metric.MeterProvider
+	propagator                 propagation.TextMapPropagator
+	budgetPolicy               AttributeBudgetPolicy
+	packedEncoding             PackedEncoding
+	existingTraceContextPolicy ExistingTraceContextPolicy
+	attributeProducers         []SNSPublishSpanAttributeProducer
+	bodyEnvelopeMode           BodyEnvelopeMode
+	preflightValidation        bool
+	destinationFilter          DestinationFilter
+	sampledOnly                bool
+	injectionPlacement         InjectionPlacement
+	platformInjectionModes     map[Platform]PlatformInjectionMode
+}
+
+func newConfig(opts []AppendMiddlewaresOption) *config {
+	cfg := &config{}
+	for _, o := range opts {
+		o.applyAppendMiddlewaresOption(cfg)
+	}
+	if cfg.tracerProvider == nil {
+		cfg.tracerProvider = otel.GetTracerProvider()
+	}
+	if cfg.meterProvider == nil {
+		cfg.meterProvider = otel.GetMeterProvider()
+	}
+	if cfg.propagator == nil {
+		cfg.propagator = internal.Propagator
+	}
+	return cfg
+}
+
+// AppendMiddlewaresOption configures [AppendMiddlewares] behavior.
+type AppendMiddlewaresOption interface {
+	applyAppendMiddlewaresOption(*config)
+}
+
+// WithTracerProvider specifies the [trace.TracerProvider] to use for creating spans.
+// If not specified, [otel.GetTracerProvider] is used.
+func WithTracerProvider(tp trace.TracerProvider) AppendMiddlewaresOption {
+	return &optionWithTracerProvider{tp: tp}
+}
+
+type optionWithTracerProvider struct{ tp trace.TracerProvider }
+
+func (o *optionWithTracerProvider) applyAppendMiddlewaresOption(c *config) { c.tracerProvider = o.tp }
+
+// WithMeterProvider specifies the [metric.MeterProvider] to use for creating instruments.
+// If not specified, [otel.GetMeterProvider] is used.
+func WithMeterProvider(mp metric.MeterProvider) AppendMiddlewaresOption {
+	return &optionWithMeterProvider{mp: mp}
+}
+
+type optionWithMeterProvider struct{ mp metric.MeterProvider }
+
+func (o *optionWithMeterProvider) applyAppendMiddlewaresOption(c *config) { c.meterProvider = o.mp }
+
+// WithPropagator specifies the [propagation.TextMapPropagator] to inject trace context into message attributes.
+// If not specified, [otel.GetTextMapPropagator] is used, or W3C Trace Context and Baggage while no global propagator is set.
+func WithPropagator(p propagation.TextMapPropagator) AppendMiddlewaresOption {
+	return &optionWithPropagator{p: p}
+}
+
+type optionWithPropagator struct{ p propagation.TextMapPropagator }
+
+func (o *optionWithPropagator) applyAppendMiddlewaresOption(c *config) { c.propagator = o.p }
+
+// WithAttributeBudgetPolicy specifies the [AttributeBudgetPolicy] applied when injecting trace context would exceed [MaxMessageAttributes].
+// If not specified, [AttributeBudgetPolicyDropOptional] is used.
+func WithAttributeBudgetPolicy(policy AttributeBudgetPolicy) AppendMiddlewaresOption {
+	return &optionWithAttributeBudgetPolicy{policy: policy}
+}
+
+type optionWithAttributeBudgetPolicy struct{ policy AttributeBudgetPolicy }
+
+func (o *optionWithAttributeBudgetPolicy) applyAppendMiddlewaresOption(c *config) {
+	c.budgetPolicy = o.policy
+}
+
+// WithPackedEncoding packs the whole propagation fields into the single message attribute named [PackedAttributeName]
+// instead of setting each field as its own attribute.
+// If the attribute does not fit into [MaxMessageAttributes], injection is skipped, or fails under [AttributeBudgetPolicyFail].
+// If not specified, [PackedEncodingNone] is used.
+func WithPackedEncoding(encoding PackedEncoding) AppendMiddlewaresOption {
+	return &optionWithPackedEncoding{encoding: encoding}
+}
+
+type optionWithPackedEncoding struct{ encoding PackedEncoding }
+
+func (o *optionWithPackedEncoding) applyAppendMiddlewaresOption(c *config) {
+	c.packedEncoding = o.encoding
+}
+
+// WithExistingTraceContextPolicy specifies the [ExistingTraceContextPolicy] applied when the message attributes already carry trace context.
+// If not specified, [ExistingTraceContextPolicyOverwrite] is used.
+func WithExistingTraceContextPolicy(policy ExistingTraceContextPolicy) AppendMiddlewaresOption {
+	return &optionWithExistingTraceContextPolicy{policy: policy}
+}
+
+type optionWithExistingTraceContextPolicy struct{ policy ExistingTraceContextPolicy }
+
+func (o *optionWithExistingTraceContextPolicy) applyAppendMiddlewaresOption(c *config) {
+	c.existingTraceContextPolicy = o.policy
+}
+
+// WithAttributeProducers specifies [SNSPublishSpanAttributeProducer]s to produce attributes set on the spans.
+func WithAttributeProducers(producers ...SNSPublishSpanAttributeProducer) AppendMiddlewaresOption {
+	return &optionWithAttributeProducers{producers: producers}
+}
+
+type optionWithAttributeProducers struct {
+	producers []SNSPublishSpanAttributeProducer
+}
+
+func (o *optionWithAttributeProducers) applyAppendMiddlewaresOption(c *config) {
+	c.attributeProducers = append(c.attributeProducers, o.producers...)
+}
+
+// WithBodyEnvelope injects the trace context into the message body according to the [BodyEnvelopeMode].
+// If not specified, [BodyEnvelopeModeNone] is used.
+func WithBodyEnvelope(mode BodyEnvelopeMode) AppendMiddlewaresOption {
+	return &optionWithBodyEnvelope{mode: mode}
+}
+
+type optionWithBodyEnvelope struct{ mode BodyEnvelopeMode }
+
+func (o *optionWithBodyEnvelope) applyAppendMiddlewaresOption(c *config) {
+	c.bodyEnvelopeMode = o.mode
+}
+
+// WithPreflightValidation checks the requests against the limits of Amazon SNS after the trace context is injected,
+// and fails the API call with [*ValidationError] before the request is signed.
+// It checks the payload size against [MaxPayloadSize], the message attribute names and the number of batch entries.
+func WithPreflightValidation() AppendMiddlewaresOption {
+	return &optionWithPreflightValidation{}
+}
+
+type optionWithPreflightValidation struct{}
+
+func (o *optionWithPreflightValidation) applyAppendMiddlewaresOption(c *config) {
+	c.preflightValidation = true
+}
+
+// WithDestinationFilter specifies the [DestinationFilter] that decides which topics or targets the trace context is injected for.
+// Messages to the others are published as is, though the spans are still started.
+func WithDestinationFilter(filter DestinationFilter) AppendMiddlewaresOption {
+	return &optionWithDestinationFilter{filter: filter}
+}
+
+type optionWithDestinationFilter struct{ filter DestinationFilter }
+
+func (o *optionWithDestinationFilter) applyAppendMiddlewaresOption(c *config) {
+	c.destinationFilter = o.filter
+}
+
+// WithSampledOnlyInjection injects the trace context only when the span is sampled.
+// Unsampled messages are published as is, saving the message attributes for high-volume unsampled traffic.
+func WithSampledOnlyInjection() AppendMiddlewaresOption {
+	return &optionWithSampledOnlyInjection{}
+}
+
+type optionWithSampledOnlyInjection struct{}
+
+func (o *optionWithSampledOnlyInjection) applyAppendMiddlewaresOption(c *config) {
+	c.sampledOnly = true
+}
+
+// WithInjectionPlacement specifies the [InjectionPlacement].
+// Use [InjectionPlacementSerialize] to link consumers to the client spans when the client is also instrumented with otelaws.
+// If not specified, [InjectionPlacementInitialize] is used.
+func WithInjectionPlacement(placement InjectionPlacement) AppendMiddlewaresOption {
+	return &optionWithInjectionPlacement{placement: placement}
+}
+
+type optionWithInjectionPlacement struct{ placement InjectionPlacement }
+
+func (o *optionWithInjectionPlacement) applyAppendMiddlewaresOption(c *config) {
+	c.injectionPlacement = o.placement
+}
+
+// WithPlatformInjection specifies the [PlatformInjectionMode] for the messages published directly to the [Platform].
+// It can be specified multiple times for different platforms.
+// If not specified for a platform, [PlatformInjectionModeSkip] is used.
+func WithPlatformInjection(platform Platform, mode PlatformInjectionMode) AppendMiddlewaresOption {
+	return &optionWithPlatformInjection{platform: platform, mode: mode}
+}
+
+type optionWithPlatformInjection struct {
+	platform Platform
+	mode     PlatformInjectionMode
+}
+
+func (o *optionWithPlatformInjection) applyAppendMiddlewaresOption(c *config) {
+	if c.platformInjectionModes == nil {
+		c.platformInjectionModes = map[Platform]PlatformInjectionMode{}
+	}
+	c.platformInjectionModes[o.platform] = o.mode
+}
@@ -0,0 +1,142 @@
+package pub_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aereal/otelpubsub/amazonsns/internal/utils"
+	"github.com/aereal/otelpubsub/amazonsns/pub"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"github.com/google/go-cmp/cmp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestMiddleware_existingTraceContextPolicy(t *testing.T) {
+	t.Parallel()
+
+	const (
+		originTraceparent = "00-abcdef121234567890abcdef12345678-1234567890abcdef-01"
+		relayTraceparent  = "00-0123456789abcdef0123456789abcdef-fedcba0987654321-01"
+	)
+	testCases := []struct {
+		name         string
+		policy       pub.ExistingTraceContextPolicy
+		attrs        map[string]types.MessageAttributeValue
+		wantAttrs    func(injected string) map[string]messageAttributeValue
+		wantDecision string
+	}{
+		{
+			name:   "overwrite",
+			policy: pub.ExistingTraceContextPolicyOverwrite,
+			attrs:  map[string]types.MessageAttributeValue{"traceparent": utils.StringAttributeValue(originTraceparent)},
+			wantAttrs: func(injected string) map[string]messageAttributeValue {
+				return map[string]messageAttributeValue{
+					"traceparent": {DataType: utils.DataTypeString, Value: injected},
+				}
+			},
+			wantDecision: "full",
+		},
+		{
+			name:   "preserve",
+			policy: pub.ExistingTraceContextPolicyPreserve,
+			attrs:  map[string]types.MessageAttributeValue{"traceparent": utils.StringAttributeValue(originTraceparent)},
+			wantAttrs: func(string) map[string]messageAttributeValue {
+				return map[string]messageAttributeValue{
+					"traceparent": {DataType: utils.DataTypeString, Value: originTraceparent},
+				}
+			},
+			wantDecision: "preserved",
+		},
+		{
+			name:   "preserve origin",
+			policy: pub.ExistingTraceContextPolicyPreserveOrigin,
+			attrs:  map[string]types.MessageAttributeValue{"traceparent": utils.StringAttributeValue(originTraceparent)},
+			wantAttrs: func(injected string) map[string]messageAttributeValue {
+				return map[string]messageAttributeValue{
+					"traceparent":             {DataType: utils.DataTypeString, Value: injected},
+					"otel.origin.traceparent": {DataType: utils.DataTypeString, Value: originTraceparent},
+				}
+			},
+			wantDecision: "full",
+		},
+		{
+			name:   "preserve origin through multiple relays",
+			policy: pub.ExistingTraceContextPolicyPreserveOrigin,
+			attrs: map[string]types.MessageAttributeValue{
+				"traceparent":             utils.StringAttributeValue(relayTraceparent),
+				"otel.origin.traceparent": utils.StringAttributeValue(originTraceparent),
+			},
+			wantAttrs: func(injected string) map[string]messageAttributeValue {
+				return map[string]messageAttributeValue{
+					"traceparent":             {DataType: utils.DataTypeString, Value: injected},
+					"otel.origin.traceparent": {DataType: utils.DataTypeString, Value: originTraceparent},
+				}
+			},
+			wantDecision: "full",
+		},
+		{
+			name:   "no existing trace context",
+			policy: pub.ExistingTraceContextPolicyPreserve,
+			wantAttrs: func(injected string) map[string]messageAttributeValue {
+				return map[string]messageAttributeValue{
+					"traceparent": {DataType: utils.DataTypeString, Value: injected},
+				}
+			},
+			wantDecision: "full",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var gotMsgAttrs map[string]messageAttributeValue
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if err := r.ParseForm(); err != nil {
+					t.Errorf("ParseForm: %s", err)
+					return
+				}
+				gotMsgAttrs = aggregateMessageAttributeValues(iterateSortedMapEntries(r.PostForm))
+			}))
+			t.Cleanup(srv.Close)
+			exporter := tracetest.NewInMemoryExporter()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+			cfg := aws.Config{
+				Region:       "us-east-1",
+				Credentials:  staticCredentials("id", "secret", "token"),
+				BaseEndpoint: &srv.URL,
+			}
+			pub.AppendMiddlewares(&cfg.APIOptions,
+				pub.WithTracerProvider(tp),
+				pub.WithPropagator(propagation.TraceContext{}),
+				pub.WithExistingTraceContextPolicy(tc.policy),
+			)
+			client := sns.NewFromConfig(cfg)
+
+			input := &sns.PublishInput{
+				TopicArn:          utils.Ptr("arn:aws:sns:us-east-1:1234567890123:topic-1"),
+				Message:           utils.Ptr("body"),
+				MessageAttributes: tc.attrs,
+			}
+			if _, err := client.Publish(t.Context(), input); err != nil {
+				t.Fatal(err)
+			}
+			spans := exporter.GetSpans()
+			if len(spans) != 1 {
+				t.Fatalf("got %d spans, want 1", len(spans))
+			}
+			if diff := cmp.Diff(tc.wantAttrs(traceparentOf(spans[0].SpanContext)), gotMsgAttrs); diff != "" {
+				t.Errorf("message attributes (-want, +got):\n%s", diff)
+			}
+			gotAttrs := attribute.NewSet(spans[0].Attributes...)
+			if got, _ := gotAttrs.Value("otelpubsub.injection.decision"); got.AsString() != tc.wantDecision {
+				t.Errorf("decision: want=%q got=%q", tc.wantDecision, got.AsString())
+			}
+		})
+	}
+}
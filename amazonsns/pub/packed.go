@@ -0,0 +1,34 @@
+package pub
+
+import (
+	"github.com/aereal/otelpubsub/amazonsns/internal/packed"
+	"github.com/aereal/otelpubsub/amazonsns/internal/utils"
+	"github.com/aws/aws-sdk-go-v2/service/sns/types"
+)
+
+// PackedAttributeName is the name of the message attribute that holds the packed propagation fields.
+const PackedAttributeName = packed.AttributeName
+
+// PackedEncoding specifies how the propagation fields are packed into the single message attribute named [PackedAttributeName].
+// The sub package decodes either encoding transparently.
+type PackedEncoding int
+
+const (
+	// PackedEncodingNone sets each propagation field as its own String message attribute.
+	PackedEncodingNone PackedEncoding = iota
+	// PackedEncodingJSON packs the fields into a String message attribute as a JSON object.
+	PackedEncodingJSON
+	// PackedEncodingBinary packs the fields into a Binary message attribute in a compact length-prefixed form.
+	PackedEncodingBinary
+)
+
+func (e PackedEncoding) attributeValue(fields map[string]string) (types.MessageAttributeValue, error) {
+	if e == PackedEncodingBinary {
+		return utils.BinaryAttributeValue(packed.MarshalBinary(fields)), nil
+	}
+	s, err := packed.MarshalJSON(fields)
+	if err != nil {
+		return types.MessageAttributeValue{}, err
+	}
+	return utils.StringAttributeValue(s), nil
+}
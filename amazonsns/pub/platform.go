@@ -0,0 +1,203 @@
+package pub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Platform identifies the destination of a message published directly to a phone number or a platform endpoint.
+// The values other than [PlatformSMS] are the platform names in the platform endpoint ARNs and the keys of the "json" MessageStructure.
+type Platform string
+
+const (
+	PlatformSMS             Platform = "SMS"
+	PlatformAPNS            Platform = "APNS"
+	PlatformAPNSSandbox     Platform = "APNS_SANDBOX"
+	PlatformAPNSVoIP        Platform = "APNS_VOIP"
+	PlatformAPNSVoIPSandbox Platform = "APNS_VOIP_SANDBOX"
+	PlatformMacOS           Platform = "MACOS"
+	PlatformMacOSSandbox    Platform = "MACOS_SANDBOX"
+	// PlatformGCM is Firebase Cloud Messaging, named GCM in Amazon SNS.
+	PlatformGCM   Platform = "GCM"
+	PlatformADM   Platform = "ADM"
+	PlatformBaidu Platform = "BAIDU"
+	PlatformWNS   Platform = "WNS"
+	PlatformMPNS  Platform = "MPNS"
+)
+
+// PlatformInjectionMode determines how the trace context is injected into messages published directly to a [Platform].
+//
+// Message attributes of such messages either have reserved meanings (AWS.SNS.SMS.* and AWS.SNS.MOBILE.*)
+// or are not delivered to the devices at all.
+type PlatformInjectionMode int
+
+const (
+	// PlatformInjectionModeSkip skips injection.
+	PlatformInjectionModeSkip PlatformInjectionMode = iota
+	// PlatformInjectionModeAttributes injects into the message attributes as for topics.
+	PlatformInjectionModeAttributes
+	// PlatformInjectionModePayload embeds the trace context into the custom data of the payload for the platform
+	// in a message with the "json" MessageStructure.
+	// For the APNS and MACOS platforms the propagation fields are set as an object named [BodyEnvelopeFieldName] at the top level of the payload;
+	// for [PlatformGCM] each field is set in the data of the payload, or of fcmV1Message.message.
+	// Injection is skipped for the other platforms or messages that have no payload for the platform.
+	PlatformInjectionModePayload
+)
+
+var attrKeyPlatform = attribute.Key("otelpubsub.platform")
+
+var errNotObject = errors.New("not a JSON object")
+
+// platformOf returns the platform the message is published to directly.
+// ok is false if the message is published to a topic.
+func platformOf(params *sns.PublishInput) (_ Platform, ok bool) {
+	if deref(params.PhoneNumber) != "" {
+		return PlatformSMS, true
+	}
+	parsed, err := arn.Parse(deref(params.TargetArn))
+	if err != nil {
+		return "", false
+	}
+	// the resource of a platform endpoint is endpoint/PLATFORM/application/id
+	kind, rest, _ := strings.Cut(parsed.Resource, "/")
+	platform, _, _ := strings.Cut(rest, "/")
+	if kind != "endpoint" || platform == "" {
+		return "", false
+	}
+	return Platform(platform), true
+}
+
+// injectPayload embeds the trace context into the payload for the platform in the message.
+// The returned decision is empty if the propagator has nothing to inject.
+func (i *instrumenter) injectPayload(ctx context.Context, platform Platform, params *sns.PublishInput) (injectionDecision, error) {
+	if deref(params.MessageStructure) != messageStructureJSON || params.Message == nil {
+		return injectionDecisionUnsupportedDestination, nil
+	}
+	fields := propagation.MapCarrier{}
+	i.propagator.Inject(ctx, fields)
+	if len(fields) == 0 {
+		return "", nil
+	}
+	var structure map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(*params.Message), &structure); err != nil {
+		return injectionDecisionUnsupportedDestination, nil //nolint:nilerr // the message is left for the API to reject
+	}
+	encodedPayload, ok := structure[string(platform)]
+	if !ok {
+		return injectionDecisionUnsupportedDestination, nil
+	}
+	var payload string
+	if err := json.Unmarshal(encodedPayload, &payload); err != nil {
+		return injectionDecisionUnsupportedDestination, nil //nolint:nilerr // the message is left for the API to reject
+	}
+	embedded, ok := embedIntoPayload(platform, payload, fields)
+	if !ok {
+		return injectionDecisionUnsupportedDestination, nil
+	}
+	var err error
+	if structure[string(platform)], err = json.Marshal(embedded); err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(structure)
+	if err != nil {
+		return "", err
+	}
+	message := string(b)
+	params.Message = &message
+	return injectionDecisionPayload, nil
+}
+
+// recordPlatformDecision records the decision for the message published directly to a platform on the span.
+// The skipped messages are also counted by the platform.
+func (i *instrumenter) recordPlatformDecision(ctx context.Context, span trace.Span, platform Platform, decision injectionDecision) {
+	if decision == "" {
+		return
+	}
+	span.SetAttributes(decision.attribute())
+	if decision == injectionDecisionUnsupportedDestination {
+		i.metrics.addPlatformInjectionSkipped(ctx, platform, decision)
+	}
+}
+
+// embedIntoPayload returns the payload for the platform with the fields set in its custom data.
+// ok is false if the platform is not supported or the payload is not a JSON object.
+func embedIntoPayload(platform Platform, payload string, fields map[string]string) (_ string, ok bool) {
+	var embedded json.RawMessage
+	var err error
+	switch platform {
+	case PlatformAPNS, PlatformAPNSSandbox, PlatformAPNSVoIP, PlatformAPNSVoIPSandbox, PlatformMacOS, PlatformMacOSSandbox:
+		embedded, err = updateObject(json.RawMessage(payload), func(object map[string]json.RawMessage) error {
+			encodedFields, marshalErr := json.Marshal(fields)
+			object[BodyEnvelopeFieldName] = encodedFields
+			return marshalErr
+		})
+	case PlatformGCM:
+		embedded, err = updateObject(json.RawMessage(payload), func(object map[string]json.RawMessage) error {
+			if _, ok := object["fcmV1Message"]; !ok {
+				return setDataFields(object, fields)
+			}
+			return updateField(object, "fcmV1Message", func(fcmV1Message map[string]json.RawMessage) error {
+				return updateField(fcmV1Message, "message", func(message map[string]json.RawMessage) error {
+					return setDataFields(message, fields)
+				})
+			})
+		})
+	default:
+		return "", false
+	}
+	if err != nil {
+		return "", false
+	}
+	return string(embedded), true
+}
+
+// setDataFields sets the fields as the string values of the data object of FCM.
+func setDataFields(object map[string]json.RawMessage, fields map[string]string) error {
+	return updateField(object, "data", func(data map[string]json.RawMessage) error {
+		for k, v := range fields {
+			encoded, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			data[k] = encoded
+		}
+		return nil
+	})
+}
+
+// updateField updates the object in the named field of the parent, creating it if missing.
+func updateField(parent map[string]json.RawMessage, name string, update func(map[string]json.RawMessage) error) error {
+	field, ok := parent[name]
+	if !ok {
+		field = json.RawMessage(`{}`)
+	}
+	updated, err := updateObject(field, update)
+	if err != nil {
+		return err
+	}
+	parent[name] = updated
+	return nil
+}
+
+// updateObject decodes the JSON object, updates it and encodes it again.
+func updateObject(raw json.RawMessage, update func(map[string]json.RawMessage) error) (json.RawMessage, error) {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &object); err != nil {
+		return nil, err
+	}
+	if object == nil {
+		return nil, errNotObject
+	}
+	if err := update(object); err != nil {
+		return nil, err
+	}
+	return json.Marshal(object)
+}
@@ -0,0 +1,209 @@
+package pub_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aereal/otelpubsub/amazonsns/internal/utils"
+	"github.com/aereal/otelpubsub/amazonsns/pub"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/google/go-cmp/cmp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestMiddleware_platformInjection(t *testing.T) {
+	t.Parallel()
+
+	const (
+		apnsEndpoint = "arn:aws:sns:us-east-1:1234567890123:endpoint/APNS/app-1/11111111-2222-3333-4444-555555555555"
+		gcmEndpoint  = "arn:aws:sns:us-east-1:1234567890123:endpoint/GCM/app-1/11111111-2222-3333-4444-555555555555"
+	)
+	testCases := []struct {
+		input           *sns.PublishInput
+		want            func(traceparent string) map[string]any
+		name            string
+		wantDecision    string
+		opts            []pub.AppendMiddlewaresOption
+		wantTraceparent bool
+	}{
+		{
+			name:         "sms/default",
+			input:        &sns.PublishInput{PhoneNumber: utils.Ptr("+15555550100"), Message: utils.Ptr("hello")},
+			wantDecision: "unsupported_destination",
+		},
+		{
+			name:            "sms/attributes",
+			opts:            []pub.AppendMiddlewaresOption{pub.WithPlatformInjection(pub.PlatformSMS, pub.PlatformInjectionModeAttributes)},
+			input:           &sns.PublishInput{PhoneNumber: utils.Ptr("+15555550100"), Message: utils.Ptr("hello")},
+			wantDecision:    "full",
+			wantTraceparent: true,
+		},
+		{
+			name:         "apns/default",
+			input:        &sns.PublishInput{TargetArn: utils.Ptr(apnsEndpoint), Message: utils.Ptr("hello")},
+			wantDecision: "unsupported_destination",
+		},
+		{
+			name: "apns/payload",
+			opts: []pub.AppendMiddlewaresOption{pub.WithPlatformInjection(pub.PlatformAPNS, pub.PlatformInjectionModePayload)},
+			input: &sns.PublishInput{
+				TargetArn:        utils.Ptr(apnsEndpoint),
+				MessageStructure: utils.Ptr("json"),
+				Message:          utils.Ptr(`{"default":"hello","APNS":"{\"aps\":{\"alert\":\"hello\",\"badge\":1}}"}`),
+			},
+			wantDecision: "payload",
+			want: func(traceparent string) map[string]any {
+				return map[string]any{
+					"default": "hello",
+					"APNS": map[string]any{
+						"aps":                    map[string]any{"alert": "hello", "badge": float64(1)},
+						"otelpubsub.propagation": map[string]any{"traceparent": traceparent},
+					},
+				}
+			},
+		},
+		{
+			name: "gcm/payload",
+			opts: []pub.AppendMiddlewaresOption{pub.WithPlatformInjection(pub.PlatformGCM, pub.PlatformInjectionModePayload)},
+			input: &sns.PublishInput{
+				TargetArn:        utils.Ptr(gcmEndpoint),
+				MessageStructure: utils.Ptr("json"),
+				Message:          utils.Ptr(`{"default":"hello","GCM":"{\"notification\":{\"title\":\"hello\"},\"data\":{\"k\":\"v\"}}"}`),
+			},
+			wantDecision: "payload",
+			want: func(traceparent string) map[string]any {
+				return map[string]any{
+					"default": "hello",
+					"GCM": map[string]any{
+						"notification": map[string]any{"title": "hello"},
+						"data":         map[string]any{"k": "v", "traceparent": traceparent},
+					},
+				}
+			},
+		},
+		{
+			name: "gcm/payload/fcmV1Message",
+			opts: []pub.AppendMiddlewaresOption{pub.WithPlatformInjection(pub.PlatformGCM, pub.PlatformInjectionModePayload)},
+			input: &sns.PublishInput{
+				TargetArn:        utils.Ptr(gcmEndpoint),
+				MessageStructure: utils.Ptr("json"),
+				Message:          utils.Ptr(`{"default":"hello","GCM":"{\"fcmV1Message\":{\"message\":{\"notification\":{\"title\":\"hello\"}}}}"}`),
+			},
+			wantDecision: "payload",
+			want: func(traceparent string) map[string]any {
+				return map[string]any{
+					"default": "hello",
+					"GCM": map[string]any{
+						"fcmV1Message": map[string]any{
+							"message": map[string]any{
+								"notification": map[string]any{"title": "hello"},
+								"data":         map[string]any{"traceparent": traceparent},
+							},
+						},
+					},
+				}
+			},
+		},
+		{
+			name:         "gcm/payload/not json structure",
+			opts:         []pub.AppendMiddlewaresOption{pub.WithPlatformInjection(pub.PlatformGCM, pub.PlatformInjectionModePayload)},
+			input:        &sns.PublishInput{TargetArn: utils.Ptr(gcmEndpoint), Message: utils.Ptr("hello")},
+			wantDecision: "unsupported_destination",
+		},
+		{
+			name: "gcm/payload/no payload for the platform",
+			opts: []pub.AppendMiddlewaresOption{pub.WithPlatformInjection(pub.PlatformGCM, pub.PlatformInjectionModePayload)},
+			input: &sns.PublishInput{
+				TargetArn:        utils.Ptr(gcmEndpoint),
+				MessageStructure: utils.Ptr("json"),
+				Message:          utils.Ptr(`{"default":"hello"}`),
+			},
+			wantDecision: "unsupported_destination",
+		},
+		{
+			name:            "topic",
+			opts:            []pub.AppendMiddlewaresOption{pub.WithPlatformInjection(pub.PlatformSMS, pub.PlatformInjectionModeSkip)},
+			input:           &sns.PublishInput{TopicArn: utils.Ptr("arn:aws:sns:us-east-1:1234567890123:topic-1"), Message: utils.Ptr("hello")},
+			wantDecision:    "full",
+			wantTraceparent: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var gotMessage string
+			var gotTraceparent bool
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if err := r.ParseForm(); err != nil {
+					t.Errorf("ParseForm: %s", err)
+					return
+				}
+				gotMessage = r.PostForm.Get("Message")
+				_, gotTraceparent = aggregateMessageAttributeValues(iterateSortedMapEntries(r.PostForm))["traceparent"]
+			}))
+			t.Cleanup(srv.Close)
+			exporter := tracetest.NewInMemoryExporter()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+			cfg := aws.Config{
+				Region:       "us-east-1",
+				Credentials:  staticCredentials("id", "secret", "token"),
+				BaseEndpoint: &srv.URL,
+			}
+			opts := append([]pub.AppendMiddlewaresOption{pub.WithTracerProvider(tp), pub.WithPropagator(propagation.TraceContext{})}, tc.opts...)
+			pub.AppendMiddlewares(&cfg.APIOptions, opts...)
+			client := sns.NewFromConfig(cfg)
+
+			originalMessage := *tc.input.Message
+			if _, err := client.Publish(t.Context(), tc.input); err != nil {
+				t.Fatal(err)
+			}
+			spans := exporter.GetSpans()
+			if len(spans) != 1 {
+				t.Fatalf("got %d spans, want 1", len(spans))
+			}
+			gotAttrs := attribute.NewSet(spans[0].Attributes...)
+			gotDecision, _ := gotAttrs.Value("otelpubsub.injection.decision")
+			if gotDecision.AsString() != tc.wantDecision {
+				t.Errorf("decision: want=%q got=%q", tc.wantDecision, gotDecision.AsString())
+			}
+			if gotTraceparent != tc.wantTraceparent {
+				t.Errorf("traceparent presence: want=%v got=%v", tc.wantTraceparent, gotTraceparent)
+			}
+			if tc.want == nil {
+				if gotMessage != originalMessage {
+					t.Errorf("message: want=%q got=%q", originalMessage, gotMessage)
+				}
+				return
+			}
+			if diff := cmp.Diff(tc.want(traceparentOf(spans[0].SpanContext)), decodePlatformMessage(t, gotMessage)); diff != "" {
+				t.Errorf("message (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// decodePlatformMessage decodes the message with the "json" MessageStructure, decoding the payload for each protocol as well.
+func decodePlatformMessage(t *testing.T, message string) map[string]any {
+	t.Helper()
+	var structure map[string]string
+	if err := json.Unmarshal([]byte(message), &structure); err != nil {
+		t.Fatalf("failed to decode message: %s", err)
+	}
+	decoded := make(map[string]any, len(structure))
+	for protocol, payload := range structure {
+		var v any
+		if err := json.Unmarshal([]byte(payload), &v); err != nil {
+			decoded[protocol] = payload
+			continue
+		}
+		decoded[protocol] = v
+	}
+	return decoded
+}
@@ -0,0 +1,16 @@
+package semconv
+
+import "go.opentelemetry.io/otel/attribute"
+
+var (
+	AttrKeyAWSSNSMessageGroupID         = attribute.Key("aws.sns.message.group_id")
+	AttrKeyAWSSNSMessageDeduplicationID = attribute.Key("aws.sns.message.deduplication_id")
+)
+
+func AttrAWSSNSMessageGroupID(id string) attribute.KeyValue {
+	return AttrKeyAWSSNSMessageGroupID.String(id)
+}
+
+func AttrAWSSNSMessageDeduplicationID(id string) attribute.KeyValue {
+	return AttrKeyAWSSNSMessageDeduplicationID.String(id)
+}
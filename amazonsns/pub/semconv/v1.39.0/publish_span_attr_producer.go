@@ -0,0 +1,106 @@
+package semconv
+
+import (
+	"iter"
+
+	"github.com/aereal/otelpubsub/amazonsns/internal/utils"
+	"github.com/aereal/otelpubsub/amazonsns/pub"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.39.0"
+)
+
+type PublishSpanAttributeProducer struct{}
+
+var _ pub.SNSPublishSpanAttributeProducer = PublishSpanAttributeProducer{}
+
+func (p PublishSpanAttributeProducer) ProduceSNSPublishSpanAttributes(input *sns.PublishInput, output *sns.PublishOutput) iter.Seq[attribute.KeyValue] {
+	return func(yield func(attribute.KeyValue) bool) {
+		if input == nil {
+			return
+		}
+
+		for kv := range p.destinationAttrs(input.TopicArn, input.TargetArn) {
+			if !yield(kv) {
+				return
+			}
+		}
+		for kv := range p.messageAttrs(input.Message, input.MessageGroupId, input.MessageDeduplicationId) {
+			if !yield(kv) {
+				return
+			}
+		}
+		if output != nil && output.MessageId != nil {
+			if !yield(semconv.MessagingMessageID(*output.MessageId)) {
+				return
+			}
+		}
+	}
+}
+
+func (p PublishSpanAttributeProducer) ProduceSNSPublishBatchEntrySpanAttributes(input *sns.PublishBatchInput, entry *types.PublishBatchRequestEntry, result *types.PublishBatchResultEntry) iter.Seq[attribute.KeyValue] {
+	return func(yield func(attribute.KeyValue) bool) {
+		if input == nil || entry == nil {
+			return
+		}
+
+		for kv := range p.destinationAttrs(input.TopicArn, nil) {
+			if !yield(kv) {
+				return
+			}
+		}
+		for kv := range p.messageAttrs(entry.Message, entry.MessageGroupId, entry.MessageDeduplicationId) {
+			if !yield(kv) {
+				return
+			}
+		}
+		if result != nil && result.MessageId != nil {
+			if !yield(semconv.MessagingMessageID(*result.MessageId)) {
+				return
+			}
+		}
+	}
+}
+
+func (PublishSpanAttributeProducer) destinationAttrs(topicARN, targetARN *string) iter.Seq[attribute.KeyValue] {
+	return func(yield func(attribute.KeyValue) bool) {
+		var topic, target string
+		if topicARN != nil {
+			topic = *topicARN
+		}
+		if targetARN != nil {
+			target = *targetARN
+		}
+		if topic != "" {
+			if !yield(semconv.AWSSNSTopicARN(topic)) {
+				return
+			}
+		}
+		if destinationName := utils.DestinationNameOf(topic, target); destinationName != "" {
+			if !yield(semconv.MessagingDestinationName(destinationName)) {
+				return
+			}
+		}
+	}
+}
+
+func (PublishSpanAttributeProducer) messageAttrs(body, groupID, deduplicationID *string) iter.Seq[attribute.KeyValue] {
+	return func(yield func(attribute.KeyValue) bool) {
+		if body != nil {
+			if !yield(semconv.MessagingMessageBodySize(len(*body))) {
+				return
+			}
+		}
+		if groupID != nil {
+			if !yield(AttrAWSSNSMessageGroupID(*groupID)) {
+				return
+			}
+		}
+		if deduplicationID != nil {
+			if !yield(AttrAWSSNSMessageDeduplicationID(*deduplicationID)) {
+				return
+			}
+		}
+	}
+}
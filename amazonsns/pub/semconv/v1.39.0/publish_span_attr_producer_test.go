@@ -0,0 +1,120 @@
+package semconv_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/aereal/otelpubsub/amazonsns/internal/utils"
+	semconv "github.com/aereal/otelpubsub/amazonsns/pub/semconv/v1.39.0"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"github.com/google/go-cmp/cmp"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func TestPublishSpanAttributeProducer_ProduceSNSPublishSpanAttributes(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name   string
+		input  *sns.PublishInput
+		output *sns.PublishOutput
+		want   []attribute.KeyValue
+	}{
+		{
+			name: "topic",
+			input: &sns.PublishInput{
+				TopicArn:               utils.Ptr("arn:aws:sns:ap-northeast-1:123456789012:topic-01.fifo"),
+				Message:                utils.Ptr(`{"ok":true}`),
+				MessageGroupId:         utils.Ptr("group-1"),
+				MessageDeduplicationId: utils.Ptr("dedup-1"),
+			},
+			output: &sns.PublishOutput{MessageId: utils.Ptr("msg-001")},
+			want: []attribute.KeyValue{
+				attribute.String("aws.sns.topic.arn", "arn:aws:sns:ap-northeast-1:123456789012:topic-01.fifo"),
+				attribute.String("messaging.destination.name", "topic-01.fifo"),
+				attribute.Int("messaging.message.body.size", 11),
+				attribute.String("aws.sns.message.group_id", "group-1"),
+				attribute.String("aws.sns.message.deduplication_id", "dedup-1"),
+				attribute.String("messaging.message.id", "msg-001"),
+			},
+		},
+		{
+			name: "target",
+			input: &sns.PublishInput{
+				TargetArn: utils.Ptr("arn:aws:sns:ap-northeast-1:123456789012:endpoint/GCM/app-01/0123"),
+				Message:   utils.Ptr(`{"ok":true}`),
+			},
+			want: []attribute.KeyValue{
+				attribute.String("messaging.destination.name", "endpoint/GCM/app-01/0123"),
+				attribute.Int("messaging.message.body.size", 11),
+			},
+		},
+		{
+			name:  "nil input",
+			input: nil,
+			want:  nil,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			want := attribute.NewSet(tc.want...)
+			got := attribute.NewSet(slices.Collect(semconv.PublishSpanAttributeProducer{}.ProduceSNSPublishSpanAttributes(tc.input, tc.output))...)
+			if diff := cmp.Diff(want, got, cmp.Comparer(func(a, b attribute.Set) bool { return a.Equals(&b) })); diff != "" {
+				t.Errorf("attributes (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestPublishSpanAttributeProducer_ProduceSNSPublishBatchEntrySpanAttributes(t *testing.T) {
+	t.Parallel()
+
+	input := &sns.PublishBatchInput{
+		TopicArn: utils.Ptr("arn:aws:sns:ap-northeast-1:123456789012:topic-01.fifo"),
+	}
+	entry := &types.PublishBatchRequestEntry{
+		Id:             utils.Ptr("1"),
+		Message:        utils.Ptr(`{"ok":true}`),
+		MessageGroupId: utils.Ptr("group-1"),
+	}
+	testCases := []struct {
+		name   string
+		result *types.PublishBatchResultEntry
+		want   []attribute.KeyValue
+	}{
+		{
+			name:   "succeeded",
+			result: &types.PublishBatchResultEntry{Id: utils.Ptr("1"), MessageId: utils.Ptr("msg-001")},
+			want: []attribute.KeyValue{
+				attribute.String("aws.sns.topic.arn", "arn:aws:sns:ap-northeast-1:123456789012:topic-01.fifo"),
+				attribute.String("messaging.destination.name", "topic-01.fifo"),
+				attribute.Int("messaging.message.body.size", 11),
+				attribute.String("aws.sns.message.group_id", "group-1"),
+				attribute.String("messaging.message.id", "msg-001"),
+			},
+		},
+		{
+			name: "failed",
+			want: []attribute.KeyValue{
+				attribute.String("aws.sns.topic.arn", "arn:aws:sns:ap-northeast-1:123456789012:topic-01.fifo"),
+				attribute.String("messaging.destination.name", "topic-01.fifo"),
+				attribute.Int("messaging.message.body.size", 11),
+				attribute.String("aws.sns.message.group_id", "group-1"),
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			want := attribute.NewSet(tc.want...)
+			got := attribute.NewSet(slices.Collect(semconv.PublishSpanAttributeProducer{}.ProduceSNSPublishBatchEntrySpanAttributes(input, entry, tc.result))...)
+			if diff := cmp.Diff(want, got, cmp.Comparer(func(a, b attribute.Set) bool { return a.Equals(&b) })); diff != "" {
+				t.Errorf("attributes (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
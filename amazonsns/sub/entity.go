@@ -1,10 +1,16 @@
 package sub
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"log/slog"
 	"sort"
+	"strings"
 	"time"
 
+	"github.com/aereal/otelpubsub/amazonsns/internal/envelope"
+	"github.com/aereal/otelpubsub/amazonsns/internal/origin"
+	"github.com/aereal/otelpubsub/amazonsns/internal/packed"
 	"go.opentelemetry.io/otel/propagation"
 )
 
@@ -26,6 +32,8 @@ type Entity struct {
 }
 
 // MessageAttributes is a map of attribute names to values, implementing [propagation.TextMapCarrier].
+// The carrier reads both the fields set as individual String attributes and the fields packed into a single attribute by the pub package;
+// individual attributes take precedence.
 type MessageAttributes map[string]AttributeValue
 
 var (
@@ -48,15 +56,15 @@ func (ma *MessageAttributes) UnmarshalJSON(b []byte) error {
 }
 
 func (ma MessageAttributes) Get(key string) string {
-	av, ok := ma[key]
-	if !ok {
+	if key == packed.AttributeName {
 		return ""
 	}
-	sv, ok := av.StringValue()
-	if !ok {
-		return ""
+	if av, ok := ma[key]; ok {
+		if sv, ok := av.StringValue(); ok {
+			return sv
+		}
 	}
-	return sv
+	return ma.packedFields()[key]
 }
 
 func (ma MessageAttributes) Set(key, value string) {
@@ -65,7 +73,15 @@ func (ma MessageAttributes) Set(key, value string) {
 
 func (ma MessageAttributes) Keys() []string {
 	ret := make([]string, 0, len(ma))
+	for k := range ma.packedFields() {
+		if _, ok := ma[k]; !ok {
+			ret = append(ret, k)
+		}
+	}
 	for k, v := range ma {
+		if k == packed.AttributeName {
+			continue
+		}
 		if v.Type() != AttributeTypeString {
 			continue
 		}
@@ -74,3 +90,66 @@ func (ma MessageAttributes) Keys() []string {
 	sort.Strings(ret)
 	return ret
 }
+
+// packedFields decodes the fields packed into the attribute named [packed.AttributeName].
+func (ma MessageAttributes) packedFields() map[string]string {
+	av, ok := ma[packed.AttributeName]
+	if !ok {
+		return nil
+	}
+	if sv, ok := av.StringValue(); ok {
+		fields, err := packed.UnmarshalJSON(sv)
+		if err != nil {
+			slog.Warn("failed to decode packed propagation fields", slog.String("error", err.Error()))
+			return nil
+		}
+		return fields
+	}
+	if encoded, ok := av.Base64EncodedBinaryValue(); ok {
+		raw, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(encoded, "="))
+		if err != nil {
+			slog.Warn("failed to decode packed propagation fields", slog.String("error", err.Error()))
+			return nil
+		}
+		fields, err := packed.UnmarshalBinary(raw)
+		if err != nil {
+			slog.Warn("failed to decode packed propagation fields", slog.String("error", err.Error()))
+			return nil
+		}
+		return fields
+	}
+	return nil
+}
+
+// originAttributes returns the attributes that keep the originator's trace context,
+// set by the pub package when a relay republishes the message, with [origin.AttributePrefix] stripped from the names.
+func (ma MessageAttributes) originAttributes() MessageAttributes {
+	var ret MessageAttributes
+	for k, v := range ma {
+		name, ok := strings.CutPrefix(k, origin.AttributePrefix)
+		if !ok {
+			continue
+		}
+		if ret == nil {
+			ret = MessageAttributes{}
+		}
+		ret[name] = v
+	}
+	return ret
+}
+
+// UnwrappedMessage returns the message as a string.
+// If the pub package wrapped the message into an envelope to carry the trace context, the original message is returned.
+func (e *Entity) UnwrappedMessage() string {
+	_, original, _ := envelope.Unwrap(e.messageString())
+	return original
+}
+
+// messageString returns the message decoded from a JSON string, or the raw message if it is not a JSON string.
+func (e *Entity) messageString() string {
+	var s string
+	if err := json.Unmarshal(e.Message, &s); err != nil {
+		return string(e.Message)
+	}
+	return s
+}
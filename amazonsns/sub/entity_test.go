@@ -9,6 +9,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/aereal/otelpubsub/amazonsns/internal/packed"
 	"github.com/aereal/otelpubsub/amazonsns/sub"
 	"github.com/google/go-cmp/cmp"
 )
@@ -119,6 +120,68 @@ func TestMessageAttributes_carrier(t *testing.T) {
 	}
 }
 
+func TestMessageAttributes_packed(t *testing.T) {
+	t.Parallel()
+
+	fields := map[string]string{
+		"traceparent": "00-abcdef121234567890abcdef12345678-1234567890abcdef-01",
+		"tracestate":  "vendor=value",
+	}
+	packedJSON, err := packed.MarshalJSON(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		attrs    sub.MessageAttributes
+		name     string
+		wantKeys []string
+		wantTS   string
+	}{
+		{
+			name:     "JSON",
+			attrs:    sub.MessageAttributes{packed.AttributeName: sub.StringAttributeValue(packedJSON)},
+			wantKeys: []string{"traceparent", "tracestate"},
+			wantTS:   "vendor=value",
+		},
+		{
+			name:     "binary",
+			attrs:    sub.MessageAttributes{packed.AttributeName: sub.BinaryAttributeValue(packed.MarshalBinary(fields))},
+			wantKeys: []string{"traceparent", "tracestate"},
+			wantTS:   "vendor=value",
+		},
+		{
+			name: "individual attribute takes precedence",
+			attrs: sub.MessageAttributes{
+				packed.AttributeName: sub.StringAttributeValue(packedJSON),
+				"tracestate":         sub.StringAttributeValue("other=value"),
+			},
+			wantKeys: []string{"traceparent", "tracestate"},
+			wantTS:   "other=value",
+		},
+		{
+			name:     "corrupted",
+			attrs:    sub.MessageAttributes{packed.AttributeName: sub.StringAttributeValue("{")},
+			wantKeys: []string{},
+			wantTS:   "",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := tc.attrs.Get("tracestate"); got != tc.wantTS {
+				t.Errorf("Get(tracestate): want=%q got=%q", tc.wantTS, got)
+			}
+			if got := tc.attrs.Get(packed.AttributeName); got != "" {
+				t.Errorf("Get(%s): got=%q", packed.AttributeName, got)
+			}
+			if diff := cmp.Diff(tc.wantKeys, tc.attrs.Keys()); diff != "" {
+				t.Errorf("Keys() (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
 var transformJSONMessage = cmp.Transformer("JSON", func(v json.RawMessage) map[string]any {
 	var m map[string]any
 	_ = json.Unmarshal(v, &m) //nolint:errcheck
@@ -131,3 +194,27 @@ func diffJSONMessage(want, got json.RawMessage) error {
 	}
 	return nil
 }
+
+func TestEntity_UnwrappedMessage(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name    string
+		message json.RawMessage
+		want    string
+	}{
+		{name: "wrapped", message: json.RawMessage(`"{\"otelpubsub.envelope\":1,\"otelpubsub.body\":\"hello\",\"otelpubsub.propagation\":{\"traceparent\":\"00-0123456789abcdef0123456789abcdef-1234567890abcdef-01\"}}"`), want: "hello"},
+		{name: "augmented", message: json.RawMessage(`"{\"id\":1,\"otelpubsub.propagation\":{}}"`), want: `{"id":1,"otelpubsub.propagation":{}}`},
+		{name: "plain", message: json.RawMessage(`"hello"`), want: "hello"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			entity := &sub.Entity{Message: tc.message}
+			if got := entity.UnwrappedMessage(); got != tc.want {
+				t.Errorf("want=%q got=%q", tc.want, got)
+			}
+		})
+	}
+}
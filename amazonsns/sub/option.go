@@ -2,6 +2,7 @@ package sub
 
 import (
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/trace"
 )
 
@@ -9,6 +10,7 @@ var _ = otel.GetTracerProvider
 
 type config struct {
 	tracerProvider     trace.TracerProvider
+	propagator         propagation.TextMapPropagator
 	startSpanOptions   []trace.SpanStartOption
 	attributeProducers []SNSProcessSpanAttributeProducer
 }
@@ -28,6 +30,16 @@ type optionWithTracerProvider struct{ tp trace.TracerProvider }
 
 func (o *optionWithTracerProvider) applyStartProcessSpanOption(c *config) { c.tracerProvider = o.tp }
 
+// WithPropagator specifies the [propagation.TextMapPropagator] to extract trace context and baggage from message attributes.
+// If not specified, [otel.GetTextMapPropagator] is used, or W3C Trace Context and Baggage while no global propagator is set.
+func WithPropagator(p propagation.TextMapPropagator) StartProcessSpanOption {
+	return &optionWithPropagator{p: p}
+}
+
+type optionWithPropagator struct{ p propagation.TextMapPropagator }
+
+func (o *optionWithPropagator) applyStartProcessSpanOption(c *config) { c.propagator = o.p }
+
 // WithStartSpanOptions appends additional [trace.SpanStartOption] to the span creation.
 func WithStartSpanOptions(opts ...trace.SpanStartOption) StartProcessSpanOption {
 	return &optionWithStartSpanOptions{opts: opts}
@@ -4,9 +4,12 @@ import (
 	"context"
 
 	"github.com/aereal/otelpubsub/amazonsns/internal"
+	"github.com/aereal/otelpubsub/amazonsns/internal/envelope"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
 	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/trace"
 )
 
@@ -52,6 +55,9 @@ func WrapYielder[V any](f Yielder[V], opts ...StartProcessSpanOption) Yielder[V]
 
 // StartProcessSpan starts a new span for processing an SNS message.
 // If the entity contains trace context in its message attributes, the span is linked to the original trace.
+// If not, the span is linked to the trace context in the envelope the pub package injected into the message, if any.
+// If a relay republished the message keeping the originator's trace context, the span is also linked to the originator.
+// Baggage extracted from the message attributes or the envelope is put into the returned context.
 // The caller is responsible for calling End on the returned span.
 func StartProcessSpan(ctx context.Context, entity *Entity, opts ...StartProcessSpanOption) (context.Context, trace.Span) {
 	var cfg config
@@ -61,12 +67,27 @@ func StartProcessSpan(ctx context.Context, entity *Entity, opts ...StartProcessS
 	if cfg.tracerProvider == nil {
 		cfg.tracerProvider = otel.GetTracerProvider()
 	}
+	if cfg.propagator == nil {
+		cfg.propagator = internal.Propagator
+	}
 	if entity != nil {
-		remoteCtx := internal.Propagator.Extract(ctx, entity.MessageAttributes)
+		// Extract into an empty context so that the active span of ctx is not taken as the producer's.
+		remoteCtx := cfg.propagator.Extract(context.Background(), entity.MessageAttributes)
+		if !trace.SpanContextFromContext(remoteCtx).IsValid() {
+			if fields, _, ok := envelope.Unwrap(entity.messageString()); ok {
+				remoteCtx = cfg.propagator.Extract(remoteCtx, propagation.MapCarrier(fields))
+			}
+		}
 		link := trace.LinkFromContext(remoteCtx)
 		if link.SpanContext.IsValid() {
 			cfg.startSpanOptions = append(cfg.startSpanOptions, trace.WithLinks(link))
 		}
+		if originSC := trace.SpanContextFromContext(cfg.propagator.Extract(context.Background(), entity.MessageAttributes.originAttributes())); originSC.IsValid() && !originSC.Equal(link.SpanContext) {
+			cfg.startSpanOptions = append(cfg.startSpanOptions, trace.WithLinks(trace.Link{SpanContext: originSC}))
+		}
+		if bag := baggage.FromContext(remoteCtx); bag.Len() > 0 {
+			ctx = baggage.ContextWithBaggage(ctx, bag)
+		}
 	}
 	ctx, span := cfg.tracerProvider.Tracer("github.com/aereal/otelpubsub/amazonsns/sub").Start(ctx, "process", cfg.startSpanOptions...)
 	if entity != nil {
@@ -2,6 +2,7 @@ package sub_test
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"iter"
 	"testing"
@@ -10,6 +11,8 @@ import (
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/sdk/instrumentation"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
@@ -102,7 +105,7 @@ func testWrapper(t *testing.T, wrap func(o ...sub.StartProcessSpanOption) func(c
 			"traceparent": sub.StringAttributeValue(fmt.Sprintf("00-%s-%s-01", wantTraceIDHex, wantSpanIDHex)),
 		},
 	}
-	if err := wrap(sub.WithTracerProvider(tp), sub.WithStartSpanOptions(trace.WithSpanKind(trace.SpanKindClient)))(t.Context(), entity); err != nil {
+	if err := wrap(sub.WithTracerProvider(tp), sub.WithPropagator(propagation.TraceContext{}), sub.WithStartSpanOptions(trace.WithSpanKind(trace.SpanKindClient)))(t.Context(), entity); err != nil {
 		t.Fatal(err)
 	}
 	if err := tp.ForceFlush(t.Context()); err != nil {
@@ -147,6 +150,119 @@ func TestStartProcessSpan_WithAttributeProducers(t *testing.T) {
 	}
 }
 
+func TestStartProcessSpan_WithPropagator(t *testing.T) {
+	t.Parallel()
+
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(tracetest.NewInMemoryExporter()))
+	entity := &sub.Entity{
+		MessageAttributes: sub.MessageAttributes{
+			"traceparent": sub.StringAttributeValue("00-abcdef121234567890abcdef12345678-1234567890abcdef-01"),
+			"baggage":     sub.StringAttributeValue("tenant=t-1"),
+		},
+	}
+	propagator := propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+	ctx, span := sub.StartProcessSpan(t.Context(), entity, sub.WithTracerProvider(tp), sub.WithPropagator(propagator))
+	span.End()
+
+	if got := baggage.FromContext(ctx).Member("tenant").Value(); got != "t-1" {
+		t.Errorf("baggage member: want=%q got=%q", "t-1", got)
+	}
+	if got := trace.SpanContextFromContext(ctx).TraceID().String(); got == "abcdef121234567890abcdef12345678" {
+		t.Errorf("the process span must not be a child of the remote span: trace ID=%s", got)
+	}
+}
+
+func TestStartProcessSpan_originLink(t *testing.T) {
+	t.Parallel()
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	entity := &sub.Entity{
+		MessageAttributes: sub.MessageAttributes{
+			"traceparent":             sub.StringAttributeValue("00-0123456789abcdef0123456789abcdef-fedcba0987654321-01"),
+			"otel.origin.traceparent": sub.StringAttributeValue("00-abcdef121234567890abcdef12345678-1234567890abcdef-01"),
+		},
+	}
+	_, span := sub.StartProcessSpan(t.Context(), entity, sub.WithTracerProvider(tp), sub.WithPropagator(propagation.TraceContext{}))
+	span.End()
+
+	gotSpans := exporter.GetSpans()
+	if len(gotSpans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(gotSpans))
+	}
+	var gotTraceIDs []string
+	for _, link := range gotSpans[0].Links {
+		gotTraceIDs = append(gotTraceIDs, link.SpanContext.TraceID().String())
+	}
+	wantTraceIDs := []string{"0123456789abcdef0123456789abcdef", "abcdef121234567890abcdef12345678"}
+	if diff := cmp.Diff(wantTraceIDs, gotTraceIDs); diff != "" {
+		t.Errorf("linked trace IDs (-want, +got):\n%s", diff)
+	}
+}
+
+func TestStartProcessSpan_bodyEnvelope(t *testing.T) {
+	t.Parallel()
+
+	envelopedMessage := json.RawMessage(`"{\"otelpubsub.envelope\":1,\"otelpubsub.body\":\"hello\",\"otelpubsub.propagation\":{\"traceparent\":\"00-0123456789abcdef0123456789abcdef-fedcba0987654321-01\",\"baggage\":\"tenant=t-1\"}}"`)
+	testCases := []struct {
+		entity      *sub.Entity
+		name        string
+		wantTraceID string
+		wantBaggage string
+	}{
+		{
+			name:        "fallback to envelope",
+			entity:      &sub.Entity{Message: envelopedMessage},
+			wantTraceID: "0123456789abcdef0123456789abcdef",
+			wantBaggage: "t-1",
+		},
+		{
+			name: "message attributes take precedence",
+			entity: &sub.Entity{
+				MessageAttributes: sub.MessageAttributes{
+					"traceparent": sub.StringAttributeValue("00-abcdef121234567890abcdef12345678-1234567890abcdef-01"),
+				},
+				Message: envelopedMessage,
+			},
+			wantTraceID: "abcdef121234567890abcdef12345678",
+		},
+		{
+			name:   "no envelope",
+			entity: &sub.Entity{Message: json.RawMessage(`"hello"`)},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			exporter := tracetest.NewInMemoryExporter()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+			propagator := propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+			ctx, span := sub.StartProcessSpan(t.Context(), tc.entity, sub.WithTracerProvider(tp), sub.WithPropagator(propagator))
+			span.End()
+
+			gotSpans := exporter.GetSpans()
+			if len(gotSpans) != 1 {
+				t.Fatalf("got %d spans, want 1", len(gotSpans))
+			}
+			var gotTraceIDs []string
+			for _, link := range gotSpans[0].Links {
+				gotTraceIDs = append(gotTraceIDs, link.SpanContext.TraceID().String())
+			}
+			var wantTraceIDs []string
+			if tc.wantTraceID != "" {
+				wantTraceIDs = []string{tc.wantTraceID}
+			}
+			if diff := cmp.Diff(wantTraceIDs, gotTraceIDs); diff != "" {
+				t.Errorf("linked trace IDs (-want, +got):\n%s", diff)
+			}
+			if got := baggage.FromContext(ctx).Member("tenant").Value(); got != tc.wantBaggage {
+				t.Errorf("baggage member: want=%q got=%q", tc.wantBaggage, got)
+			}
+		})
+	}
+}
+
 func processorFunc(ctx context.Context, entity *sub.Entity) error { return nil }
 
 func yielderFunc(ctx context.Context, entity *sub.Entity) (bool, error) { return true, nil }
@@ -173,3 +289,55 @@ func diffSpans(want, got []tracetest.SpanStub) string {
 		}),
 	)
 }
+
+func TestStartProcessSpan_bodyEnvelope_activeParentSpan(t *testing.T) {
+	t.Parallel()
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	ctx, parent := tp.Tracer("test").Start(t.Context(), "handler")
+	defer parent.End()
+	entity := &sub.Entity{Message: json.RawMessage(`"{\"otelpubsub.envelope\":1,\"otelpubsub.body\":\"hello\",\"otelpubsub.propagation\":{\"traceparent\":\"00-0123456789abcdef0123456789abcdef-fedcba0987654321-01\"}}"`)}
+	_, span := sub.StartProcessSpan(ctx, entity, sub.WithTracerProvider(tp), sub.WithPropagator(propagation.TraceContext{}))
+	span.End()
+
+	gotSpans := exporter.GetSpans()
+	if len(gotSpans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(gotSpans))
+	}
+	got := gotSpans[0]
+	if got.Parent.SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("parent: got %s, want %s", got.Parent.SpanID(), parent.SpanContext().SpanID())
+	}
+	var gotLinks []string
+	for _, link := range got.Links {
+		gotLinks = append(gotLinks, link.SpanContext.TraceID().String()+"/"+link.SpanContext.SpanID().String())
+	}
+	if diff := cmp.Diff([]string{"0123456789abcdef0123456789abcdef/fedcba0987654321"}, gotLinks); diff != "" {
+		t.Errorf("links (-want, +got):\n%s", diff)
+	}
+}
+
+func TestStartProcessSpan_defaultPropagator(t *testing.T) {
+	t.Parallel()
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	msg := &sub.Entity{
+		MessageAttributes: sub.MessageAttributes{
+			"traceparent": sub.StringAttributeValue("00-abcdef121234567890abcdef12345678-1234567890abcdef-01"),
+			"baggage":     sub.StringAttributeValue("tenant=t-1"),
+		},
+	}
+	// no global propagator is set in the tests
+	ctx, span := sub.StartProcessSpan(t.Context(), msg, sub.WithTracerProvider(tp))
+	span.End()
+
+	if got := baggage.FromContext(ctx).Member("tenant").Value(); got != "t-1" {
+		t.Errorf("baggage member: want=%q got=%q", "t-1", got)
+	}
+	links := exporter.GetSpans()[0].Links
+	if len(links) != 1 || links[0].SpanContext.TraceID().String() != "abcdef121234567890abcdef12345678" {
+		t.Errorf("links: %#v", links)
+	}
+}
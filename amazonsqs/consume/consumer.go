@@ -0,0 +1,288 @@
+package consume
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aereal/otelpubsub/amazonsqs/internal/utils"
+	"github.com/aereal/otelpubsub/amazonsqs/receive"
+	"github.com/aereal/otelpubsub/amazonsqs/sub"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.39.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/aereal/otelpubsub/amazonsqs/consume"
+
+const (
+	// maxDeleteBatchSize is the maximum number of entries of a DeleteMessageBatch call.
+	maxDeleteBatchSize = 10
+	// receiveErrorBackoff is how long the consumer waits before receiving again after ReceiveMessage fails.
+	receiveErrorBackoff = time.Second
+)
+
+// Client is the subset of [sqs.Client] the [Consumer] calls.
+type Client interface {
+	ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error)
+	DeleteMessageBatch(ctx context.Context, params *sqs.DeleteMessageBatchInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageBatchOutput, error)
+	sub.VisibilityChanger
+}
+
+var _ Client = (*sqs.Client)(nil)
+
+// Consumer long-polls an SQS queue and dispatches each received message to a [sub.Processor].
+//
+// Each ReceiveMessage call is instrumented as the receive package does, unless the client is already configured with [receive.AppendMiddlewares];
+// then the TracerProvider and propagator given to it are used for the "receive" spans.
+// Messages are processed with [sub.WrapProcessor], and the messages processed successfully are deleted in batches
+// under a CLIENT "settle" span linked to the process spans.
+// The messages the processor fails are left in the queue to be redelivered after the visibility timeout.
+type Consumer struct {
+	client    Client
+	queueURL  string
+	processor sub.Processor
+	tracer    trace.Tracer
+	cfg       *config
+	// processOptions are the options passed to sub.WrapProcessor.
+	processOptions []sub.StartProcessSpanOption
+	// receiveAPIOptions are the API options that instrument ReceiveMessage calls.
+	receiveAPIOptions []func(*middleware.Stack) error
+}
+
+// New returns a [Consumer] that receives messages from the queue and passes them to the processor.
+func New(client Client, queueURL string, processor sub.Processor, opts ...Option) *Consumer {
+	cfg := newConfig(opts)
+	var receiveAPIOptions []func(*middleware.Stack) error
+	receive.AppendMiddlewares(&receiveAPIOptions, receive.WithTracerProvider(cfg.tracerProvider), receive.WithPropagator(cfg.propagator))
+	if cfg.heartbeatOptions != nil {
+		processor = sub.ExtendVisibility(processor, client, queueURL, cfg.heartbeatOptions...)
+	}
+	return &Consumer{
+		client:    client,
+		queueURL:  queueURL,
+		processor: processor,
+		tracer:    cfg.tracerProvider.Tracer(tracerName),
+		cfg:       cfg,
+		processOptions: append(
+			[]sub.StartProcessSpanOption{sub.WithTracerProvider(cfg.tracerProvider), sub.WithPropagator(cfg.propagator)},
+			cfg.processOptions...),
+		receiveAPIOptions: receiveAPIOptions,
+	}
+}
+
+// Run receives and processes messages until the context is canceled.
+//
+// On cancellation it stops receiving, waits for the messages in flight to be processed,
+// deletes the processed ones and returns the context's error.
+// The received messages not yet dispatched to the processor are redelivered after the visibility timeout.
+// ReceiveMessage failures are logged and retried after a second, except the ones retrying cannot recover from,
+// such as QueueDoesNotExist or AccessDenied: Run then shuts down in the same way and returns the error.
+func (c *Consumer) Run(ctx context.Context) error {
+	// The messages in flight are processed and deleted even after the context is canceled.
+	detached := context.WithoutCancel(ctx)
+	jobs := make(chan *sub.Message)
+	deletions := make(chan deletion)
+	var workers sync.WaitGroup
+	for range c.cfg.concurrency {
+		workers.Go(func() {
+			for msg := range jobs {
+				c.process(detached, msg, deletions)
+			}
+		})
+	}
+	var deleter sync.WaitGroup
+	deleter.Go(func() { c.deleteLoop(detached, deletions) })
+
+	err := c.receiveLoop(ctx, jobs)
+	close(jobs)
+	workers.Wait()
+	close(deletions)
+	deleter.Wait()
+	return err
+}
+
+// receiveLoop receives messages and sends them to jobs until the context is canceled or ReceiveMessage fails terminally.
+func (c *Consumer) receiveLoop(ctx context.Context, jobs chan<- *sub.Message) error {
+	instrument := func(o *sqs.Options) { o.APIOptions = append(o.APIOptions, c.instrumentReceive) }
+	for ctx.Err() == nil {
+		out, err := c.client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:                    &c.queueURL,
+			MaxNumberOfMessages:         c.cfg.maxNumberOfMessages,
+			WaitTimeSeconds:             c.cfg.waitTimeSeconds,
+			MessageAttributeNames:       []string{"All"},
+			MessageSystemAttributeNames: []types.MessageSystemAttributeName{types.MessageSystemAttributeNameAll},
+		}, instrument)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if isTerminalReceiveError(err) {
+				return err
+			}
+			slog.Warn("failed to receive messages", slog.String("queue_url", c.queueURL), slog.String("error", err.Error()))
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(receiveErrorBackoff):
+			}
+			continue
+		}
+		for _, received := range out.Messages {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case jobs <- sub.FromReceivedMessage(c.queueURL, received):
+			}
+		}
+	}
+	return ctx.Err()
+}
+
+// instrumentReceive registers the receive middleware to the stack unless the client has already registered it.
+func (c *Consumer) instrumentReceive(stack *middleware.Stack) error {
+	if _, ok := stack.Initialize.Get(receive.MiddlewareID); ok {
+		return nil
+	}
+	for _, f := range c.receiveAPIOptions {
+		if err := f(stack); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// terminalReceiveErrorCodes are the error codes of ReceiveMessage that retrying never recovers from.
+var terminalReceiveErrorCodes = []string{"AccessDenied", "AccessDeniedException", "InvalidAddress", "InvalidSecurity"}
+
+func isTerminalReceiveError(err error) bool {
+	var queueNotExist *types.QueueDoesNotExist
+	if errors.As(err, &queueNotExist) {
+		return true
+	}
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && slices.Contains(terminalReceiveErrorCodes, apiErr.ErrorCode())
+}
+
+func (c *Consumer) process(ctx context.Context, msg *sub.Message, deletions chan<- deletion) {
+	var processSpanContext trace.SpanContext
+	processor := func(ctx context.Context, msg *sub.Message) error {
+		processSpanContext = trace.SpanContextFromContext(ctx)
+		return c.processor(ctx, msg)
+	}
+	if err := sub.WrapProcessor(processor, c.processOptions...)(ctx, msg); err != nil {
+		return
+	}
+	deletions <- deletion{receiptHandle: msg.ReceiptHandle, messageID: msg.MessageID, spanContext: processSpanContext}
+}
+
+type deletion struct {
+	receiptHandle string
+	messageID     string
+	spanContext   trace.SpanContext
+}
+
+func (c *Consumer) deleteLoop(ctx context.Context, deletions <-chan deletion) {
+	ticker := time.NewTicker(c.cfg.deleteFlushInterval)
+	defer ticker.Stop()
+	batch := make([]deletion, 0, maxDeleteBatchSize)
+	for {
+		select {
+		case d, ok := <-deletions:
+			if !ok {
+				c.deleteBatch(ctx, batch)
+				return
+			}
+			batch = append(batch, d)
+			if len(batch) == maxDeleteBatchSize {
+				c.deleteBatch(ctx, batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			c.deleteBatch(ctx, batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+func (c *Consumer) deleteBatch(ctx context.Context, batch []deletion) {
+	if len(batch) == 0 {
+		return
+	}
+	entries := make([]types.DeleteMessageBatchRequestEntry, len(batch))
+	links := make([]trace.Link, 0, len(batch))
+	for i, d := range batch {
+		entries[i] = types.DeleteMessageBatchRequestEntry{Id: utils.Ptr(strconv.Itoa(i)), ReceiptHandle: utils.Ptr(d.receiptHandle)}
+		if d.spanContext.IsValid() {
+			links = append(links, trace.Link{SpanContext: d.spanContext})
+		}
+	}
+	ctx, span := c.startSettleSpan(ctx, len(batch), links)
+	defer span.End()
+
+	out, err := c.client.DeleteMessageBatch(ctx, &sqs.DeleteMessageBatchInput{QueueUrl: &c.queueURL, Entries: entries})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "")
+		span.SetAttributes(errorType(err))
+		slog.Warn("failed to delete messages", slog.String("queue_url", c.queueURL), slog.String("error", err.Error()))
+		return
+	}
+	if len(out.Failed) == 0 {
+		return
+	}
+	span.SetStatus(codes.Error, "")
+	for _, failed := range out.Failed {
+		messageID := ""
+		if i, convErr := strconv.Atoi(deref(failed.Id)); convErr == nil && i < len(batch) {
+			messageID = batch[i].messageID
+		}
+		slog.Warn("failed to delete message",
+			slog.String("queue_url", c.queueURL),
+			slog.String("message_id", messageID),
+			slog.String("code", deref(failed.Code)),
+			slog.String("error", deref(failed.Message)))
+	}
+}
+
+func (c *Consumer) startSettleSpan(ctx context.Context, count int, links []trace.Link) (context.Context, trace.Span) {
+	const operationName = "settle"
+	attrs := []attribute.KeyValue{
+		semconv.MessagingSystemAWSSQS,
+		semconv.MessagingOperationTypeSettle,
+		semconv.MessagingOperationName(operationName),
+		semconv.MessagingBatchMessageCount(count),
+		semconv.AWSSQSQueueURL(c.queueURL),
+	}
+	spanName := operationName
+	if queueName := utils.QueueNameOf(c.queueURL); queueName != "" {
+		attrs = append(attrs, semconv.MessagingDestinationName(queueName))
+		spanName += " " + queueName
+	}
+	return c.tracer.Start(ctx, spanName, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...), trace.WithLinks(links...))
+}
+
+func errorType(err error) attribute.KeyValue {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() != "" {
+		return semconv.ErrorTypeKey.String(apiErr.ErrorCode())
+	}
+	return semconv.ErrorType(err)
+}
+
+func deref[V any](ptr *V) V {
+	var zero V
+	if ptr == nil {
+		return zero
+	}
+	return *ptr
+}
@@ -0,0 +1,427 @@
+package consume_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aereal/otelpubsub/amazonsqs/consume"
+	"github.com/aereal/otelpubsub/amazonsqs/internal/utils"
+	"github.com/aereal/otelpubsub/amazonsqs/receive"
+	"github.com/aereal/otelpubsub/amazonsqs/sub"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/google/go-cmp/cmp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const queueURL = "https://sqs.us-east-1.amazonaws.com/1234567890123/queue-1"
+
+func TestConsumer_Run(t *testing.T) {
+	t.Parallel()
+
+	srv := newSQSServer(t,
+		types.Message{
+			MessageId:     utils.Ptr("msg-1"),
+			ReceiptHandle: utils.Ptr("rh-1"),
+			Body:          utils.Ptr("body-1"),
+			MessageAttributes: map[string]types.MessageAttributeValue{
+				"traceparent": {DataType: utils.Ptr("String"), StringValue: utils.Ptr("00-11111111111111111111111111111111-1111111111111111-01")},
+			},
+		},
+		types.Message{MessageId: utils.Ptr("msg-2"), ReceiptHandle: utils.Ptr("rh-2"), Body: utils.Ptr("body-2")},
+		types.Message{MessageId: utils.Ptr("msg-3"), ReceiptHandle: utils.Ptr("rh-3"), Body: utils.Ptr("fail")},
+	)
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	processed := make(chan string, 3)
+	processor := func(_ context.Context, msg *sub.Message) error {
+		defer func() { processed <- msg.MessageID }()
+		if msg.UnwrappedBody() == "fail" {
+			return errors.New("oops")
+		}
+		return nil
+	}
+	consumer := consume.New(newClient(srv), queueURL, processor,
+		consume.WithTracerProvider(tp),
+		consume.WithPropagator(propagation.TraceContext{}),
+		consume.WithConcurrency(2),
+		consume.WithDeleteFlushInterval(time.Hour))
+
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan error, 1)
+	go func() { done <- consumer.Run(ctx) }()
+	for range 3 {
+		<-processed
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Run: want=%v got=%v", context.Canceled, err)
+	}
+
+	if diff := cmp.Diff([]string{"rh-1", "rh-2"}, srv.deletedReceiptHandles()); diff != "" {
+		t.Errorf("deleted receipt handles (-want, +got):\n%s", diff)
+	}
+	input := srv.firstReceiveInput()
+	if diff := cmp.Diff([]types.MessageSystemAttributeName{types.MessageSystemAttributeNameAll}, input.MessageSystemAttributeNames); diff != "" {
+		t.Errorf("MessageSystemAttributeNames (-want, +got):\n%s", diff)
+	}
+
+	var processSpans, settleSpans, receiveSpans []sdktrace.ReadOnlySpan
+	for _, span := range exporter.GetSpans().Snapshots() {
+		switch span.Name() {
+		case "process":
+			processSpans = append(processSpans, span)
+		case "settle queue-1":
+			settleSpans = append(settleSpans, span)
+		case "receive queue-1":
+			receiveSpans = append(receiveSpans, span)
+		}
+	}
+	if len(processSpans) != 3 {
+		t.Fatalf("got %d process spans, want 3", len(processSpans))
+	}
+	if len(receiveSpans) == 0 {
+		t.Error("no receive spans")
+	}
+	if len(settleSpans) != 1 {
+		t.Fatalf("got %d settle spans, want 1", len(settleSpans))
+	}
+	settle := settleSpans[0]
+	if settle.SpanKind() != trace.SpanKindClient {
+		t.Errorf("settle span kind: %s", settle.SpanKind())
+	}
+	wantAttrs := []attribute.KeyValue{
+		attribute.String("messaging.system", "aws_sqs"),
+		attribute.String("messaging.operation.type", "settle"),
+		attribute.String("messaging.operation.name", "settle"),
+		attribute.Int("messaging.batch.message_count", 2),
+		attribute.String("aws.sqs.queue.url", queueURL),
+		attribute.String("messaging.destination.name", "queue-1"),
+	}
+	if diff := cmp.Diff(wantAttrs, settle.Attributes(), cmp.Comparer(func(a, b attribute.Value) bool { return a.Emit() == b.Emit() })); diff != "" {
+		t.Errorf("settle span attributes (-want, +got):\n%s", diff)
+	}
+
+	var succeeded []string
+	for _, span := range processSpans {
+		if span.Status().Code == codes.Error {
+			continue
+		}
+		succeeded = append(succeeded, span.SpanContext().SpanID().String())
+	}
+	var linked []string
+	for _, link := range settle.Links() {
+		linked = append(linked, link.SpanContext.SpanID().String())
+	}
+	slices.Sort(succeeded)
+	slices.Sort(linked)
+	if diff := cmp.Diff(succeeded, linked); diff != "" {
+		t.Errorf("settle span links (-want, +got):\n%s", diff)
+	}
+
+	var producerLinked bool
+	for _, span := range processSpans {
+		for _, link := range span.Links() {
+			if link.SpanContext.TraceID().String() == "11111111111111111111111111111111" {
+				producerLinked = true
+			}
+		}
+	}
+	if !producerLinked {
+		t.Error("no process span is linked to the producer")
+	}
+}
+
+func TestConsumer_Run_gracefulShutdown(t *testing.T) {
+	t.Parallel()
+
+	srv := newSQSServer(t, types.Message{MessageId: utils.Ptr("msg-1"), ReceiptHandle: utils.Ptr("rh-1"), Body: utils.Ptr("body-1")})
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(tracetest.NewInMemoryExporter()))
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	processor := func(ctx context.Context, _ *sub.Message) error {
+		close(started)
+		<-release
+		return ctx.Err()
+	}
+	consumer := consume.New(newClient(srv), queueURL, processor, consume.WithTracerProvider(tp))
+
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan error, 1)
+	go func() { done <- consumer.Run(ctx) }()
+	<-started
+	cancel()
+	select {
+	case err := <-done:
+		t.Fatalf("Run returned before the message in flight is processed: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Run: want=%v got=%v", context.Canceled, err)
+	}
+	if diff := cmp.Diff([]string{"rh-1"}, srv.deletedReceiptHandles()); diff != "" {
+		t.Errorf("deleted receipt handles (-want, +got):\n%s", diff)
+	}
+}
+
+func TestConsumer_Run_visibilityHeartbeat(t *testing.T) {
+	t.Parallel()
+
+	srv := newSQSServer(t, types.Message{MessageId: utils.Ptr("msg-1"), ReceiptHandle: utils.Ptr("rh-1"), Body: utils.Ptr("body-1")})
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	processed := make(chan struct{})
+	processor := func(context.Context, *sub.Message) error {
+		defer close(processed)
+		time.Sleep(50 * time.Millisecond)
+		return nil
+	}
+	consumer := consume.New(newClient(srv), queueURL, processor,
+		consume.WithTracerProvider(tp),
+		consume.WithVisibilityHeartbeat(sub.WithHeartbeatInterval(10*time.Millisecond)))
+
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan error, 1)
+	go func() { done <- consumer.Run(ctx) }()
+	<-processed
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Run: want=%v got=%v", context.Canceled, err)
+	}
+	if diff := cmp.Diff([]string{"rh-1"}, srv.extendedReceiptHandles()); diff != "" {
+		t.Errorf("extended receipt handles (-want, +got):\n%s", diff)
+	}
+	var extensions int
+	for _, span := range exporter.GetSpans() {
+		if span.Name != "process" {
+			continue
+		}
+		for _, event := range span.Events {
+			if event.Name == "otelpubsub.visibility_extension" {
+				extensions++
+			}
+		}
+	}
+	if extensions == 0 {
+		t.Error("no extensions are recorded on the process span")
+	}
+}
+
+func TestConsumer_Run_terminalReceiveError(t *testing.T) {
+	t.Parallel()
+
+	srv := newSQSServer(t)
+	srv.receiveErr = "QueueDoesNotExist"
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(tracetest.NewInMemoryExporter()))
+	consumer := consume.New(newClient(srv), queueURL, func(context.Context, *sub.Message) error { return nil }, consume.WithTracerProvider(tp))
+
+	done := make(chan error, 1)
+	go func() { done <- consumer.Run(t.Context()) }()
+	select {
+	case err := <-done:
+		var queueNotExist *types.QueueDoesNotExist
+		if !errors.As(err, &queueNotExist) {
+			t.Errorf("Run: want QueueDoesNotExist, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run keeps retrying the terminal error")
+	}
+	if n := srv.receiveCount(); n != 1 {
+		t.Errorf("ReceiveMessage is called %d times, want 1", n)
+	}
+}
+
+func TestConsumer_Run_instrumentedClient(t *testing.T) {
+	t.Parallel()
+
+	srv := newSQSServer(t, types.Message{MessageId: utils.Ptr("msg-1"), ReceiptHandle: utils.Ptr("rh-1"), Body: utils.Ptr("body-1")})
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	// The client is configured as the receive package shows.
+	client := newClient(srv, func(o *sqs.Options) {
+		receive.AppendMiddlewares(&o.APIOptions, receive.WithTracerProvider(tp))
+	})
+
+	processed := make(chan struct{})
+	processor := func(context.Context, *sub.Message) error {
+		close(processed)
+		return nil
+	}
+	consumer := consume.New(client, queueURL, processor, consume.WithTracerProvider(tp), consume.WithDeleteFlushInterval(time.Hour))
+
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan error, 1)
+	go func() { done <- consumer.Run(ctx) }()
+	select {
+	case <-processed:
+	case err := <-done:
+		t.Fatalf("Run: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the message is not processed")
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Run: want=%v got=%v", context.Canceled, err)
+	}
+	if diff := cmp.Diff([]string{"rh-1"}, srv.deletedReceiptHandles()); diff != "" {
+		t.Errorf("deleted receipt handles (-want, +got):\n%s", diff)
+	}
+	var receiveSpans int
+	for _, span := range exporter.GetSpans() {
+		if span.Name == "receive queue-1" {
+			receiveSpans++
+		}
+	}
+	if receiveSpans != srv.receiveCount() {
+		t.Errorf("got %d receive spans for %d ReceiveMessage calls", receiveSpans, srv.receiveCount())
+	}
+}
+
+func newClient(srv *sqsServer, optFns ...func(*sqs.Options)) *sqs.Client {
+	return sqs.NewFromConfig(aws.Config{
+		Region:       "us-east-1",
+		Credentials:  staticCredentials("id", "secret", "token"),
+		BaseEndpoint: &srv.URL,
+	}, optFns...)
+}
+
+// sqsServer is the SQS stand-in that returns the queued messages once and records the deleted ones.
+type sqsServer struct {
+	*httptest.Server
+
+	mux           sync.Mutex
+	messages      []types.Message
+	receiveErr    string
+	receiveInputs []*sqs.ReceiveMessageInput
+	deleted       []string
+	extended      []string
+}
+
+func newSQSServer(t *testing.T, messages ...types.Message) *sqsServer {
+	t.Helper()
+	s := &sqsServer{messages: messages}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *sqsServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	switch r.Header.Get("X-Amz-Target") {
+	case "AmazonSQS.ReceiveMessage":
+		input := new(sqs.ReceiveMessageInput)
+		if err := json.NewDecoder(r.Body).Decode(input); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.mux.Lock()
+		s.receiveInputs = append(s.receiveInputs, input)
+		if s.receiveErr != "" {
+			s.mux.Unlock()
+			w.Header().Set("X-Amzn-Query-Error", s.receiveErr+";Sender")
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"__type": "com.amazonaws.sqs#" + s.receiveErr, "message": "error"})
+			return
+		}
+		n := min(len(s.messages), int(input.MaxNumberOfMessages))
+		messages := s.messages[:n]
+		s.messages = s.messages[n:]
+		s.mux.Unlock()
+		if len(messages) == 0 {
+			// Emulate long polling on the empty queue.
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"Messages": messages})
+	case "AmazonSQS.DeleteMessageBatch":
+		input := new(sqs.DeleteMessageBatchInput)
+		if err := json.NewDecoder(r.Body).Decode(input); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		successful := make([]map[string]string, 0, len(input.Entries))
+		s.mux.Lock()
+		for _, entry := range input.Entries {
+			s.deleted = append(s.deleted, *entry.ReceiptHandle)
+			successful = append(successful, map[string]string{"Id": *entry.Id})
+		}
+		s.mux.Unlock()
+		_ = json.NewEncoder(w).Encode(map[string]any{"Successful": successful, "Failed": []any{}})
+	case "AmazonSQS.ChangeMessageVisibility":
+		input := new(sqs.ChangeMessageVisibilityInput)
+		if err := json.NewDecoder(r.Body).Decode(input); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.mux.Lock()
+		s.extended = append(s.extended, *input.ReceiptHandle)
+		s.mux.Unlock()
+		_, _ = w.Write([]byte(`{}`))
+	default:
+		http.Error(w, "unexpected target", http.StatusBadRequest)
+	}
+}
+
+func (s *sqsServer) receiveCount() int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return len(s.receiveInputs)
+}
+
+func (s *sqsServer) deletedReceiptHandles() []string {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	ret := slices.Clone(s.deleted)
+	slices.Sort(ret)
+	return ret
+}
+
+func (s *sqsServer) extendedReceiptHandles() []string {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return slices.Compact(slices.Clone(s.extended))
+}
+
+func (s *sqsServer) firstReceiveInput() *sqs.ReceiveMessageInput {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.receiveInputs[0]
+}
+
+func staticCredentials(keyID, secret, sessionToken string) *awsCredentials {
+	return &awsCredentials{Credentials: aws.Credentials{
+		AccessKeyID:     keyID,
+		SecretAccessKey: secret,
+		SessionToken:    sessionToken,
+	}}
+}
+
+type awsCredentials struct {
+	aws.Credentials
+}
+
+var _ aws.CredentialsProvider = (*awsCredentials)(nil)
+
+func (c *awsCredentials) Retrieve(_ context.Context) (aws.Credentials, error) {
+	return c.Credentials, nil
+}
@@ -0,0 +1,155 @@
+package consume
+
+import (
+	"time"
+
+	"github.com/aereal/otelpubsub/amazonsqs/internal"
+	"github.com/aereal/otelpubsub/amazonsqs/sub"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// DefaultConcurrency is the number of messages processed concurrently by default.
+	DefaultConcurrency = 10
+	// DefaultWaitTimeSeconds is the long polling wait time by default, which is the maximum SQS allows.
+	DefaultWaitTimeSeconds int32 = 20
+	// DefaultMaxNumberOfMessages is the number of messages received at once by default, which is the maximum SQS allows.
+	DefaultMaxNumberOfMessages int32 = 10
+	// DefaultDeleteFlushInterval is how long the deletions are buffered by default before they are sent in a batch.
+	DefaultDeleteFlushInterval = time.Second
+)
+
+type config struct {
+	tracerProvider      trace.TracerProvider
+	propagator          propagation.TextMapPropagator
+	processOptions      []sub.StartProcessSpanOption
+	heartbeatOptions    []sub.HeartbeatOption
+	concurrency         int
+	waitTimeSeconds     int32
+	maxNumberOfMessages int32
+	deleteFlushInterval time.Duration
+}
+
+func newConfig(opts []Option) *config {
+	cfg := &config{
+		concurrency:         DefaultConcurrency,
+		waitTimeSeconds:     DefaultWaitTimeSeconds,
+		maxNumberOfMessages: DefaultMaxNumberOfMessages,
+		deleteFlushInterval: DefaultDeleteFlushInterval,
+	}
+	for _, o := range opts {
+		o.applyConsumerOption(cfg)
+	}
+	if cfg.tracerProvider == nil {
+		cfg.tracerProvider = otel.GetTracerProvider()
+	}
+	if cfg.propagator == nil {
+		cfg.propagator = internal.Propagator
+	}
+	return cfg
+}
+
+// Option configures [Consumer] behavior.
+type Option interface {
+	applyConsumerOption(*config)
+}
+
+// WithTracerProvider specifies the [trace.TracerProvider] to use for creating spans.
+// It is also used for the receive and process spans.
+// If not specified, [otel.GetTracerProvider] is used.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return &optionWithTracerProvider{tp: tp}
+}
+
+type optionWithTracerProvider struct{ tp trace.TracerProvider }
+
+func (o *optionWithTracerProvider) applyConsumerOption(c *config) { c.tracerProvider = o.tp }
+
+// WithPropagator specifies the [propagation.TextMapPropagator] to extract trace context from message attributes.
+// If not specified, [otel.GetTextMapPropagator] is used, or W3C Trace Context and Baggage while no global propagator is set.
+func WithPropagator(p propagation.TextMapPropagator) Option {
+	return &optionWithPropagator{p: p}
+}
+
+type optionWithPropagator struct{ p propagation.TextMapPropagator }
+
+func (o *optionWithPropagator) applyConsumerOption(c *config) { c.propagator = o.p }
+
+// WithProcessOptions specifies the options passed to [sub.WrapProcessor] to process each message.
+// They take precedence over the tracer provider and the propagator of the [Consumer].
+func WithProcessOptions(opts ...sub.StartProcessSpanOption) Option {
+	return &optionWithProcessOptions{opts: opts}
+}
+
+type optionWithProcessOptions struct{ opts []sub.StartProcessSpanOption }
+
+func (o *optionWithProcessOptions) applyConsumerOption(c *config) {
+	c.processOptions = append(c.processOptions, o.opts...)
+}
+
+// WithConcurrency specifies the number of messages processed concurrently.
+// If not specified or not positive, [DefaultConcurrency] is used.
+func WithConcurrency(n int) Option {
+	return &optionWithConcurrency{n: n}
+}
+
+type optionWithConcurrency struct{ n int }
+
+func (o *optionWithConcurrency) applyConsumerOption(c *config) {
+	if o.n > 0 {
+		c.concurrency = o.n
+	}
+}
+
+// WithWaitTimeSeconds specifies the long polling wait time of each ReceiveMessage call.
+// If not specified, [DefaultWaitTimeSeconds] is used.
+func WithWaitTimeSeconds(seconds int32) Option {
+	return &optionWithWaitTimeSeconds{seconds: seconds}
+}
+
+type optionWithWaitTimeSeconds struct{ seconds int32 }
+
+func (o *optionWithWaitTimeSeconds) applyConsumerOption(c *config) { c.waitTimeSeconds = o.seconds }
+
+// WithMaxNumberOfMessages specifies the maximum number of messages each ReceiveMessage call returns.
+// If not specified or not positive, [DefaultMaxNumberOfMessages] is used.
+func WithMaxNumberOfMessages(n int32) Option {
+	return &optionWithMaxNumberOfMessages{n: n}
+}
+
+type optionWithMaxNumberOfMessages struct{ n int32 }
+
+func (o *optionWithMaxNumberOfMessages) applyConsumerOption(c *config) {
+	if o.n > 0 {
+		c.maxNumberOfMessages = o.n
+	}
+}
+
+// WithDeleteFlushInterval specifies how long the deletions of the processed messages are buffered
+// before they are sent in a DeleteMessageBatch call; a full batch of 10 is sent immediately.
+// If not specified or not positive, [DefaultDeleteFlushInterval] is used.
+func WithDeleteFlushInterval(d time.Duration) Option {
+	return &optionWithDeleteFlushInterval{d: d}
+}
+
+type optionWithDeleteFlushInterval struct{ d time.Duration }
+
+func (o *optionWithDeleteFlushInterval) applyConsumerOption(c *config) {
+	if o.d > 0 {
+		c.deleteFlushInterval = o.d
+	}
+}
+
+// WithVisibilityHeartbeat extends the visibility timeout of each message while it is processed with [sub.ExtendVisibility].
+// Each extension is recorded as an event on the process span.
+func WithVisibilityHeartbeat(opts ...sub.HeartbeatOption) Option {
+	return &optionWithVisibilityHeartbeat{opts: opts}
+}
+
+type optionWithVisibilityHeartbeat struct{ opts []sub.HeartbeatOption }
+
+func (o *optionWithVisibilityHeartbeat) applyConsumerOption(c *config) {
+	c.heartbeatOptions = append(make([]sub.HeartbeatOption, 0, len(o.opts)), o.opts...)
+}
@@ -0,0 +1,86 @@
+// Package envelope embeds the propagation fields into a message body for delivery paths that drop message attributes.
+//
+// A body that is a JSON object is augmented with the field named [FieldName].
+// Any other body is wrapped into a JSON object that holds the fields in [FieldName]
+// and the original body as a string in [BodyFieldName].
+// Either object also has [VersionFieldName], so that user payloads that happen to have the same fields are not taken as envelopes.
+package envelope
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+const (
+	// FieldName is the name of the JSON field that holds the propagation fields.
+	FieldName = "otelpubsub.propagation"
+	// BodyFieldName is the name of the JSON field that holds the original body of a wrapped message.
+	BodyFieldName = "otelpubsub.body"
+	// VersionFieldName is the name of the JSON field that marks the object as an envelope of [Version].
+	VersionFieldName = "otelpubsub.envelope"
+	// Version is the version of the envelope format.
+	Version = 1
+)
+
+var encodedVersion = json.RawMessage(strconv.Itoa(Version))
+
+// Wrap returns the body that carries the fields.
+func Wrap(body string, fields map[string]string) (string, error) {
+	encodedFields, err := json.Marshal(fields)
+	if err != nil {
+		return "", err
+	}
+	object := objectOf(body)
+	if object == nil {
+		encodedBody, marshalErr := json.Marshal(body)
+		if marshalErr != nil {
+			return "", marshalErr
+		}
+		object = map[string]json.RawMessage{BodyFieldName: encodedBody}
+	}
+	object[FieldName] = encodedFields
+	object[VersionFieldName] = encodedVersion
+	b, err := json.Marshal(object)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// objectOf returns the fields of the body if it is a JSON object, or nil.
+func objectOf(body string) map[string]json.RawMessage {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(body), &object); err != nil {
+		return nil
+	}
+	return object
+}
+
+// Unwrap returns the fields and the original body carried by the body made by [Wrap].
+// ok is false if the body is not an envelope of [Version] or carries no fields; then the body is returned as is.
+// The original body of an augmented JSON object is the body as is, including [FieldName].
+func Unwrap(body string) (fields map[string]string, original string, ok bool) {
+	if !strings.Contains(body, FieldName) {
+		return nil, body, false
+	}
+	object := objectOf(body)
+	var version int
+	if err := json.Unmarshal(object[VersionFieldName], &version); err != nil || version != Version {
+		return nil, body, false
+	}
+	encodedFields, found := object[FieldName]
+	if !found {
+		return nil, body, false
+	}
+	if err := json.Unmarshal(encodedFields, &fields); err != nil {
+		return nil, body, false
+	}
+	original = body
+	if encodedBody, found := object[BodyFieldName]; found && len(object) == 3 {
+		if err := json.Unmarshal(encodedBody, &original); err != nil {
+			original = body
+		}
+	}
+	return fields, original, true
+}
@@ -0,0 +1,119 @@
+package envelope_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/aereal/otelpubsub/amazonsqs/internal/envelope"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWrap(t *testing.T) {
+	t.Parallel()
+
+	fields := map[string]string{"traceparent": "00-abcdef121234567890abcdef12345678-1234567890abcdef-01"}
+	testCases := []struct {
+		want map[string]any
+		name string
+		body string
+	}{
+		{
+			name: "object",
+			body: `{"id":1,"name":"a"}`,
+			want: map[string]any{"id": 1.0, "name": "a", "otelpubsub.propagation": map[string]any{"traceparent": fields["traceparent"]}, "otelpubsub.envelope": 1.0},
+		},
+		{
+			name: "object/overwrite",
+			body: `{"id":1,"otelpubsub.propagation":{"traceparent":"old"}}`,
+			want: map[string]any{"id": 1.0, "otelpubsub.propagation": map[string]any{"traceparent": fields["traceparent"]}, "otelpubsub.envelope": 1.0},
+		},
+		{
+			name: "text",
+			body: "plain text",
+			want: map[string]any{"otelpubsub.body": "plain text", "otelpubsub.propagation": map[string]any{"traceparent": fields["traceparent"]}, "otelpubsub.envelope": 1.0},
+		},
+		{
+			name: "array",
+			body: `[1,2]`,
+			want: map[string]any{"otelpubsub.body": "[1,2]", "otelpubsub.propagation": map[string]any{"traceparent": fields["traceparent"]}, "otelpubsub.envelope": 1.0},
+		},
+		{
+			name: "null",
+			body: `null`,
+			want: map[string]any{"otelpubsub.body": "null", "otelpubsub.propagation": map[string]any{"traceparent": fields["traceparent"]}, "otelpubsub.envelope": 1.0},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			wrapped, err := envelope.Wrap(tc.body, fields)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got map[string]any
+			if err := json.Unmarshal([]byte(wrapped), &got); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("(-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestUnwrap(t *testing.T) {
+	t.Parallel()
+
+	fields := map[string]string{"traceparent": "00-abcdef121234567890abcdef12345678-1234567890abcdef-01"}
+	testCases := []struct {
+		wantFields   map[string]string
+		name         string
+		body         string
+		wantOriginal string
+		wantOK       bool
+	}{
+		{name: "text", body: "plain text", wantFields: fields, wantOriginal: "plain text", wantOK: true},
+		{name: "object", body: `{"id":1}`, wantFields: fields, wantOK: true},
+		{name: "no envelope/text", body: "plain text", wantOriginal: "plain text"},
+		{name: "no envelope/object", body: `{"id":1}`, wantOriginal: `{"id":1}`},
+		{name: "malformed fields", body: `{"otelpubsub.envelope":1,"otelpubsub.propagation":1}`, wantOriginal: `{"otelpubsub.envelope":1,"otelpubsub.propagation":1}`},
+		{
+			name:         "no marker",
+			body:         `{"otelpubsub.body":"text","otelpubsub.propagation":{"traceparent":"00-abcdef121234567890abcdef12345678-1234567890abcdef-01"}}`,
+			wantOriginal: `{"otelpubsub.body":"text","otelpubsub.propagation":{"traceparent":"00-abcdef121234567890abcdef12345678-1234567890abcdef-01"}}`,
+		},
+		{
+			name:         "unknown version",
+			body:         `{"otelpubsub.envelope":2,"otelpubsub.body":"text","otelpubsub.propagation":{"traceparent":"00-abcdef121234567890abcdef12345678-1234567890abcdef-01"}}`,
+			wantOriginal: `{"otelpubsub.envelope":2,"otelpubsub.body":"text","otelpubsub.propagation":{"traceparent":"00-abcdef121234567890abcdef12345678-1234567890abcdef-01"}}`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			body := tc.body
+			if tc.wantFields != nil {
+				var err error
+				if body, err = envelope.Wrap(tc.body, tc.wantFields); err != nil {
+					t.Fatal(err)
+				}
+			}
+			wantOriginal := tc.wantOriginal
+			if wantOriginal == "" {
+				wantOriginal = body
+			}
+			gotFields, gotOriginal, gotOK := envelope.Unwrap(body)
+			if gotOK != tc.wantOK {
+				t.Errorf("ok: want=%v got=%v", tc.wantOK, gotOK)
+			}
+			if diff := cmp.Diff(tc.wantFields, gotFields); diff != "" {
+				t.Errorf("fields (-want, +got):\n%s", diff)
+			}
+			if gotOriginal != wantOriginal {
+				t.Errorf("original: want=%q got=%q", wantOriginal, gotOriginal)
+			}
+		})
+	}
+}
@@ -0,0 +1,3 @@
+// Package integration tests the interoperability of the amazonsqs packages with other instrumentation libraries.
+// It is a module of its own so that the amazonsqs module does not require them.
+package integration
@@ -0,0 +1,33 @@
+package integration_test
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func staticCredentials(keyID, secret, sessionToken string) *awsCredentials {
+	return &awsCredentials{Credentials: aws.Credentials{
+		AccessKeyID:     keyID,
+		SecretAccessKey: secret,
+		SessionToken:    sessionToken,
+	}}
+}
+
+type awsCredentials struct {
+	aws.Credentials
+}
+
+var _ aws.CredentialsProvider = (*awsCredentials)(nil)
+
+func (c *awsCredentials) Retrieve(_ context.Context) (aws.Credentials, error) {
+	return c.Credentials, nil
+}
+
+func deref[V any](ptr *V) V {
+	var zero V
+	if ptr == nil {
+		return zero
+	}
+	return *ptr
+}
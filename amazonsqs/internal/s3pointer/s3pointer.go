@@ -0,0 +1,49 @@
+// Package s3pointer encodes the pointers to the message bodies offloaded to S3 in the format of the SQS extended client libraries.
+//
+// The body of an offloaded message is a JSON array of [ClassName] and the object that holds the bucket and the key,
+// and the message has the [AttributeName] Number attribute that holds the size of the original body.
+package s3pointer
+
+import "encoding/json"
+
+const (
+	// ClassName is the class name of the pointer in the extended client libraries.
+	ClassName = "software.amazon.payloadoffloading.PayloadS3Pointer"
+	// AttributeName is the name of the message attribute that holds the size of the original body.
+	AttributeName = "ExtendedPayloadSize"
+	// LegacyAttributeName is the name of [AttributeName] used by the older extended client libraries.
+	LegacyAttributeName = "SQSLargePayloadSize"
+)
+
+// Pointer locates an offloaded message body.
+type Pointer struct {
+	Bucket string `json:"s3BucketName"`
+	Key    string `json:"s3Key"`
+}
+
+// Encode returns the message body that points to the object.
+func Encode(p Pointer) (string, error) {
+	b, err := json.Marshal([]any{ClassName, p})
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// Decode parses the message body as a pointer.
+// ok is false if the body is not a pointer.
+func Decode(body string) (_ Pointer, ok bool) {
+	var elements []json.RawMessage
+	if err := json.Unmarshal([]byte(body), &elements); err != nil || len(elements) != 2 {
+		return Pointer{}, false
+	}
+	var className string
+	if err := json.Unmarshal(elements[0], &className); err != nil || className != ClassName {
+		return Pointer{}, false
+	}
+	var p Pointer
+	if err := json.Unmarshal(elements[1], &p); err != nil || p.Bucket == "" || p.Key == "" {
+		return Pointer{}, false
+	}
+	return p, true
+}
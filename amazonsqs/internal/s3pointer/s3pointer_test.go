@@ -0,0 +1,56 @@
+package s3pointer_test
+
+import (
+	"testing"
+
+	"github.com/aereal/otelpubsub/amazonsqs/internal/s3pointer"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestEncode(t *testing.T) {
+	t.Parallel()
+
+	got, err := s3pointer.Encode(s3pointer.Pointer{Bucket: "bucket-1", Key: "key-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `["software.amazon.payloadoffloading.PayloadS3Pointer",{"s3BucketName":"bucket-1","s3Key":"key-1"}]`
+	if got != want {
+		t.Errorf("want=%s got=%s", want, got)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name   string
+		body   string
+		want   s3pointer.Pointer
+		wantOK bool
+	}{
+		{
+			name:   "pointer",
+			body:   `["software.amazon.payloadoffloading.PayloadS3Pointer",{"s3BucketName":"bucket-1","s3Key":"key-1"}]`,
+			want:   s3pointer.Pointer{Bucket: "bucket-1", Key: "key-1"},
+			wantOK: true,
+		},
+		{name: "other class", body: `["com.example.Pointer",{"s3BucketName":"bucket-1","s3Key":"key-1"}]`},
+		{name: "no key", body: `["software.amazon.payloadoffloading.PayloadS3Pointer",{"s3BucketName":"bucket-1"}]`},
+		{name: "array", body: `[1,2]`},
+		{name: "text", body: "plain text"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, ok := s3pointer.Decode(tc.body)
+			if ok != tc.wantOK {
+				t.Fatalf("ok: want=%v got=%v", tc.wantOK, ok)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("(-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
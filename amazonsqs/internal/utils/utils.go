@@ -1,12 +1,20 @@
 package utils
 
-import "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+import (
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
 
 func Ptr[V any](v V) *V { return &v }
 
 const (
 	DataTypeString string = "String"
 	DataTypeNumber string = "Number"
+	DataTypeBinary string = "Binary"
 )
 
 func StringAttributeValue(s string) types.MessageAttributeValue {
@@ -22,3 +30,90 @@ func NumberAttributeValue(s string) types.MessageAttributeValue {
 		StringValue: Ptr(s),
 	}
 }
+
+func BinaryAttributeValue(b []byte) types.MessageAttributeValue {
+	return types.MessageAttributeValue{
+		DataType:    Ptr(DataTypeBinary),
+		BinaryValue: b,
+	}
+}
+
+// QueueNameOf returns the queue name part of the queue URL.
+// A queue ARN is also accepted.
+func QueueNameOf(queueURL string) string {
+	if queueURL == "" {
+		return ""
+	}
+	if arn.IsARN(queueURL) {
+		parsed, err := arn.Parse(queueURL)
+		if err != nil {
+			return ""
+		}
+		return parsed.Resource
+	}
+	u, err := url.Parse(queueURL)
+	if err != nil || u.Path == "" || u.Path == "/" {
+		return ""
+	}
+	return path.Base(u.Path)
+}
+
+// QueueARNOf returns the ARN of the queue identified by the queue URL or ARN.
+// The region is taken from the host of the URL, such as sqs.us-east-1.amazonaws.com or us-east-1.queue.amazonaws.com;
+// it returns an empty string if the URL has no region.
+func QueueARNOf(queue string) string {
+	if queue == "" {
+		return ""
+	}
+	if arn.IsARN(queue) {
+		return queue
+	}
+	u, err := url.Parse(queue)
+	if err != nil {
+		return ""
+	}
+	accountID, name := path.Split(strings.Trim(u.Path, "/"))
+	accountID = strings.TrimSuffix(accountID, "/")
+	if accountID == "" || name == "" {
+		return ""
+	}
+	region := regionOf(u.Hostname())
+	if region == "" {
+		return ""
+	}
+	return arn.ARN{
+		Partition: partitionOf(region),
+		Service:   "sqs",
+		Region:    region,
+		AccountID: accountID,
+		Resource:  name,
+	}.String()
+}
+
+func regionOf(host string) string {
+	labels := strings.Split(host, ".")
+	switch {
+	case len(labels) < 3:
+		return ""
+	case labels[0] == "sqs":
+		return labels[1]
+	case labels[0] == "queue":
+		// the legacy endpoint of us-east-1
+		return "us-east-1"
+	case labels[1] == "queue":
+		return labels[0]
+	default:
+		return ""
+	}
+}
+
+func partitionOf(region string) string {
+	switch {
+	case strings.HasPrefix(region, "cn-"):
+		return "aws-cn"
+	case strings.HasPrefix(region, "us-gov-"):
+		return "aws-us-gov"
+	default:
+		return "aws"
+	}
+}
@@ -0,0 +1,98 @@
+// Package xray encodes and decodes span contexts in the AWS X-Ray trace header format.
+//
+// The header looks like "Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1".
+package xray
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	keyRoot    = "Root"
+	keyParent  = "Parent"
+	keySampled = "Sampled"
+
+	traceIDVersion = "1"
+	// traceIDEpochLength is the length of the epoch part of the X-Ray trace ID in hex digits.
+	traceIDEpochLength = 8
+)
+
+// FormatHeader formats the span context as an X-Ray trace header.
+// It returns an empty string if the span context is invalid.
+func FormatHeader(sc trace.SpanContext) string {
+	if !sc.IsValid() {
+		return ""
+	}
+	traceID := sc.TraceID().String()
+	sampled := "0"
+	if sc.IsSampled() {
+		sampled = "1"
+	}
+	var b strings.Builder
+	b.WriteString(keyRoot + "=" + traceIDVersion + "-" + traceID[:traceIDEpochLength] + "-" + traceID[traceIDEpochLength:])
+	b.WriteString(";" + keyParent + "=" + sc.SpanID().String())
+	b.WriteString(";" + keySampled + "=" + sampled)
+	return b.String()
+}
+
+// ErrMalformed is returned when the header lacks a valid root trace ID or parent span ID.
+var ErrMalformed = errors.New("xray: malformed trace header")
+
+// ParseHeader parses an X-Ray trace header into a remote span context.
+// Unknown keys such as Lineage are ignored.
+// The span context is sampled only if the header says Sampled=1.
+func ParseHeader(header string) (trace.SpanContext, error) {
+	var cfg trace.SpanContextConfig
+	var hasRoot, hasParent bool
+	for part := range strings.SplitSeq(header, ";") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case keyRoot:
+			traceID, err := parseTraceID(value)
+			if err != nil {
+				return trace.SpanContext{}, err
+			}
+			cfg.TraceID = traceID
+			hasRoot = true
+		case keyParent:
+			spanID, err := trace.SpanIDFromHex(value)
+			if err != nil {
+				return trace.SpanContext{}, fmt.Errorf("%w: %w", ErrMalformed, err)
+			}
+			cfg.SpanID = spanID
+			hasParent = true
+		case keySampled:
+			if value == "1" {
+				cfg.TraceFlags = trace.FlagsSampled
+			}
+		}
+	}
+	if !hasRoot || !hasParent {
+		return trace.SpanContext{}, ErrMalformed
+	}
+	cfg.Remote = true
+	return trace.NewSpanContext(cfg), nil
+}
+
+func parseTraceID(root string) (trace.TraceID, error) {
+	version, rest, ok := strings.Cut(root, "-")
+	if !ok || version != traceIDVersion {
+		return trace.TraceID{}, ErrMalformed
+	}
+	epoch, random, ok := strings.Cut(rest, "-")
+	if !ok || len(epoch) != traceIDEpochLength {
+		return trace.TraceID{}, ErrMalformed
+	}
+	traceID, err := trace.TraceIDFromHex(epoch + random)
+	if err != nil {
+		return trace.TraceID{}, fmt.Errorf("%w: %w", ErrMalformed, err)
+	}
+	return traceID, nil
+}
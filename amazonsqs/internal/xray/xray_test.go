@@ -0,0 +1,98 @@
+package xray_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aereal/otelpubsub/amazonsqs/internal/xray"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestFormatHeader(t *testing.T) {
+	t.Parallel()
+
+	traceID := trace.TraceID{0x57, 0x59, 0xe9, 0x88, 0xbd, 0x86, 0x2e, 0x3f, 0xe1, 0xbe, 0x46, 0xa9, 0x94, 0x27, 0x27, 0x93}
+	spanID := trace.SpanID{0x53, 0x99, 0x5c, 0x3f, 0x42, 0xcd, 0x8a, 0xd8}
+	testCases := []struct {
+		name string
+		sc   trace.SpanContext
+		want string
+	}{
+		{
+			name: "sampled",
+			sc:   trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID, TraceFlags: trace.FlagsSampled}),
+			want: "Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1",
+		},
+		{
+			name: "not sampled",
+			sc:   trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID}),
+			want: "Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=0",
+		},
+		{
+			name: "invalid",
+			sc:   trace.SpanContext{},
+			want: "",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := xray.FormatHeader(tc.sc); got != tc.want {
+				t.Errorf("want=%q got=%q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestParseHeader(t *testing.T) {
+	t.Parallel()
+
+	traceID := trace.TraceID{0x57, 0x59, 0xe9, 0x88, 0xbd, 0x86, 0x2e, 0x3f, 0xe1, 0xbe, 0x46, 0xa9, 0x94, 0x27, 0x27, 0x93}
+	spanID := trace.SpanID{0x53, 0x99, 0x5c, 0x3f, 0x42, 0xcd, 0x8a, 0xd8}
+	testCases := []struct {
+		name    string
+		header  string
+		want    trace.SpanContext
+		wantErr error
+	}{
+		{
+			name:   "sampled",
+			header: "Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1",
+			want:   trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID, TraceFlags: trace.FlagsSampled, Remote: true}),
+		},
+		{
+			name:   "not sampled with lineage",
+			header: "Root=1-5759e988-bd862e3fe1be46a994272793; Parent=53995c3f42cd8ad8; Sampled=0; Lineage=a87bd80c:0",
+			want:   trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID, Remote: true}),
+		},
+		{
+			name:    "no parent",
+			header:  "Root=1-5759e988-bd862e3fe1be46a994272793;Sampled=1",
+			wantErr: xray.ErrMalformed,
+		},
+		{
+			name:    "unknown version",
+			header:  "Root=2-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8",
+			wantErr: xray.ErrMalformed,
+		},
+		{
+			name:    "broken parent",
+			header:  "Root=1-5759e988-bd862e3fe1be46a994272793;Parent=xyz",
+			wantErr: xray.ErrMalformed,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := xray.ParseHeader(tc.header)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("error: want=%v got=%v", tc.wantErr, err)
+			}
+			if !got.Equal(tc.want) {
+				t.Errorf("want=%#v got=%#v", tc.want, got)
+			}
+		})
+	}
+}
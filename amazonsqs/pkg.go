@@ -2,4 +2,6 @@
 //
 // Use the pub subpackage to inject trace context when sending messages,
 // and the sub subpackage to extract trace context when processing received messages.
+// The receive subpackage instruments ReceiveMessage API calls of polling consumers,
+// and the consume subpackage provides a polling consumer built on them.
 package amazonsqs
@@ -0,0 +1,58 @@
+package pub
+
+import (
+	"iter"
+
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SQSSendSpanAttributeProducer produces attributes set on the spans started by [AppendMiddlewares].
+// The attributes are produced after the API call.
+type SQSSendSpanAttributeProducer interface {
+	// ProduceSQSSendSpanAttributes produces attributes for the span of a SendMessage API call.
+	// output is nil if the API call fails.
+	ProduceSQSSendSpanAttributes(input *sqs.SendMessageInput, output *sqs.SendMessageOutput) iter.Seq[attribute.KeyValue]
+	// ProduceSQSSendBatchEntrySpanAttributes produces attributes for the "create" span of an entry of a SendMessageBatch API call.
+	// result is nil if the entry or the API call fails.
+	ProduceSQSSendBatchEntrySpanAttributes(input *sqs.SendMessageBatchInput, entry *types.SendMessageBatchRequestEntry, result *types.SendMessageBatchResultEntry) iter.Seq[attribute.KeyValue]
+}
+
+func (i *instrumenter) produceSendAttributes(span trace.Span, input *sqs.SendMessageInput, output *sqs.SendMessageOutput) {
+	var attrs []attribute.KeyValue
+	for _, producer := range i.attributeProducers {
+		for kv := range producer.ProduceSQSSendSpanAttributes(input, output) {
+			attrs = append(attrs, kv)
+		}
+	}
+	if len(attrs) > 0 {
+		span.SetAttributes(attrs...)
+	}
+}
+
+// produceBatchEntryAttributes sets the produced attributes on createSpans, which are in the same order as the input entries.
+func (i *instrumenter) produceBatchEntryAttributes(createSpans []trace.Span, input *sqs.SendMessageBatchInput, output *sqs.SendMessageBatchOutput) {
+	if len(i.attributeProducers) == 0 {
+		return
+	}
+	results := map[string]*types.SendMessageBatchResultEntry{}
+	if output != nil {
+		for idx := range output.Successful {
+			results[deref(output.Successful[idx].Id)] = &output.Successful[idx]
+		}
+	}
+	for idx, createSpan := range createSpans {
+		entry := &input.Entries[idx]
+		var attrs []attribute.KeyValue
+		for _, producer := range i.attributeProducers {
+			for kv := range producer.ProduceSQSSendBatchEntrySpanAttributes(input, entry, results[deref(entry.Id)]) {
+				attrs = append(attrs, kv)
+			}
+		}
+		if len(attrs) > 0 {
+			createSpan.SetAttributes(attrs...)
+		}
+	}
+}
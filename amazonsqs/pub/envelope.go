@@ -0,0 +1,66 @@
+package pub
+
+import (
+	"context"
+
+	"github.com/aereal/otelpubsub/amazonsqs/internal/envelope"
+	"github.com/aereal/otelpubsub/amazonsqs/internal/s3pointer"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// BodyEnvelopeFieldName is the name of the JSON field of the message body that holds the propagation fields
+// injected according to [BodyEnvelopeMode].
+const BodyEnvelopeFieldName = envelope.FieldName
+
+// BodyEnvelopeMode determines whether the trace context is also injected into the message body.
+//
+// The envelope lets consumers find the trace context on delivery paths that drop message attributes.
+// A body that is a JSON object gets the field named [BodyEnvelopeFieldName];
+// any other body is wrapped into a JSON object. Either object is marked with the "otelpubsub.envelope" field.
+// The processors of the sub package receive the body as delivered, and sub.Message.UnwrappedBody returns the original body.
+// Injecting into the body changes it, so FIFO queues with content-based deduplication no longer deduplicate the messages.
+type BodyEnvelopeMode int
+
+const (
+	// BodyEnvelopeModeNone does not touch the message body.
+	BodyEnvelopeModeNone BodyEnvelopeMode = iota
+	// BodyEnvelopeModeFallback injects into the body only when injection into the message attributes is skipped
+	// because of [MaxMessageAttributes].
+	BodyEnvelopeModeFallback
+	// BodyEnvelopeModeAlways injects into the body in addition to the message attributes.
+	BodyEnvelopeModeAlways
+)
+
+// injectBody returns the body with the trace context injected according to the [BodyEnvelopeMode],
+// and the decision updated from the one made for the message attributes.
+func (i *instrumenter) injectBody(ctx context.Context, body *string, decision injectionDecision) (*string, injectionDecision, error) {
+	if body == nil {
+		return body, decision, nil
+	}
+	// the pointer to an offloaded body must be left as is for the extended client libraries
+	if _, ok := s3pointer.Decode(*body); ok {
+		return body, decision, nil
+	}
+	switch i.bodyEnvelopeMode {
+	case BodyEnvelopeModeAlways:
+	case BodyEnvelopeModeFallback:
+		if decision != injectionDecisionSkipped {
+			return body, decision, nil
+		}
+	case BodyEnvelopeModeNone:
+		return body, decision, nil
+	}
+	fields := propagation.MapCarrier{}
+	i.propagator.Inject(ctx, fields)
+	if len(fields) == 0 {
+		return body, decision, nil
+	}
+	wrapped, err := envelope.Wrap(*body, fields)
+	if err != nil {
+		return nil, "", err
+	}
+	if decision == injectionDecisionSkipped {
+		decision = injectionDecisionEnvelope
+	}
+	return &wrapped, decision, nil
+}
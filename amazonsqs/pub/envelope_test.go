@@ -0,0 +1,186 @@
+package pub_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aereal/otelpubsub/amazonsqs/internal/utils"
+	"github.com/aereal/otelpubsub/amazonsqs/pub"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/google/go-cmp/cmp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestMiddleware_bodyEnvelope(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		wantBody     func(sc trace.SpanContext) any
+		name         string
+		body         string
+		wantDecision string
+		mode         pub.BodyEnvelopeMode
+		numAttrs     int
+	}{
+		{
+			name:         "none",
+			mode:         pub.BodyEnvelopeModeNone,
+			numAttrs:     10,
+			body:         "hello",
+			wantBody:     func(trace.SpanContext) any { return "hello" },
+			wantDecision: "skipped",
+		},
+		{
+			name:         "fallback/attributes fit",
+			mode:         pub.BodyEnvelopeModeFallback,
+			body:         "hello",
+			wantBody:     func(trace.SpanContext) any { return "hello" },
+			wantDecision: "full",
+		},
+		{
+			name:     "fallback/attributes skipped",
+			mode:     pub.BodyEnvelopeModeFallback,
+			numAttrs: 10,
+			body:     "hello",
+			wantBody: func(sc trace.SpanContext) any {
+				return map[string]any{
+					"otelpubsub.body":        "hello",
+					"otelpubsub.propagation": map[string]any{"traceparent": traceparentOf(sc)},
+					"otelpubsub.envelope":    1.0,
+				}
+			},
+			wantDecision: "envelope",
+		},
+		{
+			name: "always",
+			mode: pub.BodyEnvelopeModeAlways,
+			body: `{"id":1}`,
+			wantBody: func(sc trace.SpanContext) any {
+				return map[string]any{
+					"id":                     1.0,
+					"otelpubsub.propagation": map[string]any{"traceparent": traceparentOf(sc)},
+					"otelpubsub.envelope":    1.0,
+				}
+			},
+			wantDecision: "full",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var gotInput *sqs.SendMessageInput
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				defer r.Body.Close()
+				gotInput = new(sqs.SendMessageInput)
+				if err := json.NewDecoder(r.Body).Decode(gotInput); err != nil {
+					t.Errorf("failed to decode request body: %s", err)
+				}
+			}))
+			t.Cleanup(srv.Close)
+			exporter := tracetest.NewInMemoryExporter()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+			cfg := aws.Config{
+				Region:       "us-east-1",
+				Credentials:  staticCredentials("id", "secret", "token"),
+				BaseEndpoint: &srv.URL,
+			}
+			pub.AppendMiddlewares(&cfg.APIOptions, pub.WithTracerProvider(tp), pub.WithPropagator(propagation.TraceContext{}), pub.WithBodyEnvelope(tc.mode))
+			client := sqs.NewFromConfig(cfg)
+
+			input := &sqs.SendMessageInput{
+				QueueUrl:          utils.Ptr("https://sqs.us-east-1.amazonaws.com/1234567890123/queue-1"),
+				MessageBody:       utils.Ptr(tc.body),
+				MessageAttributes: userAttributes(tc.numAttrs),
+			}
+			if _, err := client.SendMessage(t.Context(), input); err != nil {
+				t.Fatal(err)
+			}
+			spans := exporter.GetSpans()
+			if len(spans) != 1 {
+				t.Fatalf("got %d spans, want 1", len(spans))
+			}
+			if diff := cmp.Diff(tc.wantBody(spans[0].SpanContext), decodeBody(deref(gotInput.MessageBody))); diff != "" {
+				t.Errorf("body (-want, +got):\n%s", diff)
+			}
+			if got := deref(input.MessageBody); got != tc.body {
+				t.Errorf("input body is modified: %q", got)
+			}
+			gotAttrs := attribute.NewSet(spans[0].Attributes...)
+			gotDecision, _ := gotAttrs.Value("otelpubsub.injection.decision")
+			if gotDecision.AsString() != tc.wantDecision {
+				t.Errorf("decision: want=%q got=%q", tc.wantDecision, gotDecision.AsString())
+			}
+		})
+	}
+}
+
+func TestMiddleware_bodyEnvelope_batch(t *testing.T) {
+	t.Parallel()
+
+	var gotInput *sqs.SendMessageBatchInput
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		gotInput = new(sqs.SendMessageBatchInput)
+		if err := json.NewDecoder(r.Body).Decode(gotInput); err != nil {
+			t.Errorf("failed to decode request body: %s", err)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	cfg := aws.Config{
+		Region:       "us-east-1",
+		Credentials:  staticCredentials("id", "secret", "token"),
+		BaseEndpoint: &srv.URL,
+	}
+	pub.AppendMiddlewares(&cfg.APIOptions, pub.WithTracerProvider(tp), pub.WithPropagator(propagation.TraceContext{}), pub.WithBodyEnvelope(pub.BodyEnvelopeModeFallback))
+	client := sqs.NewFromConfig(cfg)
+
+	input := &sqs.SendMessageBatchInput{
+		QueueUrl: utils.Ptr("https://sqs.us-east-1.amazonaws.com/1234567890123/queue-1"),
+		Entries: []types.SendMessageBatchRequestEntry{
+			{Id: utils.Ptr("1"), MessageBody: utils.Ptr("msg-1")},
+			{Id: utils.Ptr("2"), MessageBody: utils.Ptr("msg-2"), MessageAttributes: userAttributes(10)},
+		},
+	}
+	if _, err := client.SendMessageBatch(t.Context(), input); err != nil {
+		t.Fatal(err)
+	}
+	spans := exporter.GetSpans()
+	if len(spans) != 3 {
+		t.Fatalf("got %d spans, want 3", len(spans))
+	}
+	want := []any{
+		"msg-1",
+		map[string]any{
+			"otelpubsub.body":        "msg-2",
+			"otelpubsub.propagation": map[string]any{"traceparent": traceparentOf(spans[2].SpanContext)},
+			"otelpubsub.envelope":    1.0,
+		},
+	}
+	got := make([]any, 0, len(gotInput.Entries))
+	for _, entry := range gotInput.Entries {
+		got = append(got, decodeBody(deref(entry.MessageBody)))
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("bodies (-want, +got):\n%s", diff)
+	}
+}
+
+// decodeBody returns the body decoded as a JSON object, or the body as is.
+func decodeBody(body string) any {
+	var object map[string]any
+	if err := json.Unmarshal([]byte(body), &object); err != nil {
+		return body
+	}
+	return object
+}
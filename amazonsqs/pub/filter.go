@@ -0,0 +1,17 @@
+package pub
+
+import "go.opentelemetry.io/otel/trace"
+
+// DestinationFilter reports whether the trace context should be injected into the messages sent to the queue.
+type DestinationFilter func(queueURL string) bool
+
+// skipDecision returns the decision to skip injection regardless of the message, or empty if the message should be injected.
+func (i *instrumenter) skipDecision(queueURL string, sc trace.SpanContext) injectionDecision {
+	if i.destinationFilter != nil && !i.destinationFilter(queueURL) {
+		return injectionDecisionFiltered
+	}
+	if i.sampledOnly && !sc.IsSampled() {
+		return injectionDecisionUnsampled
+	}
+	return ""
+}
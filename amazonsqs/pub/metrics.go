@@ -0,0 +1,110 @@
+package pub
+
+import (
+	"context"
+	"time"
+
+	"github.com/aereal/otelpubsub/amazonsqs/internal/utils"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.39.0"
+	"go.opentelemetry.io/otel/semconv/v1.39.0/messagingconv"
+)
+
+const (
+	meterName = tracerName
+
+	// metricNameMessageBodySize is the name of the histogram of the message body size.
+	// The messaging semantic conventions have no such metric, so it is named after the library.
+	metricNameMessageBodySize = "otelpubsub.message.body.size"
+	// metricNameInjectionSkipped is the name of the counter of the messages sent without trace context
+	// because of the destination filter or the sampling decision.
+	metricNameInjectionSkipped = "otelpubsub.injection.skipped"
+)
+
+type metrics struct {
+	sentMessages      messagingconv.ClientSentMessages
+	operationDuration messagingconv.ClientOperationDuration
+	bodySize          metric.Int64Histogram
+	injectionSkipped  metric.Int64Counter
+}
+
+// newMetrics creates the instruments.
+// Errors are passed to [otel.Handle] and the failed instruments fall back to no-op ones.
+func newMetrics(mp metric.MeterProvider) *metrics {
+	meter := mp.Meter(meterName)
+	m := &metrics{}
+	var err error
+	if m.sentMessages, err = messagingconv.NewClientSentMessages(meter); err != nil {
+		otel.Handle(err)
+	}
+	if m.operationDuration, err = messagingconv.NewClientOperationDuration(meter); err != nil {
+		otel.Handle(err)
+	}
+	if m.bodySize, err = meter.Int64Histogram(metricNameMessageBodySize,
+		metric.WithDescription("Size of the message body."),
+		metric.WithUnit("By"),
+	); err != nil {
+		otel.Handle(err)
+	}
+	if m.injectionSkipped, err = meter.Int64Counter(metricNameInjectionSkipped,
+		metric.WithDescription("Number of messages sent without trace context because of the destination filter or the sampling decision."),
+		metric.WithUnit("{message}"),
+	); err != nil {
+		otel.Handle(err)
+	}
+	return m
+}
+
+// recordOperation records the duration of the send operation to the queue.
+func (m *metrics) recordOperation(ctx context.Context, queueURL string, duration time.Duration, err error) {
+	attrs := []attribute.KeyValue{m.operationDuration.AttrOperationType(messagingconv.OperationTypeSend)}
+	if queueName := utils.QueueNameOf(queueURL); queueName != "" {
+		attrs = append(attrs, m.operationDuration.AttrDestinationName(queueName))
+	}
+	if err != nil {
+		attrs = append(attrs, errorType(err))
+	}
+	m.operationDuration.Record(ctx, duration.Seconds(), operationSend.name, messagingconv.SystemAWSSQS, attrs...)
+}
+
+// addSentMessages counts n messages sent to the queue.
+// errType is empty if the messages are sent successfully.
+func (m *metrics) addSentMessages(ctx context.Context, queueURL string, n int, errType string) {
+	if n == 0 {
+		return
+	}
+	var attrs []attribute.KeyValue
+	if queueName := utils.QueueNameOf(queueURL); queueName != "" {
+		attrs = append(attrs, m.sentMessages.AttrDestinationName(queueName))
+	}
+	if errType != "" {
+		attrs = append(attrs, m.sentMessages.AttrErrorType(messagingconv.ErrorTypeAttr(errType)))
+	}
+	m.sentMessages.Add(ctx, int64(n), operationSend.name, messagingconv.SystemAWSSQS, attrs...)
+}
+
+// recordBodySize records the size of the message body sent to the queue in bytes.
+func (m *metrics) recordBodySize(ctx context.Context, queueURL string, body *string) {
+	attrs := []attribute.KeyValue{
+		semconv.MessagingSystemAWSSQS,
+		semconv.MessagingOperationName(operationSend.name),
+	}
+	if queueName := utils.QueueNameOf(queueURL); queueName != "" {
+		attrs = append(attrs, semconv.MessagingDestinationName(queueName))
+	}
+	m.bodySize.Record(ctx, int64(len(deref(body))), metric.WithAttributes(attrs...))
+}
+
+// addInjectionSkipped counts a message sent to the queue without trace context because of the decision.
+func (m *metrics) addInjectionSkipped(ctx context.Context, queueURL string, decision injectionDecision) {
+	attrs := []attribute.KeyValue{
+		semconv.MessagingSystemAWSSQS,
+		decision.attribute(),
+	}
+	if queueName := utils.QueueNameOf(queueURL); queueName != "" {
+		attrs = append(attrs, semconv.MessagingDestinationName(queueName))
+	}
+	m.injectionSkipped.Add(ctx, 1, metric.WithAttributes(attrs...))
+}
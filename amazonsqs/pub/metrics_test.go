@@ -0,0 +1,113 @@
+package pub_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aereal/otelpubsub/amazonsqs/internal/utils"
+	"github.com/aereal/otelpubsub/amazonsqs/pub"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata/metricdatatest"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestMiddleware_metrics(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get("X-Amz-Target") {
+		case "AmazonSQS.SendMessage":
+			_, _ = io.WriteString(w, `{"MessageId":"msg-1"}`)
+		case "AmazonSQS.SendMessageBatch":
+			_, _ = io.WriteString(w, `{"Successful":[{"Id":"1","MessageId":"msg-1"}],"Failed":[{"Id":"2","Code":"InvalidParameterValue","SenderFault":true,"Message":"invalid message"}]}`)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(tracetest.NewInMemoryExporter()))
+	cfg := aws.Config{
+		Region:       "us-east-1",
+		Credentials:  staticCredentials("id", "secret", "token"),
+		BaseEndpoint: &srv.URL,
+	}
+	pub.AppendMiddlewares(&cfg.APIOptions, pub.WithTracerProvider(tp), pub.WithMeterProvider(mp), pub.WithPropagator(propagation.TraceContext{}))
+	client := sqs.NewFromConfig(cfg)
+
+	queueURL := utils.Ptr("https://sqs.us-east-1.amazonaws.com/1234567890123/queue-1")
+	if _, err := client.SendMessage(t.Context(), &sqs.SendMessageInput{QueueUrl: queueURL, MessageBody: utils.Ptr("hello")}); err != nil {
+		t.Fatal(err)
+	}
+	batchInput := &sqs.SendMessageBatchInput{
+		QueueUrl: queueURL,
+		Entries: []types.SendMessageBatchRequestEntry{
+			{Id: utils.Ptr("1"), MessageBody: utils.Ptr("msg-1")},
+			{Id: utils.Ptr("2"), MessageBody: utils.Ptr("msg-2")},
+		},
+	}
+	if _, err := client.SendMessageBatch(t.Context(), batchInput); err != nil {
+		t.Fatal(err)
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(t.Context(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	if len(rm.ScopeMetrics) != 1 {
+		t.Fatalf("got %d scope metrics, want 1", len(rm.ScopeMetrics))
+	}
+	got := map[string]metricdata.Metrics{}
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		got[m.Name] = m
+	}
+
+	baseAttrs := []attribute.KeyValue{
+		attribute.String("messaging.system", "aws_sqs"),
+		attribute.String("messaging.operation.name", "send"),
+		attribute.String("messaging.destination.name", "queue-1"),
+	}
+	wantSentMessages := metricdata.Metrics{
+		Name:        "messaging.client.sent.messages",
+		Description: "Number of messages producer attempted to send to the broker.",
+		Unit:        "{message}",
+		Data: metricdata.Sum[int64]{
+			Temporality: metricdata.CumulativeTemporality,
+			IsMonotonic: true,
+			DataPoints: []metricdata.DataPoint[int64]{
+				{Attributes: attribute.NewSet(baseAttrs...), Value: 2},
+				{Attributes: attribute.NewSet(append(baseAttrs, attribute.String("error.type", "InvalidParameterValue"))...), Value: 1},
+			},
+		},
+	}
+	metricdatatest.AssertEqual(t, wantSentMessages, got["messaging.client.sent.messages"], metricdatatest.IgnoreTimestamp(), metricdatatest.IgnoreExemplars())
+
+	wantDuration := metricdata.Metrics{
+		Name:        "messaging.client.operation.duration",
+		Description: "Duration of messaging operation initiated by a producer or consumer client.",
+		Unit:        "s",
+		Data: metricdata.Histogram[float64]{
+			Temporality: metricdata.CumulativeTemporality,
+			DataPoints: []metricdata.HistogramDataPoint[float64]{
+				{Attributes: attribute.NewSet(append(baseAttrs, attribute.String("messaging.operation.type", "send"))...), Count: 2},
+			},
+		},
+	}
+	metricdatatest.AssertEqual(t, wantDuration, got["messaging.client.operation.duration"], metricdatatest.IgnoreTimestamp(), metricdatatest.IgnoreExemplars(), metricdatatest.IgnoreValue())
+
+	bodySize, ok := got["otelpubsub.message.body.size"].Data.(metricdata.Histogram[int64])
+	if !ok || len(bodySize.DataPoints) != 1 {
+		t.Fatalf("unexpected body size data: %#v", got["otelpubsub.message.body.size"].Data)
+	}
+	if dp := bodySize.DataPoints[0]; dp.Count != 3 || dp.Sum != int64(len("hello")+len("msg-1")+len("msg-2")) {
+		t.Errorf("body size: count=%d sum=%d", dp.Count, dp.Sum)
+	}
+}
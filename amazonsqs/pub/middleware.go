@@ -2,54 +2,360 @@ package pub
 
 import (
 	"context"
+	"errors"
+	"maps"
+	"time"
 
-	"github.com/aereal/otelpubsub/amazonsqs/internal"
+	"github.com/aereal/otelpubsub/amazonsqs/internal/utils"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/smithy-go"
 	"github.com/aws/smithy-go/middleware"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.39.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// AppendMiddlewares registers a middleware that injects trace context into SQS message attributes
-// before SendMessage and SendMessageBatch API calls.
+const tracerName = "github.com/aereal/otelpubsub/amazonsqs/pub"
+
+// AppendMiddlewares registers a middleware that starts a PRODUCER span and injects its trace context into SQS message attributes
+// before SendMessage API calls.
+// For SendMessageBatch API calls it starts a "create" span for each entry, injects each span's trace context into the entry,
+// and starts a "send" span linked to all of them.
+// Calls that succeed or fail after retries record each attempt as an event on the send span.
 // Pass the APIOptions field from [sqs.Options] to this function.
-func AppendMiddlewares(apiOptions *[]func(*middleware.Stack) error) {
+// By default the global TracerProvider and TextMapPropagator are used, falling back to W3C Trace Context and Baggage
+// while no global TextMapPropagator is set; see [AppendMiddlewaresOption] to override them.
+func AppendMiddlewares(apiOptions *[]func(*middleware.Stack) error, opts ...AppendMiddlewaresOption) {
+	cfg := newConfig(opts)
+	inst := &instrumenter{
+		tracer:                     cfg.tracerProvider.Tracer(tracerName),
+		propagator:                 cfg.propagator,
+		budgetPolicy:               cfg.budgetPolicy,
+		packedEncoding:             cfg.packedEncoding,
+		xrayTraceHeaderMode:        cfg.xrayTraceHeaderMode,
+		metrics:                    newMetrics(cfg.meterProvider),
+		existingTraceContextPolicy: cfg.existingTraceContextPolicy,
+		attributeProducers:         cfg.attributeProducers,
+		bodyEnvelopeMode:           cfg.bodyEnvelopeMode,
+		destinationFilter:          cfg.destinationFilter,
+		sampledOnly:                cfg.sampledOnly,
+		injectionPlacement:         cfg.injectionPlacement,
+		offloading:                 cfg.offloading,
+	}
 	*apiOptions = append(*apiOptions, func(stack *middleware.Stack) error {
-		return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("InstrumentPub", instrumentPublish), middleware.Before)
+		if err := stack.Initialize.Add(middleware.InitializeMiddlewareFunc("InstrumentPub", inst.instrumentPublish), middleware.Before); err != nil {
+			return err
+		}
+		if err := addTrackAttempt(stack); err != nil {
+			return err
+		}
+		if cfg.injectionPlacement == InjectionPlacementSerialize {
+			return stack.Serialize.Add(middleware.SerializeMiddlewareFunc("InjectPub", inst.injectSerialize), middleware.Before)
+		}
+		return nil
 	})
+	if cfg.preflightValidation {
+		*apiOptions = append(*apiOptions, func(stack *middleware.Stack) error {
+			if cfg.injectionPlacement == InjectionPlacementSerialize {
+				return stack.Serialize.Insert(middleware.SerializeMiddlewareFunc("ValidatePub", validateSerialize), "InjectPub", middleware.After)
+			}
+			return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("ValidatePub", validate), middleware.After)
+		})
+	}
 }
 
-func instrumentPublish(ctx context.Context, input middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+type instrumenter struct {
+	tracer                     trace.Tracer
+	propagator                 propagation.TextMapPropagator
+	budgetPolicy               AttributeBudgetPolicy
+	packedEncoding             PackedEncoding
+	xrayTraceHeaderMode        XRayTraceHeaderMode
+	metrics                    *metrics
+	existingTraceContextPolicy ExistingTraceContextPolicy
+	attributeProducers         []SQSSendSpanAttributeProducer
+	bodyEnvelopeMode           BodyEnvelopeMode
+	destinationFilter          DestinationFilter
+	sampledOnly                bool
+	injectionPlacement         InjectionPlacement
+	offloading                 *offloading
+}
+
+func (i *instrumenter) instrumentPublish(ctx context.Context, input middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
 	switch params := input.Parameters.(type) {
 	case *sqs.SendMessageInput:
-		mas := params.MessageAttributes
+		return i.instrumentSendMessage(ctx, params, input, next)
+	case *sqs.SendMessageBatchInput:
+		return i.instrumentSendMessageBatch(ctx, params, input, next)
+	default:
+		return next.HandleInitialize(ctx, input)
+	}
+}
+
+func (i *instrumenter) instrumentSendMessage(ctx context.Context, params *sqs.SendMessageInput, input middleware.InitializeInput, next middleware.InitializeHandler) (_ middleware.InitializeOutput, _ middleware.Metadata, err error) {
+	params = cloneInput(params)
+	input.Parameters = params
+
+	queueURL := deref(params.QueueUrl)
+	ctx, span := i.startSpan(ctx, operationSend, queueURL, trace.WithSpanKind(trace.SpanKindProducer))
+	defer func() { endSpan(span, err) }()
+
+	if offloadErr := i.offloadSendMessage(ctx, params); offloadErr != nil {
+		return middleware.InitializeOutput{}, middleware.Metadata{}, offloadErr
+	}
+	if i.injectionPlacement == InjectionPlacementInitialize {
+		if injectErr := i.injectSendMessage(ctx, span, params); injectErr != nil {
+			return middleware.InitializeOutput{}, middleware.Metadata{}, injectErr
+		}
+	}
+
+	i.metrics.recordBodySize(ctx, queueURL, params.MessageBody)
+	ctx, tracker := withAttemptTracker(ctx)
+	startedAt := time.Now()
+	out, md, err := next.HandleInitialize(ctx, input)
+	recordAttempts(span, tracker, md)
+	i.metrics.recordOperation(ctx, queueURL, time.Since(startedAt), err)
+	i.metrics.addSentMessages(ctx, queueURL, 1, errorTypeOf(err))
+	res, _ := out.Result.(*sqs.SendMessageOutput)
+	if res != nil && res.MessageId != nil {
+		span.SetAttributes(semconv.MessagingMessageID(*res.MessageId))
+	}
+	i.produceSendAttributes(span, params, res)
+	return out, md, err
+}
+
+// instrumentSendMessageBatch starts a "create" span for each entry and injects its trace context into the entry,
+// then starts a "send" span linked to all of the "create" spans.
+// Entries reported as failed in the output mark their "create" spans as errors.
+func (i *instrumenter) instrumentSendMessageBatch(ctx context.Context, params *sqs.SendMessageBatchInput, input middleware.InitializeInput, next middleware.InitializeHandler) (_ middleware.InitializeOutput, _ middleware.Metadata, err error) {
+	params = cloneInput(params)
+	input.Parameters = params
+
+	queueURL := deref(params.QueueUrl)
+	entries := make([]types.SendMessageBatchRequestEntry, 0, len(params.Entries))
+	createSpans := make([]trace.Span, 0, len(params.Entries))
+	createSpanByID := make(map[string]trace.Span, len(params.Entries))
+	links := make([]trace.Link, 0, len(params.Entries))
+	defer func() {
+		for _, createSpan := range createSpans {
+			endSpan(createSpan, err)
+		}
+	}()
+	createCtxs := make([]context.Context, 0, len(params.Entries))
+	for _, original := range params.Entries {
+		entry := cloneEntry(original)
+		if entry.MessageAttributes == nil {
+			entry.MessageAttributes = map[string]types.MessageAttributeValue{}
+		}
+		entryID := deref(entry.Id)
+		createCtx, createSpan := i.startSpan(ctx, operationCreate, queueURL,
+			trace.WithSpanKind(trace.SpanKindProducer),
+			trace.WithAttributes(attrKeyBatchEntryID.String(entryID)),
+		)
+		createCtxs = append(createCtxs, createCtx)
+		createSpans = append(createSpans, createSpan)
+		createSpanByID[entryID] = createSpan
+		links = append(links, trace.Link{SpanContext: createSpan.SpanContext()})
+		entries = append(entries, entry)
+	}
+	if offloadErr := i.offloadBatchEntries(createCtxs, queueURL, entries); offloadErr != nil {
+		return middleware.InitializeOutput{}, middleware.Metadata{}, offloadErr
+	}
+	for k := range entries {
+		if injectErr := i.injectBatchEntry(createCtxs[k], createSpans[k], queueURL, &entries[k]); injectErr != nil {
+			return middleware.InitializeOutput{}, middleware.Metadata{}, injectErr
+		}
+	}
+	params.Entries = entries
+
+	ctx, span := i.startSpan(ctx, operationSend, queueURL,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithLinks(links...),
+		trace.WithAttributes(semconv.MessagingBatchMessageCount(len(entries))),
+	)
+	defer func() { endSpan(span, err) }()
+
+	for _, entry := range entries {
+		i.metrics.recordBodySize(ctx, queueURL, entry.MessageBody)
+	}
+	ctx, tracker := withAttemptTracker(ctx)
+	startedAt := time.Now()
+	out, md, err := next.HandleInitialize(ctx, input)
+	recordAttempts(span, tracker, md)
+	i.metrics.recordOperation(ctx, queueURL, time.Since(startedAt), err)
+	if err != nil {
+		i.metrics.addSentMessages(ctx, queueURL, len(entries), errorTypeOf(err))
+	}
+	res, _ := out.Result.(*sqs.SendMessageBatchOutput)
+	if res != nil {
+		i.metrics.addSentMessages(ctx, queueURL, len(res.Successful), "")
+		for _, entry := range res.Failed {
+			i.metrics.addSentMessages(ctx, queueURL, 1, deref(entry.Code))
+		}
+		for _, entry := range res.Successful {
+			if createSpan, ok := createSpanByID[deref(entry.Id)]; ok && entry.MessageId != nil {
+				createSpan.SetAttributes(semconv.MessagingMessageID(*entry.MessageId))
+			}
+		}
+		for _, entry := range res.Failed {
+			if createSpan, ok := createSpanByID[deref(entry.Id)]; ok {
+				createSpan.SetStatus(codes.Error, deref(entry.Message))
+				createSpan.SetAttributes(
+					semconv.ErrorTypeKey.String(deref(entry.Code)),
+					attrKeyBatchSenderFault.Bool(entry.SenderFault),
+				)
+			}
+		}
+		span.SetAttributes(attrKeyBatchFailedCount.Int(len(res.Failed)))
+	}
+	i.produceBatchEntryAttributes(createSpans, params, res)
+	return out, md, err
+}
+
+// injectSendMessage injects the trace context of the span into the message and records the decision on the span.
+func (i *instrumenter) injectSendMessage(ctx context.Context, span trace.Span, params *sqs.SendMessageInput) error {
+	queueURL := deref(params.QueueUrl)
+	if decision := i.skipDecision(queueURL, span.SpanContext()); decision != "" {
+		span.SetAttributes(decision.attribute())
+		i.metrics.addInjectionSkipped(ctx, queueURL, decision)
+		return nil
+	}
+	if i.xrayTraceHeaderMode != XRayTraceHeaderModeNone {
+		params.MessageSystemAttributes = withTraceHeader(params.MessageSystemAttributes, span.SpanContext())
+	}
+	var decision injectionDecision
+	if i.xrayTraceHeaderMode != XRayTraceHeaderModeOnly {
+		mas := maps.Clone(params.MessageAttributes)
 		if mas == nil {
 			mas = map[string]types.MessageAttributeValue{}
 		}
-		internal.Propagator.Inject(ctx, NewMessageAttributeCarrier(mas))
+		var err error
+		if decision, err = i.inject(ctx, "", mas); err != nil {
+			return err
+		}
 		params.MessageAttributes = mas
-		input.Parameters = params
-	case *sqs.SendMessageBatchInput:
-		entries := make([]types.SendMessageBatchRequestEntry, 0, len(params.Entries))
-		for _, original := range params.Entries {
-			entry := cloneEntry(original)
-			if entry.MessageAttributes == nil {
-				entry.MessageAttributes = map[string]types.MessageAttributeValue{}
-			}
-			internal.Propagator.Inject(ctx, NewMessageAttributeCarrier(entry.MessageAttributes))
-			entries = append(entries, entry)
+	}
+	body, decision, err := i.injectBody(ctx, params.MessageBody, decision)
+	if err != nil {
+		return err
+	}
+	params.MessageBody = body
+	if decision != "" {
+		span.SetAttributes(decision.attribute())
+	}
+	return nil
+}
+
+// injectBatchEntry injects the trace context of the "create" span into the entry and records the decision on the span.
+// The message attributes of the entry must be already cloned.
+func (i *instrumenter) injectBatchEntry(ctx context.Context, span trace.Span, queueURL string, entry *types.SendMessageBatchRequestEntry) error {
+	if decision := i.skipDecision(queueURL, span.SpanContext()); decision != "" {
+		span.SetAttributes(decision.attribute())
+		i.metrics.addInjectionSkipped(ctx, queueURL, decision)
+		return nil
+	}
+	if i.xrayTraceHeaderMode != XRayTraceHeaderModeNone {
+		entry.MessageSystemAttributes = withTraceHeader(entry.MessageSystemAttributes, span.SpanContext())
+	}
+	var decision injectionDecision
+	if i.xrayTraceHeaderMode != XRayTraceHeaderModeOnly {
+		var err error
+		if decision, err = i.inject(ctx, deref(entry.Id), entry.MessageAttributes); err != nil {
+			return err
 		}
-		params.Entries = entries
-		input.Parameters = params
 	}
-	return next.HandleInitialize(ctx, input)
+	body, decision, err := i.injectBody(ctx, entry.MessageBody, decision)
+	if err != nil {
+		return err
+	}
+	entry.MessageBody = body
+	if decision != "" {
+		span.SetAttributes(decision.attribute())
+	}
+	return nil
+}
+
+var (
+	attrKeyBatchSenderFault = attribute.Key("otelpubsub.batch.sender_fault")
+	attrKeyBatchFailedCount = attribute.Key("otelpubsub.batch.failed_count")
+)
+
+type operation struct {
+	name          string
+	operationType attribute.KeyValue
+}
+
+var (
+	operationSend   = operation{name: "send", operationType: semconv.MessagingOperationTypeSend}
+	operationCreate = operation{name: "create", operationType: semconv.MessagingOperationTypeCreate}
+)
+
+func (i *instrumenter) startSpan(ctx context.Context, op operation, queueURL string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{
+		semconv.MessagingSystemAWSSQS,
+		op.operationType,
+		semconv.MessagingOperationName(op.name),
+	}
+	spanName := op.name
+	if queueURL != "" {
+		attrs = append(attrs, semconv.AWSSQSQueueURL(queueURL))
+	}
+	if queueName := utils.QueueNameOf(queueURL); queueName != "" {
+		attrs = append(attrs, semconv.MessagingDestinationName(queueName))
+		spanName += " " + queueName
+	}
+	return i.tracer.Start(ctx, spanName, append(opts, trace.WithAttributes(attrs...))...)
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "")
+		span.SetAttributes(errorType(err))
+	}
+	span.End()
+}
+
+func errorType(err error) attribute.KeyValue {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() != "" {
+		return semconv.ErrorTypeKey.String(apiErr.ErrorCode())
+	}
+	return semconv.ErrorType(err)
+}
+
+// errorTypeOf returns the value of [errorType] or an empty string if err is nil.
+func errorTypeOf(err error) string {
+	if err == nil {
+		return ""
+	}
+	return errorType(err).Value.AsString()
+}
+
+func deref[V any](ptr *V) V {
+	var zero V
+	if ptr == nil {
+		return zero
+	}
+	return *ptr
+}
+
+// cloneInput returns a shallow copy of the input to inject the trace context into,
+// so that the caller can reuse the input concurrently or across retries.
+func cloneInput[T any](params *T) *T {
+	cloned := *params
+	return &cloned
 }
 
+// cloneEntry is the [cloneInput] for a batch entry, which also clones the message attributes.
 func cloneEntry(original types.SendMessageBatchRequestEntry) types.SendMessageBatchRequestEntry {
 	return types.SendMessageBatchRequestEntry{
 		Id:                      original.Id,
 		MessageBody:             original.MessageBody,
 		DelaySeconds:            original.DelaySeconds,
-		MessageAttributes:       original.MessageAttributes,
+		MessageAttributes:       maps.Clone(original.MessageAttributes),
 		MessageDeduplicationId:  original.MessageDeduplicationId,
 		MessageGroupId:          original.MessageGroupId,
 		MessageSystemAttributes: original.MessageSystemAttributes,
@@ -4,18 +4,24 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"sync"
 	"testing"
 
 	"github.com/aereal/otelpubsub/amazonsqs/internal/utils"
 	"github.com/aereal/otelpubsub/amazonsqs/pub"
+	pubsemconv "github.com/aereal/otelpubsub/amazonsqs/pub/semconv/v1.39.0"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/sdk/instrumentation"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
@@ -36,6 +42,9 @@ type messageAttributeValue struct {
 func TestMiddleware_sendMessage(t *testing.T) {
 	t.Parallel()
 
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
 	var gotMsgAttrs map[string]messageAttributeValue
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer r.Body.Close()
@@ -51,6 +60,7 @@ func TestMiddleware_sendMessage(t *testing.T) {
 				Value:    *v.StringValue,
 			}
 		}
+		_, _ = io.WriteString(w, `{"MessageId":"msg-1"}`)
 	}))
 	t.Cleanup(srv.Close)
 	cfg := aws.Config{
@@ -58,12 +68,9 @@ func TestMiddleware_sendMessage(t *testing.T) {
 		Credentials:  staticCredentials("id", "secret", "token"),
 		BaseEndpoint: &srv.URL,
 	}
-	pub.AppendMiddlewares(&cfg.APIOptions)
+	pub.AppendMiddlewares(&cfg.APIOptions, pub.WithTracerProvider(tp), pub.WithPropagator(propagation.TraceContext{}))
 	client := sqs.NewFromConfig(cfg)
 
-	exporter := tracetest.NewInMemoryExporter()
-	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
-
 	input := &sqs.SendMessageInput{
 		QueueUrl:    utils.Ptr("arn:aws:sqs:us-east-1:1234567890123:queue-1"),
 		MessageBody: utils.Ptr("ptr"),
@@ -77,13 +84,41 @@ func TestMiddleware_sendMessage(t *testing.T) {
 	if err := tp.ForceFlush(t.Context()); err != nil {
 		t.Fatal(err)
 	}
+	gotSpans := exporter.GetSpans()
+	if len(gotSpans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(gotSpans))
+	}
 	wantMsgAttrs := map[string]messageAttributeValue{
-		"traceparent": {DataType: utils.DataTypeString, Value: fmt.Sprintf("00-%s-%s-01", span.SpanContext().TraceID(), span.SpanContext().SpanID())},
+		"traceparent": {DataType: utils.DataTypeString, Value: traceparentOf(gotSpans[0].SpanContext)},
 	}
 	if diff := cmp.Diff(wantMsgAttrs, gotMsgAttrs); diff != "" {
 		t.Errorf("message attributes (-want, +got):\n%s", diff)
 	}
 	wantSpans := []tracetest.SpanStub{
+		{
+			Name:        "send queue-1",
+			SpanContext: trace.NewSpanContext(trace.SpanContextConfig{TraceFlags: trace.FlagsSampled, TraceID: dummyTraceID, SpanID: dummySpanID}),
+			Parent:      trace.NewSpanContext(trace.SpanContextConfig{TraceFlags: trace.FlagsSampled, TraceID: dummyTraceID, SpanID: dummySpanID}),
+			SpanKind:    trace.SpanKindProducer,
+			Attributes: []attribute.KeyValue{
+				attribute.String("messaging.system", "aws_sqs"),
+				attribute.String("messaging.operation.type", "send"),
+				attribute.String("messaging.operation.name", "send"),
+				attribute.String("aws.sqs.queue.url", "arn:aws:sqs:us-east-1:1234567890123:queue-1"),
+				attribute.String("messaging.destination.name", "queue-1"),
+				attribute.String("otelpubsub.injection.decision", "full"),
+				attribute.String("messaging.message.id", "msg-1"),
+			},
+			Resource: resource.NewSchemaless(
+				attribute.String("service.name", "unknown_service:pub.test"),
+				attribute.String("telemetry.sdk.language", "go"),
+				attribute.String("telemetry.sdk.name", "opentelemetry"),
+				attribute.String("telemetry.sdk.version", "1.43.0"),
+			),
+			InstrumentationScope: instrumentation.Scope{
+				Name: "github.com/aereal/otelpubsub/amazonsqs/pub",
+			},
+		},
 		{
 			Name:        "parent",
 			SpanContext: trace.NewSpanContext(trace.SpanContextConfig{TraceFlags: trace.FlagsSampled, TraceID: dummyTraceID, SpanID: dummySpanID}),
@@ -94,12 +129,13 @@ func TestMiddleware_sendMessage(t *testing.T) {
 				attribute.String("telemetry.sdk.name", "opentelemetry"),
 				attribute.String("telemetry.sdk.version", "1.43.0"),
 			),
+			ChildSpanCount: 1,
 			InstrumentationScope: instrumentation.Scope{
 				Name: "test",
 			},
 		},
 	}
-	if diff := diffSpans(wantSpans, exporter.GetSpans()); diff != "" {
+	if diff := diffSpans(wantSpans, gotSpans); diff != "" {
 		t.Errorf("spans (-want, +got):\n%s", diff)
 	}
 }
@@ -107,6 +143,9 @@ func TestMiddleware_sendMessage(t *testing.T) {
 func TestMiddleware_sendMessageBatch(t *testing.T) {
 	t.Parallel()
 
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
 	gotMsgAttrs := map[string]map[string]messageAttributeValue{}
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer r.Body.Close()
@@ -126,6 +165,7 @@ func TestMiddleware_sendMessageBatch(t *testing.T) {
 			}
 			gotMsgAttrs[*entry.Id] = entryAttrs
 		}
+		_, _ = io.WriteString(w, `{"Successful":[{"Id":"1","MessageId":"msg-1"},{"Id":"2","MessageId":"msg-2"}]}`)
 	}))
 	t.Cleanup(srv.Close)
 	cfg := aws.Config{
@@ -133,12 +173,9 @@ func TestMiddleware_sendMessageBatch(t *testing.T) {
 		Credentials:  staticCredentials("id", "secret", "token"),
 		BaseEndpoint: &srv.URL,
 	}
-	pub.AppendMiddlewares(&cfg.APIOptions)
+	pub.AppendMiddlewares(&cfg.APIOptions, pub.WithTracerProvider(tp), pub.WithPropagator(propagation.TraceContext{}))
 	client := sqs.NewFromConfig(cfg)
 
-	exporter := tracetest.NewInMemoryExporter()
-	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
-
 	input := &sqs.SendMessageBatchInput{
 		QueueUrl: utils.Ptr("arn:aws:sqs:us-east-1:1234567890123:queue-1"),
 		Entries: []types.SendMessageBatchRequestEntry{
@@ -160,38 +197,317 @@ func TestMiddleware_sendMessageBatch(t *testing.T) {
 	if err := tp.ForceFlush(t.Context()); err != nil {
 		t.Fatal(err)
 	}
+	gotSpans := exporter.GetSpans()
+	if len(gotSpans) != 4 {
+		t.Fatalf("got %d spans, want 4", len(gotSpans))
+	}
+	sendSpan, createSpans := gotSpans[0], gotSpans[1:3]
 	wantMsgAttrs := map[string]map[string]messageAttributeValue{
 		"1": {
-			"traceparent": {DataType: utils.DataTypeString, Value: fmt.Sprintf("00-%s-%s-01", span.SpanContext().TraceID(), span.SpanContext().SpanID())},
+			"traceparent": {DataType: utils.DataTypeString, Value: traceparentOf(createSpans[0].SpanContext)},
 		},
 		"2": {
-			"traceparent": {DataType: utils.DataTypeString, Value: fmt.Sprintf("00-%s-%s-01", span.SpanContext().TraceID(), span.SpanContext().SpanID())},
+			"traceparent": {DataType: utils.DataTypeString, Value: traceparentOf(createSpans[1].SpanContext)},
 		},
 	}
 	if diff := cmp.Diff(wantMsgAttrs, gotMsgAttrs); diff != "" {
 		t.Errorf("message attributes (-want, +got):\n%s", diff)
 	}
+	for i, link := range sendSpan.Links {
+		if got, want := link.SpanContext.SpanID(), createSpans[i].SpanContext.SpanID(); got != want {
+			t.Errorf("link #%d: want=%s got=%s", i, want, got)
+		}
+	}
+	res := resource.NewSchemaless(
+		attribute.String("service.name", "unknown_service:pub.test"),
+		attribute.String("telemetry.sdk.language", "go"),
+		attribute.String("telemetry.sdk.name", "opentelemetry"),
+		attribute.String("telemetry.sdk.version", "1.43.0"),
+	)
 	wantSpans := []tracetest.SpanStub{
 		{
-			Name:        "parent",
+			Name:        "send queue-1",
 			SpanContext: trace.NewSpanContext(trace.SpanContextConfig{TraceFlags: trace.FlagsSampled, TraceID: dummyTraceID, SpanID: dummySpanID}),
-			SpanKind:    trace.SpanKindInternal,
-			Resource: resource.NewSchemaless(
-				attribute.String("service.name", "unknown_service:pub.test"),
-				attribute.String("telemetry.sdk.language", "go"),
-				attribute.String("telemetry.sdk.name", "opentelemetry"),
-				attribute.String("telemetry.sdk.version", "1.43.0"),
-			),
-			InstrumentationScope: instrumentation.Scope{
-				Name: "test",
+			Parent:      trace.NewSpanContext(trace.SpanContextConfig{TraceFlags: trace.FlagsSampled, TraceID: dummyTraceID, SpanID: dummySpanID}),
+			SpanKind:    trace.SpanKindClient,
+			Attributes: []attribute.KeyValue{
+				attribute.Int("messaging.batch.message_count", 2),
+				attribute.String("messaging.system", "aws_sqs"),
+				attribute.String("messaging.operation.type", "send"),
+				attribute.String("messaging.operation.name", "send"),
+				attribute.String("aws.sqs.queue.url", "arn:aws:sqs:us-east-1:1234567890123:queue-1"),
+				attribute.String("messaging.destination.name", "queue-1"),
+				attribute.Int("otelpubsub.batch.failed_count", 0),
 			},
+			Links: []sdktrace.Link{
+				{SpanContext: trace.NewSpanContext(trace.SpanContextConfig{TraceFlags: trace.FlagsSampled, TraceID: dummyTraceID, SpanID: dummySpanID})},
+				{SpanContext: trace.NewSpanContext(trace.SpanContextConfig{TraceFlags: trace.FlagsSampled, TraceID: dummyTraceID, SpanID: dummySpanID})},
+			},
+			Resource:             res,
+			InstrumentationScope: instrumentation.Scope{Name: "github.com/aereal/otelpubsub/amazonsqs/pub"},
+		},
+		{
+			Name:        "create queue-1",
+			SpanContext: trace.NewSpanContext(trace.SpanContextConfig{TraceFlags: trace.FlagsSampled, TraceID: dummyTraceID, SpanID: dummySpanID}),
+			Parent:      trace.NewSpanContext(trace.SpanContextConfig{TraceFlags: trace.FlagsSampled, TraceID: dummyTraceID, SpanID: dummySpanID}),
+			SpanKind:    trace.SpanKindProducer,
+			Attributes: []attribute.KeyValue{
+				attribute.String("otelpubsub.batch.entry_id", "1"),
+				attribute.String("messaging.system", "aws_sqs"),
+				attribute.String("messaging.operation.type", "create"),
+				attribute.String("messaging.operation.name", "create"),
+				attribute.String("aws.sqs.queue.url", "arn:aws:sqs:us-east-1:1234567890123:queue-1"),
+				attribute.String("messaging.destination.name", "queue-1"),
+				attribute.String("otelpubsub.injection.decision", "full"),
+				attribute.String("messaging.message.id", "msg-1"),
+			},
+			Resource:             res,
+			InstrumentationScope: instrumentation.Scope{Name: "github.com/aereal/otelpubsub/amazonsqs/pub"},
+		},
+		{
+			Name:        "create queue-1",
+			SpanContext: trace.NewSpanContext(trace.SpanContextConfig{TraceFlags: trace.FlagsSampled, TraceID: dummyTraceID, SpanID: dummySpanID}),
+			Parent:      trace.NewSpanContext(trace.SpanContextConfig{TraceFlags: trace.FlagsSampled, TraceID: dummyTraceID, SpanID: dummySpanID}),
+			SpanKind:    trace.SpanKindProducer,
+			Attributes: []attribute.KeyValue{
+				attribute.String("otelpubsub.batch.entry_id", "2"),
+				attribute.String("messaging.system", "aws_sqs"),
+				attribute.String("messaging.operation.type", "create"),
+				attribute.String("messaging.operation.name", "create"),
+				attribute.String("aws.sqs.queue.url", "arn:aws:sqs:us-east-1:1234567890123:queue-1"),
+				attribute.String("messaging.destination.name", "queue-1"),
+				attribute.String("otelpubsub.injection.decision", "full"),
+				attribute.String("messaging.message.id", "msg-2"),
+			},
+			Resource:             res,
+			InstrumentationScope: instrumentation.Scope{Name: "github.com/aereal/otelpubsub/amazonsqs/pub"},
+		},
+		{
+			Name:                 "parent",
+			SpanContext:          trace.NewSpanContext(trace.SpanContextConfig{TraceFlags: trace.FlagsSampled, TraceID: dummyTraceID, SpanID: dummySpanID}),
+			SpanKind:             trace.SpanKindInternal,
+			Resource:             res,
+			ChildSpanCount:       3,
+			InstrumentationScope: instrumentation.Scope{Name: "test"},
 		},
 	}
-	if diff := diffSpans(wantSpans, exporter.GetSpans()); diff != "" {
+	if diff := diffSpans(wantSpans, gotSpans); diff != "" {
 		t.Errorf("spans (-want, +got):\n%s", diff)
 	}
 }
 
+func TestMiddleware_sendMessageBatch_partialFailure(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `{"Successful":[{"Id":"1","MessageId":"msg-1"}],"Failed":[{"Id":"2","Code":"InvalidParameterValue","SenderFault":true,"Message":"invalid message"}]}`)
+	}))
+	t.Cleanup(srv.Close)
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	cfg := aws.Config{
+		Region:       "us-east-1",
+		Credentials:  staticCredentials("id", "secret", "token"),
+		BaseEndpoint: &srv.URL,
+	}
+	pub.AppendMiddlewares(&cfg.APIOptions, pub.WithTracerProvider(tp), pub.WithPropagator(propagation.TraceContext{}))
+	client := sqs.NewFromConfig(cfg)
+
+	input := &sqs.SendMessageBatchInput{
+		QueueUrl: utils.Ptr("https://sqs.us-east-1.amazonaws.com/1234567890123/queue-1"),
+		Entries: []types.SendMessageBatchRequestEntry{
+			{Id: utils.Ptr("1"), MessageBody: utils.Ptr("msg-1")},
+			{Id: utils.Ptr("2"), MessageBody: utils.Ptr("msg-2")},
+		},
+	}
+	if _, err := client.SendMessageBatch(t.Context(), input); err != nil {
+		t.Fatal(err)
+	}
+	spans := exporter.GetSpans()
+	if len(spans) != 3 {
+		t.Fatalf("got %d spans, want 3", len(spans))
+	}
+	batchAttrs := attribute.NewSet(spans[0].Attributes...)
+	if got, _ := batchAttrs.Value("otelpubsub.batch.failed_count"); got.AsInt64() != 1 {
+		t.Errorf("failed count: got=%d", got.AsInt64())
+	}
+	if got := spans[1].Status; got.Code != codes.Unset {
+		t.Errorf("succeeded entry status: got=%#v", got)
+	}
+	wantStatus := sdktrace.Status{Code: codes.Error, Description: "invalid message"}
+	if diff := cmp.Diff(wantStatus, spans[2].Status); diff != "" {
+		t.Errorf("failed entry status (-want, +got):\n%s", diff)
+	}
+	failedAttrs := attribute.NewSet(spans[2].Attributes...)
+	if got, _ := failedAttrs.Value("error.type"); got.AsString() != "InvalidParameterValue" {
+		t.Errorf("error.type: got=%q", got.AsString())
+	}
+	if got, _ := failedAttrs.Value("otelpubsub.batch.sender_fault"); !got.AsBool() {
+		t.Errorf("sender fault: got=%v", got.AsBool())
+	}
+}
+
+func TestMiddleware_sendMessage_concurrentReuse(t *testing.T) {
+	t.Parallel()
+
+	var mux sync.Mutex
+	gotTraceparents := map[string]struct{}{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		input := new(sqs.SendMessageInput)
+		if err := json.NewDecoder(r.Body).Decode(input); err != nil {
+			t.Errorf("failed to decode request body: %s", err)
+			return
+		}
+		mux.Lock()
+		defer mux.Unlock()
+		gotTraceparents[*input.MessageAttributes["traceparent"].StringValue] = struct{}{}
+	}))
+	t.Cleanup(srv.Close)
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(tracetest.NewInMemoryExporter()))
+	cfg := aws.Config{
+		Region:       "us-east-1",
+		Credentials:  staticCredentials("id", "secret", "token"),
+		BaseEndpoint: &srv.URL,
+	}
+	pub.AppendMiddlewares(&cfg.APIOptions, pub.WithTracerProvider(tp), pub.WithPropagator(propagation.TraceContext{}))
+	client := sqs.NewFromConfig(cfg)
+
+	input := &sqs.SendMessageInput{
+		QueueUrl:          utils.Ptr("https://sqs.us-east-1.amazonaws.com/1234567890123/queue-1"),
+		MessageBody:       utils.Ptr("body"),
+		MessageAttributes: map[string]types.MessageAttributeValue{"user": utils.StringAttributeValue("v")},
+	}
+	const concurrency = 8
+	var wg sync.WaitGroup
+	for range concurrency {
+		wg.Go(func() {
+			ctx, span := tp.Tracer("test").Start(t.Context(), "parent")
+			defer span.End()
+			if _, err := client.SendMessage(ctx, input); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	wg.Wait()
+
+	if got := len(gotTraceparents); got != concurrency {
+		t.Errorf("distinct traceparents: want=%d got=%d", concurrency, got)
+	}
+	wantAttrs := map[string]types.MessageAttributeValue{"user": utils.StringAttributeValue("v")}
+	if diff := cmp.Diff(wantAttrs, input.MessageAttributes, cmpopts.IgnoreUnexported(types.MessageAttributeValue{})); diff != "" {
+		t.Errorf("the input is modified (-want, +got):\n%s", diff)
+	}
+}
+
+func TestMiddleware_sendMessageBatch_concurrentReuse(t *testing.T) {
+	t.Parallel()
+
+	var mux sync.Mutex
+	gotTraceparents := map[string]struct{}{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		input := new(sqs.SendMessageBatchInput)
+		if err := json.NewDecoder(r.Body).Decode(input); err != nil {
+			t.Errorf("failed to decode request body: %s", err)
+			return
+		}
+		mux.Lock()
+		defer mux.Unlock()
+		for _, entry := range input.Entries {
+			gotTraceparents[*entry.MessageAttributes["traceparent"].StringValue] = struct{}{}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(tracetest.NewInMemoryExporter()))
+	cfg := aws.Config{
+		Region:       "us-east-1",
+		Credentials:  staticCredentials("id", "secret", "token"),
+		BaseEndpoint: &srv.URL,
+	}
+	pub.AppendMiddlewares(&cfg.APIOptions, pub.WithTracerProvider(tp), pub.WithPropagator(propagation.TraceContext{}))
+	client := sqs.NewFromConfig(cfg)
+
+	input := &sqs.SendMessageBatchInput{
+		QueueUrl: utils.Ptr("https://sqs.us-east-1.amazonaws.com/1234567890123/queue-1"),
+		Entries: []types.SendMessageBatchRequestEntry{
+			{Id: utils.Ptr("1"), MessageBody: utils.Ptr("msg-1"), MessageAttributes: map[string]types.MessageAttributeValue{"user": utils.StringAttributeValue("v")}},
+			{Id: utils.Ptr("2"), MessageBody: utils.Ptr("msg-2")},
+		},
+	}
+	const concurrency = 8
+	var wg sync.WaitGroup
+	for range concurrency {
+		wg.Go(func() {
+			ctx, span := tp.Tracer("test").Start(t.Context(), "parent")
+			defer span.End()
+			if _, err := client.SendMessageBatch(ctx, input); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	wg.Wait()
+
+	if got := len(gotTraceparents); got != concurrency*2 {
+		t.Errorf("distinct traceparents: want=%d got=%d", concurrency*2, got)
+	}
+	wantAttrs := map[string]types.MessageAttributeValue{"user": utils.StringAttributeValue("v")}
+	if diff := cmp.Diff(wantAttrs, input.Entries[0].MessageAttributes, cmpopts.IgnoreUnexported(types.MessageAttributeValue{})); diff != "" {
+		t.Errorf("the input is modified (-want, +got):\n%s", diff)
+	}
+	if input.Entries[1].MessageAttributes != nil {
+		t.Errorf("the input is modified: %#v", input.Entries[1].MessageAttributes)
+	}
+}
+
+func TestMiddleware_withAttributeProducers(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `{"Successful":[{"Id":"1","MessageId":"msg-1"},{"Id":"2","MessageId":"msg-2"}]}`)
+	}))
+	t.Cleanup(srv.Close)
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	cfg := aws.Config{
+		Region:       "us-east-1",
+		Credentials:  staticCredentials("id", "secret", "token"),
+		BaseEndpoint: &srv.URL,
+	}
+	pub.AppendMiddlewares(&cfg.APIOptions,
+		pub.WithTracerProvider(tp),
+		pub.WithPropagator(propagation.TraceContext{}),
+		pub.WithAttributeProducers(pubsemconv.SendSpanAttributeProducer{}),
+	)
+	client := sqs.NewFromConfig(cfg)
+
+	input := &sqs.SendMessageBatchInput{
+		QueueUrl: utils.Ptr("https://sqs.us-east-1.amazonaws.com/1234567890123/queue-1.fifo"),
+		Entries: []types.SendMessageBatchRequestEntry{
+			{Id: utils.Ptr("1"), MessageBody: utils.Ptr("msg-1"), MessageGroupId: utils.Ptr("group-1")},
+			{Id: utils.Ptr("2"), MessageBody: utils.Ptr("msg-2"), MessageGroupId: utils.Ptr("group-2")},
+		},
+	}
+	if _, err := client.SendMessageBatch(t.Context(), input); err != nil {
+		t.Fatal(err)
+	}
+	spans := exporter.GetSpans()
+	if len(spans) != 3 {
+		t.Fatalf("got %d spans, want 3", len(spans))
+	}
+	want := map[string]string{"1": "group-1", "2": "group-2"}
+	got := map[string]string{}
+	for _, span := range spans[1:] {
+		attrs := attribute.NewSet(span.Attributes...)
+		entryID, _ := attrs.Value("otelpubsub.batch.entry_id")
+		groupID, _ := attrs.Value("aws.sqs.message.group_id")
+		got[entryID.AsString()] = groupID.AsString()
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("group IDs by entry ID (-want, +got):\n%s", diff)
+	}
+}
+
 func diffSpans(want, got []tracetest.SpanStub) string {
 	return cmp.Diff(want, got,
 		cmpopts.IgnoreFields(
@@ -202,6 +518,9 @@ func diffSpans(want, got []tracetest.SpanStub) string {
 		cmp.Comparer(func(a, b attribute.Set) bool {
 			return a.Equals(&b)
 		}),
+		cmp.Comparer(func(a, b attribute.Value) bool {
+			return a.Type() == b.Type() && a.Emit() == b.Emit()
+		}),
 		cmp.Comparer(func(a, b *resource.Resource) bool {
 			return a.Equal(b)
 		}),
@@ -215,6 +534,124 @@ func diffSpans(want, got []tracetest.SpanStub) string {
 	)
 }
 
+func TestMiddleware_sendMessage_withPropagator(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+		opts []pub.AppendMiddlewaresOption
+	}{
+		{name: "specified", opts: []pub.AppendMiddlewaresOption{pub.WithPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))}},
+		// no global propagator is set in the tests
+		{name: "default falls back to trace context and baggage"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var gotMsgAttrs map[string]messageAttributeValue
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				defer r.Body.Close()
+				input := new(sqs.SendMessageInput)
+				if err := json.NewDecoder(r.Body).Decode(input); err != nil {
+					t.Errorf("failed to decode request body: %s", err)
+					return
+				}
+				gotMsgAttrs = map[string]messageAttributeValue{}
+				for k, v := range input.MessageAttributes {
+					gotMsgAttrs[k] = messageAttributeValue{
+						DataType: *v.DataType,
+						Value:    *v.StringValue,
+					}
+				}
+			}))
+			t.Cleanup(srv.Close)
+			cfg := aws.Config{
+				Region:       "us-east-1",
+				Credentials:  staticCredentials("id", "secret", "token"),
+				BaseEndpoint: &srv.URL,
+			}
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(tracetest.NewInMemoryExporter()))
+			pub.AppendMiddlewares(&cfg.APIOptions, append([]pub.AppendMiddlewaresOption{pub.WithTracerProvider(tp)}, tc.opts...)...)
+			client := sqs.NewFromConfig(cfg)
+
+			member, err := baggage.NewMember("tenant", "t-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			bag, err := baggage.New(member)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx := baggage.ContextWithBaggage(t.Context(), bag)
+			input := &sqs.SendMessageInput{
+				QueueUrl:    utils.Ptr("https://sqs.us-east-1.amazonaws.com/1234567890123/queue-1"),
+				MessageBody: utils.Ptr("body"),
+			}
+			if _, err := client.SendMessage(ctx, input); err != nil {
+				t.Fatal(err)
+			}
+			if got := gotMsgAttrs["baggage"]; got.Value != "tenant=t-1" {
+				t.Errorf("baggage: got=%#v", got)
+			}
+			if _, ok := gotMsgAttrs["traceparent"]; !ok {
+				t.Error("traceparent is not injected")
+			}
+		})
+	}
+}
+
+func TestMiddleware_sendMessage_error(t *testing.T) {
+	t.Parallel()
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("x-amzn-query-error", "AWS.SimpleQueueService.NonExistentQueue;Sender")
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = io.WriteString(w, `{"__type":"com.amazonaws.sqs#QueueDoesNotExist","message":"The specified queue does not exist."}`)
+	}))
+	t.Cleanup(srv.Close)
+	cfg := aws.Config{
+		Region:           "us-east-1",
+		Credentials:      staticCredentials("id", "secret", "token"),
+		BaseEndpoint:     &srv.URL,
+		RetryMaxAttempts: 1,
+	}
+	pub.AppendMiddlewares(&cfg.APIOptions, pub.WithTracerProvider(tp), pub.WithPropagator(propagation.TraceContext{}))
+	client := sqs.NewFromConfig(cfg)
+
+	input := &sqs.SendMessageInput{
+		QueueUrl:    utils.Ptr("https://sqs.us-east-1.amazonaws.com/1234567890123/queue-1"),
+		MessageBody: utils.Ptr("body"),
+	}
+	if _, err := client.SendMessage(t.Context(), input); err == nil {
+		t.Fatal("expected an error but got nil")
+	}
+	if err := tp.ForceFlush(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	gotSpans := exporter.GetSpans()
+	if len(gotSpans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(gotSpans))
+	}
+	if got := gotSpans[0].Status.Code; got != codes.Error {
+		t.Errorf("status code: want=%s got=%s", codes.Error, got)
+	}
+	gotAttrs := attribute.NewSet(gotSpans[0].Attributes...)
+	if got, _ := gotAttrs.Value("error.type"); got.AsString() != "AWS.SimpleQueueService.NonExistentQueue" {
+		t.Errorf("error.type: got=%q", got.AsString())
+	}
+	if got, _ := gotAttrs.Value("messaging.destination.name"); got.AsString() != "queue-1" {
+		t.Errorf("messaging.destination.name: got=%q", got.AsString())
+	}
+}
+
+func traceparentOf(sc trace.SpanContext) string {
+	return fmt.Sprintf("00-%s-%s-%s", sc.TraceID(), sc.SpanID(), sc.TraceFlags())
+}
+
 func staticCredentials(keyID, secret, sessionToken string) *awsCredentials {
 	return &awsCredentials{Credentials: aws.Credentials{
 		AccessKeyID:     keyID,
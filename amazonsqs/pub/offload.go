@@ -0,0 +1,168 @@
+package pub
+
+import (
+	"context"
+	"crypto/rand"
+	"maps"
+	"strconv"
+
+	"github.com/aereal/otelpubsub/amazonsqs/internal/s3pointer"
+	"github.com/aereal/otelpubsub/amazonsqs/internal/utils"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.39.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ExtendedPayloadSizeAttributeName is the name of the Number message attribute that holds the size of the offloaded body,
+// as the SQS extended client libraries set.
+const ExtendedPayloadSizeAttributeName = s3pointer.AttributeName
+
+// PayloadUploader uploads the message bodies offloaded to S3.
+// It is typically implemented with the PutObject API of the S3 client, setting metadata as the user-defined object metadata.
+type PayloadUploader interface {
+	UploadPayload(ctx context.Context, bucket, key string, body []byte, metadata map[string]string) error
+}
+
+// offloading is the configuration of the payload offloading.
+type offloading struct {
+	uploader  PayloadUploader
+	bucket    string
+	threshold int
+}
+
+// offloadSendMessage offloads the body of the message if it is larger than the threshold.
+func (i *instrumenter) offloadSendMessage(ctx context.Context, params *sqs.SendMessageInput) error {
+	if i.offloading == nil {
+		return nil
+	}
+	mas := maps.Clone(params.MessageAttributes)
+	if mas == nil {
+		mas = map[string]types.MessageAttributeValue{}
+	}
+	body, err := i.offloadBody(ctx, deref(params.QueueUrl), params.MessageBody, mas)
+	if err != nil {
+		return err
+	}
+	if body != params.MessageBody {
+		params.MessageBody = body
+		params.MessageAttributes = mas
+	}
+	return nil
+}
+
+// offloadBody uploads the body to S3 and replaces it with the pointer to the object if the message is larger than the threshold.
+// The size is counted with the trace context of ctx injected, as the caller injects it after this.
+// attrs must be already cloned.
+func (i *instrumenter) offloadBody(ctx context.Context, queueURL string, body *string, attrs map[string]types.MessageAttributeValue) (*string, error) {
+	if i.offloading == nil || body == nil || i.injectedPayloadSize(ctx, queueURL, body, attrs) <= i.offloading.threshold {
+		return body, nil
+	}
+	return i.uploadBody(ctx, body, attrs)
+}
+
+// offloadBatchEntries offloads the bodies of the entries larger than the threshold,
+// and then the largest ones until the total of the batch, which SQS limits as a message, is within the threshold.
+// ctxs are the contexts of the "create" spans of the entries, and the message attributes of the entries must be already cloned.
+func (i *instrumenter) offloadBatchEntries(ctxs []context.Context, queueURL string, entries []types.SendMessageBatchRequestEntry) error {
+	if i.offloading == nil {
+		return nil
+	}
+	sizes := make([]int, len(entries))
+	offloaded := make([]bool, len(entries))
+	for k, entry := range entries {
+		sizes[k] = i.injectedPayloadSize(ctxs[k], queueURL, entry.MessageBody, entry.MessageAttributes)
+	}
+	offload := func(k int) error {
+		body, err := i.uploadBody(ctxs[k], entries[k].MessageBody, entries[k].MessageAttributes)
+		if err != nil {
+			return err
+		}
+		entries[k].MessageBody = body
+		offloaded[k] = true
+		sizes[k] = i.injectedPayloadSize(ctxs[k], queueURL, body, entries[k].MessageAttributes)
+		return nil
+	}
+	for k, entry := range entries {
+		if entry.MessageBody != nil && sizes[k] > i.offloading.threshold {
+			if err := offload(k); err != nil {
+				return err
+			}
+		}
+	}
+	for total := sum(sizes); total > i.offloading.threshold; total = sum(sizes) {
+		largest := -1
+		for k, entry := range entries {
+			if !offloaded[k] && entry.MessageBody != nil && (largest < 0 || sizes[k] > sizes[largest]) {
+				largest = k
+			}
+		}
+		if largest < 0 {
+			// nothing is left to offload; the validation or the API rejects the batch
+			return nil
+		}
+		if err := offload(largest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// uploadBody uploads the body to S3 and returns the pointer to the object, setting the size of the body in attrs.
+// The trace context is also injected into the object metadata, and the upload is traced with a child span.
+func (i *instrumenter) uploadBody(ctx context.Context, body *string, attrs map[string]types.MessageAttributeValue) (*string, error) {
+	metadata := propagation.MapCarrier{}
+	i.propagator.Inject(ctx, metadata)
+	pointer := s3pointer.Pointer{Bucket: i.offloading.bucket, Key: rand.Text()}
+	ctx, span := i.tracer.Start(ctx, "offload",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.AWSS3Bucket(pointer.Bucket),
+			semconv.AWSS3Key(pointer.Key),
+		),
+	)
+	defer span.End()
+	if err := i.offloading.uploader.UploadPayload(ctx, pointer.Bucket, pointer.Key, []byte(*body), metadata); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "")
+		span.SetAttributes(errorType(err))
+		return nil, err
+	}
+	encoded, err := s3pointer.Encode(pointer)
+	if err != nil {
+		return nil, err
+	}
+	attrs[ExtendedPayloadSizeAttributeName] = utils.NumberAttributeValue(strconv.Itoa(len(*body)))
+	return &encoded, nil
+}
+
+// injectedPayloadSize returns the size of the message after the trace context of ctx is injected.
+// It injects into copies, leaving the message to be injected after the body is offloaded or not.
+func (i *instrumenter) injectedPayloadSize(ctx context.Context, queueURL string, body *string, attrs map[string]types.MessageAttributeValue) int {
+	if i.skipDecision(queueURL, trace.SpanContextFromContext(ctx)) != "" {
+		return payloadSize(body, attrs)
+	}
+	mas := maps.Clone(attrs)
+	if mas == nil {
+		mas = map[string]types.MessageAttributeValue{}
+	}
+	var decision injectionDecision
+	if i.xrayTraceHeaderMode != XRayTraceHeaderModeOnly {
+		// the errors are returned by the injection itself
+		decision, _ = i.inject(ctx, "", mas)
+	}
+	if injected, _, err := i.injectBody(ctx, body, decision); err == nil {
+		body = injected
+	}
+	return payloadSize(body, mas)
+}
+
+func sum(sizes []int) int {
+	var total int
+	for _, size := range sizes {
+		total += size
+	}
+	return total
+}
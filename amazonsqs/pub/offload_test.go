@@ -0,0 +1,318 @@
+package pub_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aereal/otelpubsub/amazonsqs/internal/utils"
+	"github.com/aereal/otelpubsub/amazonsqs/pub"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestMiddleware_payloadOffloading(t *testing.T) {
+	t.Parallel()
+
+	const threshold = 128
+	testCases := []struct {
+		name          string
+		body          string
+		wantOffloaded bool
+	}{
+		{name: "large", body: strings.Repeat("x", threshold+1), wantOffloaded: true},
+		// the injected traceparent attribute pushes the message over the threshold
+		{name: "just below the threshold", body: strings.Repeat("x", threshold-1), wantOffloaded: true},
+		{name: "small", body: "small body"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			s3 := newS3StandIn(t)
+			var gotInput *sqs.SendMessageInput
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				defer r.Body.Close()
+				gotInput = new(sqs.SendMessageInput)
+				if err := json.NewDecoder(r.Body).Decode(gotInput); err != nil {
+					t.Errorf("failed to decode request body: %s", err)
+				}
+			}))
+			t.Cleanup(srv.Close)
+			exporter := tracetest.NewInMemoryExporter()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+			cfg := aws.Config{
+				Region:       "us-east-1",
+				Credentials:  staticCredentials("id", "secret", "token"),
+				BaseEndpoint: &srv.URL,
+			}
+			pub.AppendMiddlewares(&cfg.APIOptions,
+				pub.WithTracerProvider(tp),
+				pub.WithPropagator(propagation.TraceContext{}),
+				pub.WithPayloadOffloading(s3, "bucket-1", threshold),
+			)
+			client := sqs.NewFromConfig(cfg)
+
+			input := &sqs.SendMessageInput{
+				QueueUrl:    utils.Ptr("https://sqs.us-east-1.amazonaws.com/1234567890123/queue-1"),
+				MessageBody: utils.Ptr(tc.body),
+			}
+			if _, err := client.SendMessage(t.Context(), input); err != nil {
+				t.Fatal(err)
+			}
+			if deref(input.MessageBody) != tc.body {
+				t.Errorf("the input is modified: %q", deref(input.MessageBody))
+			}
+			spans := exporter.GetSpans()
+			if !tc.wantOffloaded {
+				if deref(gotInput.MessageBody) != tc.body {
+					t.Errorf("body: want=%q got=%q", tc.body, deref(gotInput.MessageBody))
+				}
+				if _, ok := gotInput.MessageAttributes["ExtendedPayloadSize"]; ok {
+					t.Error("ExtendedPayloadSize is set on the small message")
+				}
+				if len(s3.objects) != 0 || len(spans) != 1 {
+					t.Errorf("the small message is offloaded: objects=%d spans=%d", len(s3.objects), len(spans))
+				}
+				return
+			}
+
+			if len(spans) != 2 {
+				t.Fatalf("got %d spans, want 2", len(spans))
+			}
+			offloadSpan, producerSpan := spans[0], spans[1]
+			if offloadSpan.Name != "offload" || offloadSpan.SpanKind != trace.SpanKindClient || offloadSpan.Parent.SpanID() != producerSpan.SpanContext.SpanID() {
+				t.Errorf("offload span: name=%q kind=%s parent=%s", offloadSpan.Name, offloadSpan.SpanKind, offloadSpan.Parent.SpanID())
+			}
+			for _, kv := range offloadSpan.Attributes {
+				if strings.HasPrefix(string(kv.Key), "messaging.") {
+					t.Errorf("offload span has the messaging attribute %s", kv.Key)
+				}
+			}
+			object, key := s3.only(t, "bucket-1")
+			wantBody := fmt.Sprintf(`["software.amazon.payloadoffloading.PayloadS3Pointer",{"s3BucketName":"bucket-1","s3Key":%q}]`, key)
+			if got := deref(gotInput.MessageBody); got != wantBody {
+				t.Errorf("body: want=%s got=%s", wantBody, got)
+			}
+			if got := deref(gotInput.MessageAttributes["ExtendedPayloadSize"].StringValue); got != fmt.Sprint(len(tc.body)) {
+				t.Errorf("ExtendedPayloadSize: got %q", got)
+			}
+			if string(object.body) != tc.body {
+				t.Errorf("object body: got %q", object.body)
+			}
+			wantTraceparent := traceparentOf(producerSpan.SpanContext)
+			if got := deref(gotInput.MessageAttributes["traceparent"].StringValue); got != wantTraceparent {
+				t.Errorf("traceparent attribute: want=%q got=%q", wantTraceparent, got)
+			}
+			if got := object.metadata["traceparent"]; got != wantTraceparent {
+				t.Errorf("traceparent metadata: want=%q got=%q", wantTraceparent, got)
+			}
+		})
+	}
+}
+
+func TestMiddleware_payloadOffloading_batch(t *testing.T) {
+	t.Parallel()
+
+	const threshold = 512
+	s3 := newS3StandIn(t)
+	var gotInput *sqs.SendMessageBatchInput
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		gotInput = new(sqs.SendMessageBatchInput)
+		if err := json.NewDecoder(r.Body).Decode(gotInput); err != nil {
+			t.Errorf("failed to decode request body: %s", err)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	cfg := aws.Config{
+		Region:       "us-east-1",
+		Credentials:  staticCredentials("id", "secret", "token"),
+		BaseEndpoint: &srv.URL,
+	}
+	pub.AppendMiddlewares(&cfg.APIOptions,
+		pub.WithTracerProvider(tp),
+		pub.WithPropagator(propagation.TraceContext{}),
+		pub.WithPayloadOffloading(s3, "bucket-1", threshold),
+	)
+	client := sqs.NewFromConfig(cfg)
+
+	input := &sqs.SendMessageBatchInput{
+		QueueUrl: utils.Ptr("https://sqs.us-east-1.amazonaws.com/1234567890123/queue-1"),
+		Entries: []types.SendMessageBatchRequestEntry{
+			{Id: utils.Ptr("1"), MessageBody: utils.Ptr("small body")},
+			{Id: utils.Ptr("2"), MessageBody: utils.Ptr(strings.Repeat("x", threshold+1))},
+		},
+	}
+	if _, err := client.SendMessageBatch(t.Context(), input); err != nil {
+		t.Fatal(err)
+	}
+	var createSpan tracetest.SpanStub
+	for _, span := range exporter.GetSpans() {
+		if hasAttribute(span, "otelpubsub.batch.entry_id", "2") {
+			createSpan = span
+		}
+	}
+	object, _ := s3.only(t, "bucket-1")
+	if got, want := object.metadata["traceparent"], traceparentOf(createSpan.SpanContext); got != want {
+		t.Errorf("traceparent metadata: want=%q got=%q", want, got)
+	}
+	if got := deref(gotInput.Entries[0].MessageBody); got != "small body" {
+		t.Errorf("entry #0 body: got %q", got)
+	}
+	if _, ok := gotInput.Entries[1].MessageAttributes["ExtendedPayloadSize"]; !ok {
+		t.Error("entry #1 has no ExtendedPayloadSize")
+	}
+}
+
+func TestMiddleware_payloadOffloading_batchTotal(t *testing.T) {
+	t.Parallel()
+
+	const threshold = 512
+	s3 := newS3StandIn(t)
+	var gotInput *sqs.SendMessageBatchInput
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		gotInput = new(sqs.SendMessageBatchInput)
+		if err := json.NewDecoder(r.Body).Decode(gotInput); err != nil {
+			t.Errorf("failed to decode request body: %s", err)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(tracetest.NewInMemoryExporter()))
+	cfg := aws.Config{
+		Region:       "us-east-1",
+		Credentials:  staticCredentials("id", "secret", "token"),
+		BaseEndpoint: &srv.URL,
+	}
+	pub.AppendMiddlewares(&cfg.APIOptions,
+		pub.WithTracerProvider(tp),
+		pub.WithPropagator(propagation.TraceContext{}),
+		pub.WithPayloadOffloading(s3, "bucket-1", threshold),
+	)
+	client := sqs.NewFromConfig(cfg)
+
+	// Each entry is within the threshold, but the batch is not.
+	smaller, larger := strings.Repeat("x", threshold/3), strings.Repeat("y", threshold/2)
+	input := &sqs.SendMessageBatchInput{
+		QueueUrl: utils.Ptr("https://sqs.us-east-1.amazonaws.com/1234567890123/queue-1"),
+		Entries: []types.SendMessageBatchRequestEntry{
+			{Id: utils.Ptr("1"), MessageBody: utils.Ptr(smaller)},
+			{Id: utils.Ptr("2"), MessageBody: utils.Ptr(larger)},
+		},
+	}
+	if _, err := client.SendMessageBatch(t.Context(), input); err != nil {
+		t.Fatal(err)
+	}
+	object, _ := s3.only(t, "bucket-1")
+	if string(object.body) != larger {
+		t.Errorf("the larger entry is not offloaded: object body=%q", object.body)
+	}
+	if got := deref(gotInput.Entries[0].MessageBody); got != smaller {
+		t.Errorf("entry #0 body: got %q", got)
+	}
+	if _, ok := gotInput.Entries[1].MessageAttributes["ExtendedPayloadSize"]; !ok {
+		t.Error("entry #1 has no ExtendedPayloadSize")
+	}
+}
+
+func hasAttribute(span tracetest.SpanStub, key, value string) bool {
+	for _, kv := range span.Attributes {
+		if string(kv.Key) == key && kv.Value.Emit() == value {
+			return true
+		}
+	}
+	return false
+}
+
+type s3Object struct {
+	metadata map[string]string
+	body     []byte
+}
+
+// s3StandIn is an httptest S3 stand-in that implements [pub.PayloadUploader] with the PutObject REST API.
+type s3StandIn struct {
+	objects  map[string]s3Object
+	endpoint string
+	mu       sync.Mutex
+}
+
+func newS3StandIn(t *testing.T) *s3StandIn {
+	t.Helper()
+	s := &s3StandIn{objects: map[string]s3Object{}}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		metadata := map[string]string{}
+		for name := range r.Header {
+			if key, ok := strings.CutPrefix(strings.ToLower(name), "x-amz-meta-"); ok {
+				metadata[key] = r.Header.Get(name)
+			}
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.objects[r.URL.Path] = s3Object{body: body, metadata: metadata}
+	}))
+	t.Cleanup(srv.Close)
+	s.endpoint = srv.URL
+	return s
+}
+
+var _ pub.PayloadUploader = (*s3StandIn)(nil)
+
+func (s *s3StandIn) UploadPayload(ctx context.Context, bucket, key string, body []byte, metadata map[string]string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.endpoint+"/"+bucket+"/"+key, strings.NewReader(string(body)))
+	if err != nil {
+		return err
+	}
+	for k, v := range metadata {
+		req.Header.Set("x-amz-meta-"+k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("PutObject: %s", resp.Status) //nolint:err113
+	}
+	return nil
+}
+
+// only returns the only object stored in the bucket and its key.
+func (s *s3StandIn) only(t *testing.T, bucket string) (s3Object, string) {
+	t.Helper()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.objects) != 1 {
+		t.Fatalf("got %d objects, want 1", len(s.objects))
+	}
+	for path, object := range s.objects {
+		key, ok := strings.CutPrefix(path, "/"+bucket+"/")
+		if !ok {
+			t.Fatalf("unexpected object path: %s", path)
+		}
+		return object, key
+	}
+	return s3Object{}, ""
+}
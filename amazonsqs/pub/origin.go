@@ -0,0 +1,57 @@
+package pub
+
+import (
+	"slices"
+
+	"github.com/aereal/otelpubsub/amazonsqs/internal/origin"
+	"github.com/aereal/otelpubsub/amazonsqs/internal/packed"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// OriginAttributePrefix is prepended to the names of the message attributes that keep the originator's trace context
+// under [ExistingTraceContextPolicyPreserveOrigin], e.g. "otel.origin.traceparent".
+const OriginAttributePrefix = origin.AttributePrefix
+
+// ExistingTraceContextPolicy determines what to do when the message attributes already carry trace context,
+// as they do when a relay republishes a received message with its attributes copied.
+type ExistingTraceContextPolicy int
+
+const (
+	// ExistingTraceContextPolicyOverwrite overwrites the existing trace context with the current one.
+	ExistingTraceContextPolicyOverwrite ExistingTraceContextPolicy = iota
+	// ExistingTraceContextPolicyPreserve keeps the existing trace context and skips injection.
+	ExistingTraceContextPolicyPreserve
+	// ExistingTraceContextPolicyPreserveOrigin moves the existing trace context under the names prefixed with [OriginAttributePrefix]
+	// and injects the current one.
+	// If the message already has the originator's trace context, it is kept and the intermediate one is discarded.
+	ExistingTraceContextPolicyPreserveOrigin
+)
+
+// existingFields returns the names of the propagation fields, including the packed attribute, that attrs already has.
+func (i *instrumenter) existingFields(attrs map[string]types.MessageAttributeValue) []string {
+	var existing []string
+	for _, field := range append(slices.Clone(i.propagator.Fields()), packed.AttributeName) {
+		if _, ok := attrs[field]; ok {
+			existing = append(existing, field)
+		}
+	}
+	return existing
+}
+
+// moveToOrigin moves the fields under the names prefixed with [OriginAttributePrefix].
+// The originator's fields that attrs already has are not overwritten.
+func moveToOrigin(attrs map[string]types.MessageAttributeValue, fields []string) {
+	hasOrigin := false
+	for _, field := range fields {
+		if _, ok := attrs[origin.AttributePrefix+field]; ok {
+			hasOrigin = true
+			break
+		}
+	}
+	for _, field := range fields {
+		if !hasOrigin {
+			attrs[origin.AttributePrefix+field] = attrs[field]
+		}
+		delete(attrs, field)
+	}
+}
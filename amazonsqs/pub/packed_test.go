@@ -0,0 +1,104 @@
+package pub_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aereal/otelpubsub/amazonsqs/internal/utils"
+	"github.com/aereal/otelpubsub/amazonsqs/pub"
+	"github.com/aereal/otelpubsub/amazonsqs/sub"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestMiddleware_packed(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name         string
+		opts         []pub.AppendMiddlewaresOption
+		numAttrs     int
+		wantDataType string
+	}{
+		{name: "JSON", opts: []pub.AppendMiddlewaresOption{pub.WithPackedEncoding(pub.PackedEncodingJSON)}, wantDataType: utils.DataTypeString},
+		{name: "binary", opts: []pub.AppendMiddlewaresOption{pub.WithPackedEncoding(pub.PackedEncodingBinary)}, wantDataType: utils.DataTypeBinary},
+		{name: "pack policy", opts: []pub.AppendMiddlewaresOption{pub.WithAttributeBudgetPolicy(pub.AttributeBudgetPolicyPack)}, numAttrs: 9, wantDataType: utils.DataTypeString},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var gotAttrs map[string]types.MessageAttributeValue
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				defer r.Body.Close()
+				input := new(sqs.SendMessageInput)
+				if err := json.NewDecoder(r.Body).Decode(input); err != nil {
+					t.Errorf("failed to decode request body: %s", err)
+					return
+				}
+				gotAttrs = input.MessageAttributes
+			}))
+			t.Cleanup(srv.Close)
+			exporter := tracetest.NewInMemoryExporter()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+			cfg := aws.Config{
+				Region:       "us-east-1",
+				Credentials:  staticCredentials("id", "secret", "token"),
+				BaseEndpoint: &srv.URL,
+			}
+			opts := append([]pub.AppendMiddlewaresOption{pub.WithTracerProvider(tp), pub.WithPropagator(propagation.TraceContext{})}, tc.opts...)
+			pub.AppendMiddlewares(&cfg.APIOptions, opts...)
+			client := sqs.NewFromConfig(cfg)
+
+			input := &sqs.SendMessageInput{
+				QueueUrl:          utils.Ptr("https://sqs.us-east-1.amazonaws.com/1234567890123/queue-1"),
+				MessageBody:       utils.Ptr("body"),
+				MessageAttributes: userAttributes(tc.numAttrs),
+			}
+			if _, err := client.SendMessage(contextWithTraceState(t), input); err != nil {
+				t.Fatal(err)
+			}
+			if len(gotAttrs) != tc.numAttrs+1 {
+				t.Errorf("want %d attributes but got %d", tc.numAttrs+1, len(gotAttrs))
+			}
+			av, ok := gotAttrs[pub.PackedAttributeName]
+			if !ok {
+				t.Fatalf("%s attribute is not set", pub.PackedAttributeName)
+			}
+			if got := *av.DataType; got != tc.wantDataType {
+				t.Errorf("DataType: want=%q got=%q", tc.wantDataType, got)
+			}
+
+			// the sub package must transparently extract the packed trace context
+			carrier := sub.MessageAttributes{}
+			if av.StringValue != nil {
+				carrier[pub.PackedAttributeName] = sub.StringAttributeValue(*av.StringValue)
+			} else {
+				carrier[pub.PackedAttributeName] = sub.BinaryAttributeValue(av.BinaryValue)
+			}
+			extracted := trace.SpanContextFromContext(propagation.TraceContext{}.Extract(t.Context(), carrier))
+			spans := exporter.GetSpans()
+			if len(spans) != 1 {
+				t.Fatalf("got %d spans, want 1", len(spans))
+			}
+			if !extracted.Equal(spans[0].SpanContext.WithRemote(true)) {
+				t.Errorf("extracted span context: want=%#v got=%#v", spans[0].SpanContext, extracted)
+			}
+			if got := extracted.TraceState().String(); got != "vendor=value" {
+				t.Errorf("tracestate: got=%q", got)
+			}
+			spanAttrs := attribute.NewSet(spans[0].Attributes...)
+			if got, _ := spanAttrs.Value("otelpubsub.injection.decision"); got.AsString() != "packed" {
+				t.Errorf("decision: got=%q", got.AsString())
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package pub
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/smithy-go/middleware"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InjectionPlacement determines at which step of the SDK middleware stack the trace context is injected.
+type InjectionPlacement int
+
+const (
+	// InjectionPlacementInitialize injects the trace context of the PRODUCER span at the initialize step.
+	InjectionPlacementInitialize InjectionPlacement = iota
+	// InjectionPlacementSerialize injects the trace context of the span that is current at the serialize step.
+	// When the client is also instrumented with otelaws, it is the client span otelaws starts at the end of the initialize step,
+	// so consumers are linked to the client span; otherwise it is the PRODUCER span.
+	//
+	// It only affects SendMessage. The entries of SendMessageBatch are always injected with their "create" spans,
+	// as each message has its own creation context.
+	InjectionPlacementSerialize
+)
+
+// injectSerialize is a serialize middleware that injects the trace context of the current span into the message
+// under [InjectionPlacementSerialize].
+// The parameters are the copy made by [instrumenter.instrumentSendMessage], so they are modified in place.
+func (i *instrumenter) injectSerialize(ctx context.Context, input middleware.SerializeInput, next middleware.SerializeHandler) (middleware.SerializeOutput, middleware.Metadata, error) {
+	if params, ok := input.Parameters.(*sqs.SendMessageInput); ok {
+		if err := i.injectSendMessage(ctx, trace.SpanFromContext(ctx), params); err != nil {
+			return middleware.SerializeOutput{}, middleware.Metadata{}, err
+		}
+	}
+	return next.HandleSerialize(ctx, input)
+}
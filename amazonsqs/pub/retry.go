@@ -0,0 +1,95 @@
+package pub
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/smithy-go/middleware"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.39.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// retryMiddlewareID is the ID of the finalize middleware of the SDK that retries the request.
+const retryMiddlewareID = "Retry"
+
+const eventNameAttempt = "otelpubsub.attempt"
+
+var (
+	attrKeyRetryCount          = attribute.Key("otelpubsub.retry.count")
+	attrKeyAttemptNumber       = attribute.Key("otelpubsub.attempt.number")
+	attrKeyAttemptRetryable    = attribute.Key("otelpubsub.attempt.retryable")
+	attrKeyAttemptBackoffDelay = attribute.Key("otelpubsub.attempt.backoff_delay")
+)
+
+// attemptTracker records when each attempt of an API call starts and ends.
+// The attempts are made sequentially by the retry middleware, so it needs no lock.
+type attemptTracker struct {
+	attempts []attemptTiming
+}
+
+type attemptTiming struct {
+	startedAt time.Time
+	endedAt   time.Time
+}
+
+type attemptTrackerKey struct{}
+
+// withAttemptTracker returns the context with a new [attemptTracker] as a stack value.
+func withAttemptTracker(ctx context.Context) (context.Context, *attemptTracker) {
+	tracker := &attemptTracker{}
+	return middleware.WithStackValue(ctx, attemptTrackerKey{}, tracker), tracker
+}
+
+// addTrackAttempt registers the middleware that tracks each attempt right after the retry middleware.
+// It does nothing if the stack has no retry middleware.
+func addTrackAttempt(stack *middleware.Stack) error {
+	if _, ok := stack.Finalize.Get(retryMiddlewareID); !ok {
+		return nil
+	}
+	return stack.Finalize.Insert(middleware.FinalizeMiddlewareFunc("TrackPubAttempt", trackAttempt), retryMiddlewareID, middleware.After)
+}
+
+// trackAttempt is a finalize middleware that records the timing of the attempt to the [attemptTracker] in the context.
+func trackAttempt(ctx context.Context, input middleware.FinalizeInput, next middleware.FinalizeHandler) (middleware.FinalizeOutput, middleware.Metadata, error) {
+	tracker, ok := middleware.GetStackValue(ctx, attemptTrackerKey{}).(*attemptTracker)
+	if !ok {
+		return next.HandleFinalize(ctx, input)
+	}
+	startedAt := time.Now()
+	out, md, err := next.HandleFinalize(ctx, input)
+	tracker.attempts = append(tracker.attempts, attemptTiming{startedAt: startedAt, endedAt: time.Now()})
+	return out, md, err
+}
+
+// recordAttempts records the attempts of the API call on the span if it has been retried.
+// It sets the retry count and adds an event for each attempt with its error, ending with the final one.
+// The backoff delays are recorded on the retried attempts only if the tracker has recorded every attempt.
+func recordAttempts(span trace.Span, tracker *attemptTracker, md middleware.Metadata) {
+	results, ok := retry.GetAttemptResults(md)
+	if !ok || len(results.Results) < 2 {
+		return
+	}
+	span.SetAttributes(attrKeyRetryCount.Int(len(results.Results) - 1))
+	timed := len(tracker.attempts) == len(results.Results)
+	for n, result := range results.Results {
+		attrs := []attribute.KeyValue{attrKeyAttemptNumber.Int(n + 1)}
+		if result.Err != nil {
+			attrs = append(attrs,
+				errorType(result.Err),
+				semconv.ErrorMessage(result.Err.Error()),
+				attrKeyAttemptRetryable.Bool(result.Retryable),
+			)
+		}
+		opts := []trace.EventOption{}
+		if timed {
+			attempt := tracker.attempts[n]
+			if result.Retried && n+1 < len(tracker.attempts) {
+				attrs = append(attrs, attrKeyAttemptBackoffDelay.Float64(tracker.attempts[n+1].startedAt.Sub(attempt.endedAt).Seconds()))
+			}
+			opts = append(opts, trace.WithTimestamp(attempt.endedAt))
+		}
+		span.AddEvent(eventNameAttempt, append(opts, trace.WithAttributes(attrs...))...)
+	}
+}
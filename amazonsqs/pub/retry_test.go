@@ -0,0 +1,144 @@
+package pub_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aereal/otelpubsub/amazonsqs/internal/utils"
+	"github.com/aereal/otelpubsub/amazonsqs/pub"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestMiddleware_retryAttempts(t *testing.T) {
+	t.Parallel()
+
+	const backoff = 10 * time.Millisecond
+	testCases := []struct {
+		name           string
+		call           func(t *testing.T, client *sqs.Client) error
+		throttledTimes int32
+		wantRetryCount int
+		wantErr        bool
+	}{
+		{name: "first try", call: sendMessage, throttledTimes: 0},
+		{name: "succeeded after retries", call: sendMessage, throttledTimes: 2, wantRetryCount: 2},
+		{name: "failed after retries", call: sendMessage, throttledTimes: 3, wantRetryCount: 2, wantErr: true},
+		{name: "batch/succeeded after retries", call: sendMessageBatch, throttledTimes: 1, wantRetryCount: 1},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var calls atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if calls.Add(1) <= tc.throttledTimes {
+					w.WriteHeader(http.StatusBadRequest)
+					_, _ = io.WriteString(w, `{"__type":"com.amazonaws.sqs#ThrottlingException","message":"Rate exceeded"}`)
+					return
+				}
+				_, _ = io.WriteString(w, `{}`)
+			}))
+			t.Cleanup(srv.Close)
+			exporter := tracetest.NewInMemoryExporter()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+			cfg := aws.Config{
+				Region:       "us-east-1",
+				Credentials:  staticCredentials("id", "secret", "token"),
+				BaseEndpoint: &srv.URL,
+				Retryer: func() aws.Retryer {
+					return retry.NewStandard(func(o *retry.StandardOptions) {
+						o.MaxAttempts = 3
+						o.Backoff = retry.BackoffDelayerFunc(func(int, error) (time.Duration, error) { return backoff, nil })
+					})
+				},
+			}
+			pub.AppendMiddlewares(&cfg.APIOptions, pub.WithTracerProvider(tp), pub.WithPropagator(propagation.TraceContext{}))
+			client := sqs.NewFromConfig(cfg)
+
+			if err := tc.call(t, client); (err != nil) != tc.wantErr {
+				t.Fatalf("error: want=%v got=%v", tc.wantErr, err)
+			}
+			spans := exporter.GetSpans()
+			if len(spans) == 0 {
+				t.Fatal("no spans")
+			}
+			span := spans[0]
+			spanAttrs := attribute.NewSet(span.Attributes...)
+			gotRetryCount, ok := spanAttrs.Value("otelpubsub.retry.count")
+			if int(gotRetryCount.AsInt64()) != tc.wantRetryCount {
+				t.Errorf("retry count: want=%d got=%d", tc.wantRetryCount, gotRetryCount.AsInt64())
+			}
+			var events []sdktrace.Event
+			for _, event := range span.Events {
+				if event.Name == "otelpubsub.attempt" {
+					events = append(events, event)
+				}
+			}
+			if tc.wantRetryCount == 0 {
+				if ok {
+					t.Error("retry count is set on the first try")
+				}
+				if len(events) != 0 {
+					t.Errorf("want no attempt events but got %#v", events)
+				}
+				return
+			}
+			if len(events) != tc.wantRetryCount+1 {
+				t.Fatalf("got %d attempt events, want %d", len(events), tc.wantRetryCount+1)
+			}
+			for n, event := range events {
+				attrs := attribute.NewSet(event.Attributes...)
+				if got, _ := attrs.Value("otelpubsub.attempt.number"); got.AsInt64() != int64(n+1) {
+					t.Errorf("event #%d number: got %d", n, got.AsInt64())
+				}
+				retried := n < tc.wantRetryCount
+				if retried || tc.wantErr {
+					if got, _ := attrs.Value("error.type"); got.AsString() != "ThrottlingException" {
+						t.Errorf("event #%d error.type: got %q", n, got.AsString())
+					}
+					if got, _ := attrs.Value("otelpubsub.attempt.retryable"); !got.AsBool() {
+						t.Errorf("event #%d is not retryable", n)
+					}
+				} else if attrs.HasValue("error.type") {
+					t.Errorf("event #%d of the successful attempt has error.type", n)
+				}
+				gotDelay, hasDelay := attrs.Value("otelpubsub.attempt.backoff_delay")
+				if hasDelay != retried {
+					t.Errorf("event #%d backoff delay presence: want=%v got=%v", n, retried, hasDelay)
+				}
+				if hasDelay && gotDelay.AsFloat64() < backoff.Seconds() {
+					t.Errorf("event #%d backoff delay: want >= %v got %v", n, backoff.Seconds(), gotDelay.AsFloat64())
+				}
+			}
+		})
+	}
+}
+
+func sendMessage(t *testing.T, client *sqs.Client) error {
+	t.Helper()
+	_, err := client.SendMessage(t.Context(), &sqs.SendMessageInput{
+		QueueUrl:    utils.Ptr("https://sqs.us-east-1.amazonaws.com/1234567890123/queue-1"),
+		MessageBody: utils.Ptr("body"),
+	})
+	return err
+}
+
+func sendMessageBatch(t *testing.T, client *sqs.Client) error {
+	t.Helper()
+	_, err := client.SendMessageBatch(t.Context(), &sqs.SendMessageBatchInput{
+		QueueUrl: utils.Ptr("https://sqs.us-east-1.amazonaws.com/1234567890123/queue-1"),
+		Entries:  []types.SendMessageBatchRequestEntry{{Id: utils.Ptr("1"), MessageBody: utils.Ptr("msg-1")}},
+	})
+	return err
+}
@@ -0,0 +1,21 @@
+package semconv
+
+import "go.opentelemetry.io/otel/attribute"
+
+var (
+	AttrKeyAWSSQSMessageGroupID         = attribute.Key("aws.sqs.message.group_id")
+	AttrKeyAWSSQSMessageDeduplicationID = attribute.Key("aws.sqs.message.deduplication_id")
+	AttrKeyAWSSQSMessageDelaySeconds    = attribute.Key("aws.sqs.message.delay_seconds")
+)
+
+func AttrAWSSQSMessageGroupID(id string) attribute.KeyValue {
+	return AttrKeyAWSSQSMessageGroupID.String(id)
+}
+
+func AttrAWSSQSMessageDeduplicationID(id string) attribute.KeyValue {
+	return AttrKeyAWSSQSMessageDeduplicationID.String(id)
+}
+
+func AttrAWSSQSMessageDelaySeconds(seconds int32) attribute.KeyValue {
+	return AttrKeyAWSSQSMessageDelaySeconds.Int(int(seconds))
+}
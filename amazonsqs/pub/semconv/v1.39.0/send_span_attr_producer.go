@@ -0,0 +1,105 @@
+package semconv
+
+import (
+	"iter"
+
+	"github.com/aereal/otelpubsub/amazonsqs/internal/utils"
+	"github.com/aereal/otelpubsub/amazonsqs/pub"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.39.0"
+)
+
+type SendSpanAttributeProducer struct{}
+
+var _ pub.SQSSendSpanAttributeProducer = SendSpanAttributeProducer{}
+
+func (p SendSpanAttributeProducer) ProduceSQSSendSpanAttributes(input *sqs.SendMessageInput, output *sqs.SendMessageOutput) iter.Seq[attribute.KeyValue] {
+	return func(yield func(attribute.KeyValue) bool) {
+		if input == nil {
+			return
+		}
+
+		for kv := range p.queueAttrs(input.QueueUrl) {
+			if !yield(kv) {
+				return
+			}
+		}
+		for kv := range p.messageAttrs(input.MessageBody, input.MessageGroupId, input.MessageDeduplicationId, input.DelaySeconds) {
+			if !yield(kv) {
+				return
+			}
+		}
+		if output != nil && output.MessageId != nil {
+			if !yield(semconv.MessagingMessageID(*output.MessageId)) {
+				return
+			}
+		}
+	}
+}
+
+func (p SendSpanAttributeProducer) ProduceSQSSendBatchEntrySpanAttributes(input *sqs.SendMessageBatchInput, entry *types.SendMessageBatchRequestEntry, result *types.SendMessageBatchResultEntry) iter.Seq[attribute.KeyValue] {
+	return func(yield func(attribute.KeyValue) bool) {
+		if input == nil || entry == nil {
+			return
+		}
+
+		for kv := range p.queueAttrs(input.QueueUrl) {
+			if !yield(kv) {
+				return
+			}
+		}
+		for kv := range p.messageAttrs(entry.MessageBody, entry.MessageGroupId, entry.MessageDeduplicationId, entry.DelaySeconds) {
+			if !yield(kv) {
+				return
+			}
+		}
+		if result != nil && result.MessageId != nil {
+			if !yield(semconv.MessagingMessageID(*result.MessageId)) {
+				return
+			}
+		}
+	}
+}
+
+func (SendSpanAttributeProducer) queueAttrs(queueURL *string) iter.Seq[attribute.KeyValue] {
+	return func(yield func(attribute.KeyValue) bool) {
+		if queueURL == nil || *queueURL == "" {
+			return
+		}
+		if !yield(semconv.AWSSQSQueueURL(*queueURL)) {
+			return
+		}
+		if queueName := utils.QueueNameOf(*queueURL); queueName != "" {
+			if !yield(semconv.MessagingDestinationName(queueName)) {
+				return
+			}
+		}
+	}
+}
+
+func (SendSpanAttributeProducer) messageAttrs(body, groupID, deduplicationID *string, delaySeconds int32) iter.Seq[attribute.KeyValue] {
+	return func(yield func(attribute.KeyValue) bool) {
+		if body != nil {
+			if !yield(semconv.MessagingMessageBodySize(len(*body))) {
+				return
+			}
+		}
+		if groupID != nil {
+			if !yield(AttrAWSSQSMessageGroupID(*groupID)) {
+				return
+			}
+		}
+		if deduplicationID != nil {
+			if !yield(AttrAWSSQSMessageDeduplicationID(*deduplicationID)) {
+				return
+			}
+		}
+		if delaySeconds > 0 {
+			if !yield(AttrAWSSQSMessageDelaySeconds(delaySeconds)) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package semconv_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/aereal/otelpubsub/amazonsqs/internal/utils"
+	semconv "github.com/aereal/otelpubsub/amazonsqs/pub/semconv/v1.39.0"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/google/go-cmp/cmp"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func TestSendSpanAttributeProducer_ProduceSQSSendSpanAttributes(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name   string
+		input  *sqs.SendMessageInput
+		output *sqs.SendMessageOutput
+		want   []attribute.KeyValue
+	}{
+		{
+			name: "ok",
+			input: &sqs.SendMessageInput{
+				QueueUrl:               utils.Ptr("https://sqs.ap-northeast-1.amazonaws.com/123456789012/queue-01.fifo"),
+				MessageBody:            utils.Ptr(`{"ok":true}`),
+				MessageGroupId:         utils.Ptr("group-1"),
+				MessageDeduplicationId: utils.Ptr("dedup-1"),
+			},
+			output: &sqs.SendMessageOutput{MessageId: utils.Ptr("msg-001")},
+			want: []attribute.KeyValue{
+				attribute.String("aws.sqs.queue.url", "https://sqs.ap-northeast-1.amazonaws.com/123456789012/queue-01.fifo"),
+				attribute.String("messaging.destination.name", "queue-01.fifo"),
+				attribute.Int("messaging.message.body.size", 11),
+				attribute.String("aws.sqs.message.group_id", "group-1"),
+				attribute.String("aws.sqs.message.deduplication_id", "dedup-1"),
+				attribute.String("messaging.message.id", "msg-001"),
+			},
+		},
+		{
+			name: "delayed and failed",
+			input: &sqs.SendMessageInput{
+				QueueUrl:     utils.Ptr("https://sqs.ap-northeast-1.amazonaws.com/123456789012/queue-01"),
+				MessageBody:  utils.Ptr(`{"ok":true}`),
+				DelaySeconds: 30,
+			},
+			want: []attribute.KeyValue{
+				attribute.String("aws.sqs.queue.url", "https://sqs.ap-northeast-1.amazonaws.com/123456789012/queue-01"),
+				attribute.String("messaging.destination.name", "queue-01"),
+				attribute.Int("messaging.message.body.size", 11),
+				attribute.Int("aws.sqs.message.delay_seconds", 30),
+			},
+		},
+		{
+			name:  "nil input",
+			input: nil,
+			want:  nil,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			want := attribute.NewSet(tc.want...)
+			got := attribute.NewSet(slices.Collect(semconv.SendSpanAttributeProducer{}.ProduceSQSSendSpanAttributes(tc.input, tc.output))...)
+			if diff := cmp.Diff(want, got, cmp.Comparer(func(a, b attribute.Set) bool { return a.Equals(&b) })); diff != "" {
+				t.Errorf("attributes (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSendSpanAttributeProducer_ProduceSQSSendBatchEntrySpanAttributes(t *testing.T) {
+	t.Parallel()
+
+	input := &sqs.SendMessageBatchInput{
+		QueueUrl: utils.Ptr("https://sqs.ap-northeast-1.amazonaws.com/123456789012/queue-01.fifo"),
+	}
+	entry := &types.SendMessageBatchRequestEntry{
+		Id:             utils.Ptr("1"),
+		MessageBody:    utils.Ptr(`{"ok":true}`),
+		MessageGroupId: utils.Ptr("group-1"),
+	}
+	testCases := []struct {
+		name   string
+		result *types.SendMessageBatchResultEntry
+		want   []attribute.KeyValue
+	}{
+		{
+			name:   "succeeded",
+			result: &types.SendMessageBatchResultEntry{Id: utils.Ptr("1"), MessageId: utils.Ptr("msg-001")},
+			want: []attribute.KeyValue{
+				attribute.String("aws.sqs.queue.url", "https://sqs.ap-northeast-1.amazonaws.com/123456789012/queue-01.fifo"),
+				attribute.String("messaging.destination.name", "queue-01.fifo"),
+				attribute.Int("messaging.message.body.size", 11),
+				attribute.String("aws.sqs.message.group_id", "group-1"),
+				attribute.String("messaging.message.id", "msg-001"),
+			},
+		},
+		{
+			name: "failed",
+			want: []attribute.KeyValue{
+				attribute.String("aws.sqs.queue.url", "https://sqs.ap-northeast-1.amazonaws.com/123456789012/queue-01.fifo"),
+				attribute.String("messaging.destination.name", "queue-01.fifo"),
+				attribute.Int("messaging.message.body.size", 11),
+				attribute.String("aws.sqs.message.group_id", "group-1"),
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			want := attribute.NewSet(tc.want...)
+			got := attribute.NewSet(slices.Collect(semconv.SendSpanAttributeProducer{}.ProduceSQSSendBatchEntrySpanAttributes(input, entry, tc.result))...)
+			if diff := cmp.Diff(want, got, cmp.Comparer(func(a, b attribute.Set) bool { return a.Equals(&b) })); diff != "" {
+				t.Errorf("attributes (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package pub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/smithy-go/middleware"
+)
+
+const (
+	// MaxPayloadSize is the maximum size in bytes of a message, or of all the entries of a batch,
+	// counting the body and the names, data types and values of the message attributes.
+	MaxPayloadSize = 1024 * 1024
+	// MaxBatchEntries is the maximum number of entries in a SendMessageBatch request.
+	MaxBatchEntries = 10
+	// MaxAttributeNameLength is the maximum length of a message attribute name.
+	MaxAttributeNameLength = 256
+)
+
+var (
+	// ErrPayloadTooLarge is wrapped by [*ValidationError] when the payload exceeds [MaxPayloadSize].
+	ErrPayloadTooLarge = errors.New("payload too large")
+	// ErrInvalidAttributeName is wrapped by [*ValidationError] when a message attribute name breaks the naming rules.
+	ErrInvalidAttributeName = errors.New("invalid message attribute name")
+	// ErrTooManyEntries is wrapped by [*ValidationError] when a batch has more than [MaxBatchEntries] entries.
+	ErrTooManyEntries = errors.New("too many batch entries")
+)
+
+// ValidationError indicates the request would be rejected by Amazon SQS.
+// It is returned before the request is signed when [WithPreflightValidation] is specified.
+type ValidationError struct {
+	// Err is one of [ErrPayloadTooLarge], [ErrInvalidAttributeName] and [ErrTooManyEntries].
+	Err error
+	// EntryID is the ID of the batch entry, or empty for a single message or the whole batch.
+	EntryID string
+	// AttributeName is the offending message attribute name for [ErrInvalidAttributeName].
+	AttributeName string
+	// Size is the payload size or the number of entries, and Limit is its limit.
+	Size  int
+	Limit int
+}
+
+var _ error = (*ValidationError)(nil) //nolint:errcheck
+
+func (e *ValidationError) Error() string {
+	msg := e.Err.Error()
+	if e.AttributeName != "" {
+		msg += fmt.Sprintf(" %q", e.AttributeName)
+	}
+	if e.Limit > 0 {
+		msg += fmt.Sprintf(": %d exceeds the limit of %d", e.Size, e.Limit)
+	}
+	if e.EntryID != "" {
+		msg += fmt.Sprintf(" for entry %q", e.EntryID)
+	}
+	return msg
+}
+
+func (e *ValidationError) Unwrap() error { return e.Err }
+
+// validate is an initialize middleware that runs after the trace context is injected and rejects requests Amazon SQS would reject.
+func validate(ctx context.Context, input middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+	if err := validateParameters(input.Parameters); err != nil {
+		return middleware.InitializeOutput{}, middleware.Metadata{}, err
+	}
+	return next.HandleInitialize(ctx, input)
+}
+
+// validateSerialize is the serialize middleware counterpart of [validate] used with [InjectionPlacementSerialize].
+func validateSerialize(ctx context.Context, input middleware.SerializeInput, next middleware.SerializeHandler) (middleware.SerializeOutput, middleware.Metadata, error) {
+	if err := validateParameters(input.Parameters); err != nil {
+		return middleware.SerializeOutput{}, middleware.Metadata{}, err
+	}
+	return next.HandleSerialize(ctx, input)
+}
+
+func validateParameters(params any) error {
+	switch params := params.(type) {
+	case *sqs.SendMessageInput:
+		return validateMessage("", params.MessageBody, params.MessageAttributes)
+	case *sqs.SendMessageBatchInput:
+		return validateBatch(params)
+	default:
+		return nil
+	}
+}
+
+func validateBatch(params *sqs.SendMessageBatchInput) error {
+	if n := len(params.Entries); n > MaxBatchEntries {
+		return &ValidationError{Err: ErrTooManyEntries, Size: n, Limit: MaxBatchEntries}
+	}
+	total := 0
+	for _, entry := range params.Entries {
+		if err := validateMessage(deref(entry.Id), entry.MessageBody, entry.MessageAttributes); err != nil {
+			return err
+		}
+		total += payloadSize(entry.MessageBody, entry.MessageAttributes)
+	}
+	if total > MaxPayloadSize {
+		return &ValidationError{Err: ErrPayloadTooLarge, Size: total, Limit: MaxPayloadSize}
+	}
+	return nil
+}
+
+func validateMessage(entryID string, body *string, attrs map[string]types.MessageAttributeValue) error {
+	for name := range attrs {
+		if !isValidAttributeName(name) {
+			return &ValidationError{Err: ErrInvalidAttributeName, EntryID: entryID, AttributeName: name}
+		}
+	}
+	if size := payloadSize(body, attrs); size > MaxPayloadSize {
+		return &ValidationError{Err: ErrPayloadTooLarge, EntryID: entryID, Size: size, Limit: MaxPayloadSize}
+	}
+	return nil
+}
+
+// payloadSize returns the size of the message counted against [MaxPayloadSize].
+func payloadSize(body *string, attrs map[string]types.MessageAttributeValue) int {
+	size := len(deref(body))
+	for name, av := range attrs {
+		size += len(name) + len(deref(av.DataType)) + len(deref(av.StringValue)) + len(av.BinaryValue)
+	}
+	return size
+}
+
+// isValidAttributeName reports whether the name follows the naming rules of message attributes:
+// it consists of alphanumerics, hyphens, underscores and periods, neither starts nor ends with a period,
+// has no consecutive periods, and does not start with the reserved "AWS." or "Amazon." prefixes.
+func isValidAttributeName(name string) bool {
+	if name == "" || len(name) > MaxAttributeNameLength {
+		return false
+	}
+	if strings.HasPrefix(name, ".") || strings.HasSuffix(name, ".") || strings.Contains(name, "..") {
+		return false
+	}
+	lower := strings.ToLower(name)
+	if strings.HasPrefix(lower, "aws.") || strings.HasPrefix(lower, "amazon.") {
+		return false
+	}
+	for _, r := range name {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9', r == '-', r == '_', r == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,178 @@
+package pub_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aereal/otelpubsub/amazonsqs/internal/utils"
+	"github.com/aereal/otelpubsub/amazonsqs/pub"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/google/go-cmp/cmp"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestMiddleware_preflightValidation(t *testing.T) {
+	t.Parallel()
+
+	queueURL := utils.Ptr("https://sqs.us-east-1.amazonaws.com/1234567890123/queue-1")
+	testCases := []struct {
+		call    func(t *testing.T, client *sqs.Client) error
+		want    *pub.ValidationError
+		name    string
+		wantErr error
+	}{
+		{
+			name: "ok",
+			call: func(t *testing.T, client *sqs.Client) error {
+				t.Helper()
+				_, err := client.SendMessage(t.Context(), &sqs.SendMessageInput{QueueUrl: queueURL, MessageBody: utils.Ptr("body")})
+				return err
+			},
+		},
+		{
+			name: "payload too large",
+			call: func(t *testing.T, client *sqs.Client) error {
+				t.Helper()
+				_, err := client.SendMessage(t.Context(), &sqs.SendMessageInput{QueueUrl: queueURL, MessageBody: utils.Ptr(strings.Repeat("a", pub.MaxPayloadSize-10))})
+				return err
+			},
+			wantErr: pub.ErrPayloadTooLarge,
+			want:    &pub.ValidationError{Size: pub.MaxPayloadSize - 10 + len("traceparent") + len("String") + 55, Limit: pub.MaxPayloadSize},
+		},
+		{
+			name: "reserved attribute name",
+			call: func(t *testing.T, client *sqs.Client) error {
+				t.Helper()
+				_, err := client.SendMessage(t.Context(), &sqs.SendMessageInput{
+					QueueUrl:          queueURL,
+					MessageBody:       utils.Ptr("body"),
+					MessageAttributes: map[string]types.MessageAttributeValue{"AWS.reserved": utils.StringAttributeValue("v")},
+				})
+				return err
+			},
+			wantErr: pub.ErrInvalidAttributeName,
+			want:    &pub.ValidationError{AttributeName: "AWS.reserved"},
+		},
+		{
+			name: "batch/invalid attribute name",
+			call: func(t *testing.T, client *sqs.Client) error {
+				t.Helper()
+				_, err := client.SendMessageBatch(t.Context(), &sqs.SendMessageBatchInput{
+					QueueUrl: queueURL,
+					Entries: []types.SendMessageBatchRequestEntry{
+						{Id: utils.Ptr("1"), MessageBody: utils.Ptr("msg-1")},
+						{Id: utils.Ptr("2"), MessageBody: utils.Ptr("msg-2"), MessageAttributes: map[string]types.MessageAttributeValue{"a..b": utils.StringAttributeValue("v")}},
+					},
+				})
+				return err
+			},
+			wantErr: pub.ErrInvalidAttributeName,
+			want:    &pub.ValidationError{EntryID: "2", AttributeName: "a..b"},
+		},
+		{
+			name: "batch/payload too large in total",
+			call: func(t *testing.T, client *sqs.Client) error {
+				t.Helper()
+				_, err := client.SendMessageBatch(t.Context(), &sqs.SendMessageBatchInput{
+					QueueUrl: queueURL,
+					Entries: []types.SendMessageBatchRequestEntry{
+						{Id: utils.Ptr("1"), MessageBody: utils.Ptr(strings.Repeat("a", pub.MaxPayloadSize/2))},
+						{Id: utils.Ptr("2"), MessageBody: utils.Ptr(strings.Repeat("a", pub.MaxPayloadSize/2))},
+					},
+				})
+				return err
+			},
+			wantErr: pub.ErrPayloadTooLarge,
+			want:    &pub.ValidationError{Size: pub.MaxPayloadSize + 2*(len("traceparent")+len("String")+55), Limit: pub.MaxPayloadSize},
+		},
+		{
+			name: "batch/too many entries",
+			call: func(t *testing.T, client *sqs.Client) error {
+				t.Helper()
+				entries := make([]types.SendMessageBatchRequestEntry, 0, pub.MaxBatchEntries+1)
+				for i := range pub.MaxBatchEntries + 1 {
+					entries = append(entries, types.SendMessageBatchRequestEntry{Id: utils.Ptr(fmt.Sprint(i)), MessageBody: utils.Ptr("msg")})
+				}
+				_, err := client.SendMessageBatch(t.Context(), &sqs.SendMessageBatchInput{QueueUrl: queueURL, Entries: entries})
+				return err
+			},
+			wantErr: pub.ErrTooManyEntries,
+			want:    &pub.ValidationError{Size: pub.MaxBatchEntries + 1, Limit: pub.MaxBatchEntries},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var requests atomic.Int64
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+			}))
+			t.Cleanup(srv.Close)
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(tracetest.NewInMemoryExporter()))
+			cfg := aws.Config{
+				Region:       "us-east-1",
+				Credentials:  staticCredentials("id", "secret", "token"),
+				BaseEndpoint: &srv.URL,
+			}
+			pub.AppendMiddlewares(&cfg.APIOptions, pub.WithTracerProvider(tp), pub.WithPropagator(propagation.TraceContext{}), pub.WithPreflightValidation())
+			client := sqs.NewFromConfig(cfg)
+
+			err := tc.call(t, client)
+			if tc.wantErr == nil {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if requests.Load() != 1 {
+					t.Errorf("want 1 request but got %d", requests.Load())
+				}
+				return
+			}
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("want %v but got %v", tc.wantErr, err)
+			}
+			var got *pub.ValidationError
+			if !errors.As(err, &got) {
+				t.Fatalf("want ValidationError but got %T", err)
+			}
+			tc.want.Err = tc.wantErr
+			if diff := cmp.Diff(*tc.want, *got, cmp.Comparer(func(a, b error) bool { return errors.Is(a, b) })); diff != "" {
+				t.Errorf("error (-want, +got):\n%s", diff)
+			}
+			if requests.Load() != 0 {
+				t.Errorf("the request must not be sent but got %d requests", requests.Load())
+			}
+		})
+	}
+}
+
+func TestValidationError_Error(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		err  *pub.ValidationError
+		want string
+	}{
+		{err: &pub.ValidationError{Err: pub.ErrPayloadTooLarge, Size: 11, Limit: 10}, want: "payload too large: 11 exceeds the limit of 10"},
+		{err: &pub.ValidationError{Err: pub.ErrInvalidAttributeName, EntryID: "1", AttributeName: "AWS.x"}, want: `invalid message attribute name "AWS.x" for entry "1"`},
+		{err: &pub.ValidationError{Err: pub.ErrTooManyEntries, Size: 11, Limit: 10}, want: "too many batch entries: 11 exceeds the limit of 10"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.want, func(t *testing.T) {
+			t.Parallel()
+
+			if got := tc.err.Error(); got != tc.want {
+				t.Errorf("want=%q got=%q", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package pub
+
+import (
+	"maps"
+
+	"github.com/aereal/otelpubsub/amazonsqs/internal/utils"
+	"github.com/aereal/otelpubsub/amazonsqs/internal/xray"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// XRayTraceHeaderMode determines whether the trace context is written into the AWSTraceHeader message system attribute.
+//
+// AWSTraceHeader is read by X-Ray instrumented consumers and does not count against [MaxMessageAttributes].
+type XRayTraceHeaderMode int
+
+const (
+	// XRayTraceHeaderModeNone does not write AWSTraceHeader.
+	XRayTraceHeaderModeNone XRayTraceHeaderMode = iota
+	// XRayTraceHeaderModeAlongside writes AWSTraceHeader in addition to the message attributes.
+	XRayTraceHeaderModeAlongside
+	// XRayTraceHeaderModeOnly writes AWSTraceHeader instead of the message attributes.
+	XRayTraceHeaderModeOnly
+)
+
+// withTraceHeader returns a copy of attrs with AWSTraceHeader set to the span context.
+// attrs is returned as is if the span context is invalid.
+func withTraceHeader(attrs map[string]types.MessageSystemAttributeValue, sc trace.SpanContext) map[string]types.MessageSystemAttributeValue {
+	header := xray.FormatHeader(sc)
+	if header == "" {
+		return attrs
+	}
+	cloned := maps.Clone(attrs)
+	if cloned == nil {
+		cloned = map[string]types.MessageSystemAttributeValue{}
+	}
+	cloned[string(types.MessageSystemAttributeNameForSendsAWSTraceHeader)] = types.MessageSystemAttributeValue{
+		DataType:    utils.Ptr(utils.DataTypeString),
+		StringValue: utils.Ptr(header),
+	}
+	return cloned
+}
@@ -0,0 +1,139 @@
+package pub_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aereal/otelpubsub/amazonsqs/internal/utils"
+	"github.com/aereal/otelpubsub/amazonsqs/pub"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestMiddleware_xrayTraceHeader(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name            string
+		mode            pub.XRayTraceHeaderMode
+		wantTraceHeader bool
+		wantTraceparent bool
+	}{
+		{name: "none", mode: pub.XRayTraceHeaderModeNone, wantTraceHeader: false, wantTraceparent: true},
+		{name: "alongside", mode: pub.XRayTraceHeaderModeAlongside, wantTraceHeader: true, wantTraceparent: true},
+		{name: "only", mode: pub.XRayTraceHeaderModeOnly, wantTraceHeader: true, wantTraceparent: false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var gotInput *sqs.SendMessageInput
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				defer r.Body.Close()
+				gotInput = new(sqs.SendMessageInput)
+				if err := json.NewDecoder(r.Body).Decode(gotInput); err != nil {
+					t.Errorf("failed to decode request body: %s", err)
+				}
+			}))
+			t.Cleanup(srv.Close)
+			exporter := tracetest.NewInMemoryExporter()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+			cfg := aws.Config{
+				Region:       "us-east-1",
+				Credentials:  staticCredentials("id", "secret", "token"),
+				BaseEndpoint: &srv.URL,
+			}
+			pub.AppendMiddlewares(&cfg.APIOptions, pub.WithTracerProvider(tp), pub.WithPropagator(propagation.TraceContext{}), pub.WithXRayTraceHeader(tc.mode))
+			client := sqs.NewFromConfig(cfg)
+
+			input := &sqs.SendMessageInput{
+				QueueUrl:    utils.Ptr("https://sqs.us-east-1.amazonaws.com/1234567890123/queue-1"),
+				MessageBody: utils.Ptr("body"),
+			}
+			if _, err := client.SendMessage(t.Context(), input); err != nil {
+				t.Fatal(err)
+			}
+			spans := exporter.GetSpans()
+			if len(spans) != 1 {
+				t.Fatalf("got %d spans, want 1", len(spans))
+			}
+			traceHeader, ok := gotInput.MessageSystemAttributes["AWSTraceHeader"]
+			if ok != tc.wantTraceHeader {
+				t.Fatalf("AWSTraceHeader presence: want=%v got=%v", tc.wantTraceHeader, ok)
+			}
+			if ok {
+				if got, want := deref(traceHeader.StringValue), xrayHeaderOf(spans[0].SpanContext); got != want {
+					t.Errorf("AWSTraceHeader: want=%q got=%q", want, got)
+				}
+			}
+			if _, ok := gotInput.MessageAttributes["traceparent"]; ok != tc.wantTraceparent {
+				t.Errorf("traceparent presence: want=%v got=%v", tc.wantTraceparent, ok)
+			}
+		})
+	}
+}
+
+func TestMiddleware_xrayTraceHeader_batch(t *testing.T) {
+	t.Parallel()
+
+	var gotInput *sqs.SendMessageBatchInput
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		gotInput = new(sqs.SendMessageBatchInput)
+		if err := json.NewDecoder(r.Body).Decode(gotInput); err != nil {
+			t.Errorf("failed to decode request body: %s", err)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	cfg := aws.Config{
+		Region:       "us-east-1",
+		Credentials:  staticCredentials("id", "secret", "token"),
+		BaseEndpoint: &srv.URL,
+	}
+	pub.AppendMiddlewares(&cfg.APIOptions, pub.WithTracerProvider(tp), pub.WithPropagator(propagation.TraceContext{}), pub.WithXRayTraceHeader(pub.XRayTraceHeaderModeAlongside))
+	client := sqs.NewFromConfig(cfg)
+
+	input := &sqs.SendMessageBatchInput{
+		QueueUrl: utils.Ptr("https://sqs.us-east-1.amazonaws.com/1234567890123/queue-1"),
+		Entries: []types.SendMessageBatchRequestEntry{
+			{Id: utils.Ptr("1"), MessageBody: utils.Ptr("msg-1")},
+			{Id: utils.Ptr("2"), MessageBody: utils.Ptr("msg-2")},
+		},
+	}
+	if _, err := client.SendMessageBatch(t.Context(), input); err != nil {
+		t.Fatal(err)
+	}
+	spans := exporter.GetSpans()
+	if len(spans) != 3 {
+		t.Fatalf("got %d spans, want 3", len(spans))
+	}
+	for i, entry := range gotInput.Entries {
+		got := deref(entry.MessageSystemAttributes["AWSTraceHeader"].StringValue)
+		if want := xrayHeaderOf(spans[i+1].SpanContext); got != want {
+			t.Errorf("entry #%d AWSTraceHeader: want=%q got=%q", i, want, got)
+		}
+	}
+}
+
+func xrayHeaderOf(sc trace.SpanContext) string {
+	traceID := sc.TraceID().String()
+	return fmt.Sprintf("Root=1-%s-%s;Parent=%s;Sampled=1", traceID[:8], traceID[8:], sc.SpanID())
+}
+
+func deref[V any](ptr *V) V {
+	var zero V
+	if ptr == nil {
+		return zero
+	}
+	return *ptr
+}
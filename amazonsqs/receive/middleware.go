@@ -0,0 +1,177 @@
+package receive
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	"github.com/aereal/otelpubsub/amazonsqs/internal/envelope"
+	"github.com/aereal/otelpubsub/amazonsqs/internal/origin"
+	"github.com/aereal/otelpubsub/amazonsqs/internal/packed"
+	"github.com/aereal/otelpubsub/amazonsqs/internal/utils"
+	"github.com/aereal/otelpubsub/amazonsqs/internal/xray"
+	"github.com/aereal/otelpubsub/amazonsqs/sub"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.39.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/aereal/otelpubsub/amazonsqs/receive"
+
+const (
+	// attributeNameAll requests all message attributes or message system attributes.
+	attributeNameAll = "All"
+	// attributeNameAllWildcard is the wildcard for all message attributes.
+	attributeNameAllWildcard = ".*"
+)
+
+// MiddlewareID is the ID of the middleware [AppendMiddlewares] registers to the initialize step.
+const MiddlewareID = "InstrumentReceive"
+
+// AppendMiddlewares registers a middleware that instruments ReceiveMessage API calls.
+// It adds the message attributes that carry the trace context, that is the propagator's fields,
+// the attribute the pub package packs them into and the originator's ones, to MessageAttributeNames,
+// and the AWSTraceHeader and SentTimestamp message system attributes to MessageSystemAttributeNames,
+// so that pollers that do not request them still receive the trace context.
+// It also starts a CONSUMER "receive" span linked to the producer span of each returned message.
+// Pass the APIOptions field from [sqs.Options] to this function.
+// By default the global TracerProvider and TextMapPropagator are used, falling back to W3C Trace Context and Baggage
+// while no global TextMapPropagator is set; see [AppendMiddlewaresOption] to override them.
+func AppendMiddlewares(apiOptions *[]func(*middleware.Stack) error, opts ...AppendMiddlewaresOption) {
+	cfg := newConfig(opts)
+	inst := &instrumenter{
+		tracer:     cfg.tracerProvider.Tracer(tracerName),
+		propagator: cfg.propagator,
+	}
+	*apiOptions = append(*apiOptions, func(stack *middleware.Stack) error {
+		return stack.Initialize.Add(middleware.InitializeMiddlewareFunc(MiddlewareID, inst.instrumentReceive), middleware.Before)
+	})
+}
+
+type instrumenter struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+func (i *instrumenter) instrumentReceive(ctx context.Context, input middleware.InitializeInput, next middleware.InitializeHandler) (_ middleware.InitializeOutput, _ middleware.Metadata, err error) {
+	params, ok := input.Parameters.(*sqs.ReceiveMessageInput)
+	if !ok {
+		return next.HandleInitialize(ctx, input)
+	}
+	// Modify a copy so that the caller can reuse the input concurrently or across retries.
+	cloned := *params
+	params = &cloned
+	input.Parameters = params
+	params.MessageAttributeNames = i.withPropagationAttributeNames(params.MessageAttributeNames)
+	params.MessageSystemAttributeNames = withSystemAttributeNames(params.MessageSystemAttributeNames)
+
+	queueURL := deref(params.QueueUrl)
+	ctx, span := i.startSpan(ctx, queueURL)
+	defer func() { endSpan(span, err) }()
+
+	out, md, err := next.HandleInitialize(ctx, input)
+	if res, _ := out.Result.(*sqs.ReceiveMessageOutput); res != nil {
+		span.SetAttributes(semconv.MessagingBatchMessageCount(len(res.Messages)))
+		for _, msg := range res.Messages {
+			if sc := i.producerSpanContext(queueURL, msg); sc.IsValid() {
+				span.AddLink(trace.Link{SpanContext: sc})
+			}
+		}
+	}
+	return out, md, err
+}
+
+// withPropagationAttributeNames returns the names with the names of the attributes that carry the trace context added.
+func (i *instrumenter) withPropagationAttributeNames(names []string) []string {
+	if slices.Contains(names, attributeNameAll) || slices.Contains(names, attributeNameAllWildcard) {
+		return names
+	}
+	ret := slices.Clone(names)
+	for _, name := range append(i.propagator.Fields(), packed.AttributeName, origin.AttributePrefix+"*") {
+		if !slices.Contains(ret, name) {
+			ret = append(ret, name)
+		}
+	}
+	return ret
+}
+
+// withSystemAttributeNames returns the names with AWSTraceHeader and SentTimestamp added.
+func withSystemAttributeNames(names []types.MessageSystemAttributeName) []types.MessageSystemAttributeName {
+	if slices.Contains(names, types.MessageSystemAttributeNameAll) {
+		return names
+	}
+	ret := slices.Clone(names)
+	for _, name := range []types.MessageSystemAttributeName{types.MessageSystemAttributeNameAWSTraceHeader, types.MessageSystemAttributeNameSentTimestamp} {
+		if !slices.Contains(ret, name) {
+			ret = append(ret, name)
+		}
+	}
+	return ret
+}
+
+// producerSpanContext returns the span context of the producer of the message.
+// It looks at the message attributes, then the AWSTraceHeader message system attribute, then the body envelope.
+func (i *instrumenter) producerSpanContext(queueURL string, msg types.Message) trace.SpanContext {
+	converted := sub.FromReceivedMessage(queueURL, msg)
+	if sc := trace.SpanContextFromContext(i.propagator.Extract(context.Background(), converted.MessageAttributes)); sc.IsValid() {
+		return sc
+	}
+	if header, ok := msg.Attributes[string(types.MessageSystemAttributeNameAWSTraceHeader)]; ok {
+		if sc, err := xray.ParseHeader(header); err == nil {
+			return sc
+		}
+	}
+	if fields, _, ok := envelope.Unwrap(deref(msg.Body)); ok {
+		return trace.SpanContextFromContext(i.propagator.Extract(context.Background(), propagation.MapCarrier(fields)))
+	}
+	return trace.SpanContext{}
+}
+
+func (i *instrumenter) startSpan(ctx context.Context, queueURL string) (context.Context, trace.Span) {
+	const operationName = "receive"
+	attrs := []attribute.KeyValue{
+		semconv.MessagingSystemAWSSQS,
+		semconv.MessagingOperationTypeReceive,
+		semconv.MessagingOperationName(operationName),
+	}
+	spanName := operationName
+	if queueURL != "" {
+		attrs = append(attrs, semconv.AWSSQSQueueURL(queueURL))
+	}
+	if queueName := utils.QueueNameOf(queueURL); queueName != "" {
+		attrs = append(attrs, semconv.MessagingDestinationName(queueName))
+		spanName += " " + queueName
+	}
+	return i.tracer.Start(ctx, spanName, trace.WithSpanKind(trace.SpanKindConsumer), trace.WithAttributes(attrs...))
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "")
+		span.SetAttributes(errorType(err))
+	}
+	span.End()
+}
+
+func errorType(err error) attribute.KeyValue {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() != "" {
+		return semconv.ErrorTypeKey.String(apiErr.ErrorCode())
+	}
+	return semconv.ErrorType(err)
+}
+
+func deref[V any](ptr *V) V {
+	var zero V
+	if ptr == nil {
+		return zero
+	}
+	return *ptr
+}
@@ -0,0 +1,197 @@
+package receive_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/aereal/otelpubsub/amazonsqs/internal/utils"
+	"github.com/aereal/otelpubsub/amazonsqs/receive"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/google/go-cmp/cmp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const receiveMessageResponse = `{"Messages":[
+	{"MessageId":"msg-1","Body":"body-1","MessageAttributes":{"traceparent":{"DataType":"String","StringValue":"00-11111111111111111111111111111111-1111111111111111-01"}}},
+	{"MessageId":"msg-2","Body":"body-2","Attributes":{"AWSTraceHeader":"Root=1-22222222-222222222222222222222222;Parent=2222222222222222;Sampled=1"}},
+	{"MessageId":"msg-3","Body":"{\"otelpubsub.envelope\":1,\"otelpubsub.body\":\"body-3\",\"otelpubsub.propagation\":{\"traceparent\":\"00-33333333333333333333333333333333-3333333333333333-01\"}}"},
+	{"MessageId":"msg-4","Body":"body-4"}
+]}`
+
+func TestMiddleware_receiveMessage(t *testing.T) {
+	t.Parallel()
+
+	var gotInput *sqs.ReceiveMessageInput
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		gotInput = new(sqs.ReceiveMessageInput)
+		if err := json.NewDecoder(r.Body).Decode(gotInput); err != nil {
+			t.Errorf("failed to decode request body: %s", err)
+		}
+		_, _ = io.WriteString(w, receiveMessageResponse)
+	}))
+	t.Cleanup(srv.Close)
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	cfg := aws.Config{
+		Region:       "us-east-1",
+		Credentials:  staticCredentials("id", "secret", "token"),
+		BaseEndpoint: &srv.URL,
+	}
+	receive.AppendMiddlewares(&cfg.APIOptions, receive.WithTracerProvider(tp), receive.WithPropagator(propagation.TraceContext{}))
+	client := sqs.NewFromConfig(cfg)
+
+	input := &sqs.ReceiveMessageInput{
+		QueueUrl:              utils.Ptr("https://sqs.us-east-1.amazonaws.com/1234567890123/queue-1"),
+		MessageAttributeNames: []string{"tenant"},
+	}
+	out, err := client.ReceiveMessage(t.Context(), input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Messages) != 4 {
+		t.Fatalf("got %d messages, want 4", len(out.Messages))
+	}
+	if diff := cmp.Diff([]string{"tenant"}, input.MessageAttributeNames); diff != "" {
+		t.Errorf("the input is modified (-want, +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"tenant", "traceparent", "tracestate", "otelpubsub.propagation", "otel.origin.*"}, gotInput.MessageAttributeNames); diff != "" {
+		t.Errorf("MessageAttributeNames (-want, +got):\n%s", diff)
+	}
+	wantSystemNames := []types.MessageSystemAttributeName{types.MessageSystemAttributeNameAWSTraceHeader, types.MessageSystemAttributeNameSentTimestamp}
+	if diff := cmp.Diff(wantSystemNames, gotInput.MessageSystemAttributeNames); diff != "" {
+		t.Errorf("MessageSystemAttributeNames (-want, +got):\n%s", diff)
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(spans))
+	}
+	span := spans[0]
+	if span.Name != "receive queue-1" || span.SpanKind != trace.SpanKindConsumer {
+		t.Errorf("span: name=%q kind=%s", span.Name, span.SpanKind)
+	}
+	wantAttrs := []attribute.KeyValue{
+		attribute.String("messaging.system", "aws_sqs"),
+		attribute.String("messaging.operation.type", "receive"),
+		attribute.String("messaging.operation.name", "receive"),
+		attribute.String("aws.sqs.queue.url", "https://sqs.us-east-1.amazonaws.com/1234567890123/queue-1"),
+		attribute.String("messaging.destination.name", "queue-1"),
+		attribute.Int("messaging.batch.message_count", 4),
+	}
+	if diff := cmp.Diff(wantAttrs, span.Attributes, cmp.Comparer(func(a, b attribute.Value) bool { return a.Emit() == b.Emit() })); diff != "" {
+		t.Errorf("attributes (-want, +got):\n%s", diff)
+	}
+	gotLinks := make([]string, 0, len(span.Links))
+	for _, link := range span.Links {
+		gotLinks = append(gotLinks, link.SpanContext.TraceID().String()+"/"+link.SpanContext.SpanID().String())
+	}
+	wantLinks := []string{
+		"11111111111111111111111111111111/1111111111111111",
+		"22222222222222222222222222222222/2222222222222222",
+		"33333333333333333333333333333333/3333333333333333",
+	}
+	if diff := cmp.Diff(wantLinks, gotLinks); diff != "" {
+		t.Errorf("links (-want, +got):\n%s", diff)
+	}
+}
+
+func TestMiddleware_receiveMessage_all(t *testing.T) {
+	t.Parallel()
+
+	var gotInput *sqs.ReceiveMessageInput
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		gotInput = new(sqs.ReceiveMessageInput)
+		if err := json.NewDecoder(r.Body).Decode(gotInput); err != nil {
+			t.Errorf("failed to decode request body: %s", err)
+		}
+		_, _ = io.WriteString(w, `{}`)
+	}))
+	t.Cleanup(srv.Close)
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(tracetest.NewInMemoryExporter()))
+	cfg := aws.Config{
+		Region:       "us-east-1",
+		Credentials:  staticCredentials("id", "secret", "token"),
+		BaseEndpoint: &srv.URL,
+	}
+	receive.AppendMiddlewares(&cfg.APIOptions, receive.WithTracerProvider(tp), receive.WithPropagator(propagation.TraceContext{}))
+	client := sqs.NewFromConfig(cfg)
+
+	input := &sqs.ReceiveMessageInput{
+		QueueUrl:                    utils.Ptr("https://sqs.us-east-1.amazonaws.com/1234567890123/queue-1"),
+		MessageAttributeNames:       []string{"All"},
+		MessageSystemAttributeNames: []types.MessageSystemAttributeName{types.MessageSystemAttributeNameAll},
+	}
+	if _, err := client.ReceiveMessage(t.Context(), input); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"All"}, gotInput.MessageAttributeNames); diff != "" {
+		t.Errorf("MessageAttributeNames (-want, +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]types.MessageSystemAttributeName{types.MessageSystemAttributeNameAll}, gotInput.MessageSystemAttributeNames); diff != "" {
+		t.Errorf("MessageSystemAttributeNames (-want, +got):\n%s", diff)
+	}
+}
+
+func TestMiddleware_receiveMessage_defaultPropagator(t *testing.T) {
+	t.Parallel()
+
+	var gotInput *sqs.ReceiveMessageInput
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		gotInput = new(sqs.ReceiveMessageInput)
+		if err := json.NewDecoder(r.Body).Decode(gotInput); err != nil {
+			t.Errorf("failed to decode request body: %s", err)
+		}
+		_, _ = io.WriteString(w, `{}`)
+	}))
+	t.Cleanup(srv.Close)
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(tracetest.NewInMemoryExporter()))
+	cfg := aws.Config{
+		Region:       "us-east-1",
+		Credentials:  staticCredentials("id", "secret", "token"),
+		BaseEndpoint: &srv.URL,
+	}
+	// no global propagator is set in the tests
+	receive.AppendMiddlewares(&cfg.APIOptions, receive.WithTracerProvider(tp))
+	client := sqs.NewFromConfig(cfg)
+
+	input := &sqs.ReceiveMessageInput{QueueUrl: utils.Ptr("https://sqs.us-east-1.amazonaws.com/1234567890123/queue-1")}
+	if _, err := client.ReceiveMessage(t.Context(), input); err != nil {
+		t.Fatal(err)
+	}
+	gotNames := slices.Sorted(slices.Values(gotInput.MessageAttributeNames))
+	if diff := cmp.Diff([]string{"baggage", "otel.origin.*", "otelpubsub.propagation", "traceparent", "tracestate"}, gotNames); diff != "" {
+		t.Errorf("MessageAttributeNames (-want, +got):\n%s", diff)
+	}
+}
+
+func staticCredentials(keyID, secret, sessionToken string) *awsCredentials {
+	return &awsCredentials{Credentials: aws.Credentials{
+		AccessKeyID:     keyID,
+		SecretAccessKey: secret,
+		SessionToken:    sessionToken,
+	}}
+}
+
+type awsCredentials struct {
+	aws.Credentials
+}
+
+var _ aws.CredentialsProvider = (*awsCredentials)(nil)
+
+func (c *awsCredentials) Retrieve(_ context.Context) (aws.Credentials, error) {
+	return c.Credentials, nil
+}
@@ -0,0 +1,52 @@
+package receive
+
+import (
+	"github.com/aereal/otelpubsub/amazonsqs/internal"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type config struct {
+	tracerProvider trace.TracerProvider
+	propagator     propagation.TextMapPropagator
+}
+
+func newConfig(opts []AppendMiddlewaresOption) *config {
+	cfg := &config{}
+	for _, o := range opts {
+		o.applyAppendMiddlewaresOption(cfg)
+	}
+	if cfg.tracerProvider == nil {
+		cfg.tracerProvider = otel.GetTracerProvider()
+	}
+	if cfg.propagator == nil {
+		cfg.propagator = internal.Propagator
+	}
+	return cfg
+}
+
+// AppendMiddlewaresOption configures [AppendMiddlewares] behavior.
+type AppendMiddlewaresOption interface {
+	applyAppendMiddlewaresOption(*config)
+}
+
+// WithTracerProvider specifies the [trace.TracerProvider] to use for creating spans.
+// If not specified, [otel.GetTracerProvider] is used.
+func WithTracerProvider(tp trace.TracerProvider) AppendMiddlewaresOption {
+	return &optionWithTracerProvider{tp: tp}
+}
+
+type optionWithTracerProvider struct{ tp trace.TracerProvider }
+
+func (o *optionWithTracerProvider) applyAppendMiddlewaresOption(c *config) { c.tracerProvider = o.tp }
+
+// WithPropagator specifies the [propagation.TextMapPropagator] whose fields are requested and extracted from message attributes.
+// If not specified, [otel.GetTextMapPropagator] is used, or W3C Trace Context and Baggage while no global propagator is set.
+func WithPropagator(p propagation.TextMapPropagator) AppendMiddlewaresOption {
+	return &optionWithPropagator{p: p}
+}
+
+type optionWithPropagator struct{ p propagation.TextMapPropagator }
+
+func (o *optionWithPropagator) applyAppendMiddlewaresOption(c *config) { c.propagator = o.p }
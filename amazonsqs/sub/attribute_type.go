@@ -46,13 +46,22 @@ func (a *AttributeType) UnmarshalJSON(b []byte) error {
 	if err := json.Unmarshal(b, &s); err != nil {
 		return err
 	}
+	parsed, err := parseAttributeType(s)
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
+
+// parseAttributeType parses the data type of a message attribute, such as String or Binary.png.
+func parseAttributeType(s string) (AttributeType, error) {
 	kind, label, _ := strings.Cut(s, ".")
 	var at AttributeKind
 	if err := (&at).UnmarshalText([]byte(kind)); err != nil {
-		return err
+		return AttributeType{}, err
 	}
-	*a = AttributeType{kind: at, label: label}
-	return nil
+	return AttributeType{kind: at, label: label}, nil
 }
 
 func (a AttributeType) Kind() AttributeKind { return a.kind }
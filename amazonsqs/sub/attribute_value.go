@@ -3,6 +3,7 @@ package sub
 import (
 	"encoding/base64"
 	"encoding/json"
+	"slices"
 )
 
 // StringAttributeValue creates an [AttributeValue] of type String.
@@ -23,13 +24,27 @@ func NumberAttributeValue(v string) AttributeValue {
 	return newAttrValue(AttributeTypeNumber, v)
 }
 
+// CustomAttributeValue creates an [AttributeValue] of the custom type, such as String.UUID or Binary.png.
+// v is the Base64-encoded value for a Binary type.
+func CustomAttributeValue(t AttributeType, v string) AttributeValue {
+	return newAttrValue(t, v)
+}
+
 func newAttrValue(t AttributeType, v string) AttributeValue {
-	return &attributeValue{payload: &attributeValuePayload{Value: v, Type: t}}
+	payload := &attributeValuePayload{DataType: t}
+	if t.IsBinary() {
+		payload.BinaryValue = &v
+	} else {
+		payload.StringValue = &v
+	}
+	return &attributeValue{payload: payload}
 }
 
 // AttributeValue represents an SQS message attribute value.
 // The accessor methods (StringValue, NumberValue, etc.) return the value and a boolean
 // indicating whether the attribute is of that type.
+//
+// It is encoded in the JSON format of the message attributes in the SQS event of AWS Lambda.
 type AttributeValue interface {
 	json.Marshaler
 	json.Unmarshaler
@@ -40,19 +55,42 @@ type AttributeValue interface {
 	Base64EncodedBinaryValue() (string, bool)
 }
 
+// ListAttributeValue is an [AttributeValue] that also holds the list values, which SQS reserves for future use.
+// The attribute values this package creates or decodes implement it.
+type ListAttributeValue interface {
+	AttributeValue
+
+	// StringListValues returns the list of strings.
+	StringListValues() []string
+	// Base64EncodedBinaryListValues returns the list of Base64-encoded binaries.
+	Base64EncodedBinaryListValues() []string
+}
+
+// attributeValuePayload is the JSON format of a message attribute in the SQS event of AWS Lambda.
 type attributeValuePayload struct {
-	Value string
-	Type  AttributeType
+	StringValue      *string       `json:"stringValue,omitempty"`
+	BinaryValue      *string       `json:"binaryValue,omitempty"`
+	StringListValues []string      `json:"stringListValues"`
+	BinaryListValues []string      `json:"binaryListValues"`
+	DataType         AttributeType `json:"dataType"`
 }
 
 type attributeValue struct {
 	payload *attributeValuePayload
 }
 
-var _ AttributeValue = (*attributeValue)(nil)
+var _ ListAttributeValue = (*attributeValue)(nil)
 
 func (av *attributeValue) MarshalJSON() ([]byte, error) {
-	return json.Marshal(av.payload)
+	payload := *av.payload
+	// Lambda always encodes the lists as arrays
+	if payload.StringListValues == nil {
+		payload.StringListValues = []string{}
+	}
+	if payload.BinaryListValues == nil {
+		payload.BinaryListValues = []string{}
+	}
+	return json.Marshal(payload)
 }
 
 func (av *attributeValue) UnmarshalJSON(b []byte) error {
@@ -60,32 +98,35 @@ func (av *attributeValue) UnmarshalJSON(b []byte) error {
 	if err := json.Unmarshal(b, &payload); err != nil {
 		return err
 	}
-	if av == nil {
-		av = &attributeValue{}
-	}
 	av.payload = &payload
 	return nil
 }
 
-func (av *attributeValue) Type() AttributeType { return av.payload.Type }
+func (av *attributeValue) Type() AttributeType { return av.payload.DataType }
 
 func (av *attributeValue) StringValue() (string, bool) {
-	if !av.payload.Type.IsString() {
+	if !av.payload.DataType.IsString() || av.payload.StringValue == nil {
 		return "", false
 	}
-	return av.payload.Value, true
+	return *av.payload.StringValue, true
 }
 
 func (av *attributeValue) NumberValue() (string, bool) {
-	if !av.payload.Type.IsNumber() {
+	if !av.payload.DataType.IsNumber() || av.payload.StringValue == nil {
 		return "", false
 	}
-	return av.payload.Value, true
+	return *av.payload.StringValue, true
 }
 
 func (av *attributeValue) Base64EncodedBinaryValue() (string, bool) {
-	if !av.payload.Type.IsBinary() {
+	if !av.payload.DataType.IsBinary() || av.payload.BinaryValue == nil {
 		return "", false
 	}
-	return av.payload.Value, true
+	return *av.payload.BinaryValue, true
+}
+
+func (av *attributeValue) StringListValues() []string { return slices.Clone(av.payload.StringListValues) }
+
+func (av *attributeValue) Base64EncodedBinaryListValues() []string {
+	return slices.Clone(av.payload.BinaryListValues)
 }
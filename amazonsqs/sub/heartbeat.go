@@ -0,0 +1,199 @@
+package sub
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/smithy-go"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.39.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// DefaultVisibilityTimeout is the visibility timeout each extension sets by default.
+	DefaultVisibilityTimeout = 30 * time.Second
+	// MaxVisibilityExtension is the default cap of the total extension, which is the maximum visibility timeout SQS allows.
+	MaxVisibilityExtension = 12 * time.Hour
+)
+
+// stopHeartbeatErrorCodes are the error codes of ChangeMessageVisibility meaning the message can no longer be extended.
+var stopHeartbeatErrorCodes = []string{
+	"ReceiptHandleIsInvalid",
+	"AWS.SimpleQueueService.ReceiptHandleIsInvalid",
+	"MessageNotInflight",
+	"AWS.SimpleQueueService.MessageNotInflight",
+}
+
+const (
+	eventNameVisibilityExtension  = "otelpubsub.visibility_extension"
+	eventNameVisibilityCapReached = "otelpubsub.visibility_extension.cap_reached"
+)
+
+var (
+	attrKeyVisibilityExtensionNumber  = attribute.Key("otelpubsub.visibility_extension.number")
+	attrKeyVisibilityExtensionTimeout = attribute.Key("otelpubsub.visibility_extension.timeout")
+)
+
+// VisibilityChanger changes the visibility timeout of the messages.
+// [*sqs.Client] implements it.
+type VisibilityChanger interface {
+	ChangeMessageVisibility(ctx context.Context, params *sqs.ChangeMessageVisibilityInput, optFns ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityOutput, error)
+}
+
+var _ VisibilityChanger = (*sqs.Client)(nil)
+
+type heartbeatConfig struct {
+	interval          time.Duration
+	visibilityTimeout time.Duration
+	maxExtension      time.Duration
+	immediate         bool
+}
+
+// HeartbeatOption configures [ExtendVisibility] behavior.
+type HeartbeatOption interface {
+	applyHeartbeatOption(*heartbeatConfig)
+}
+
+// WithHeartbeatInterval specifies how often the visibility timeout is extended.
+// If not specified, half of the visibility timeout is used.
+// The first extension is made after the interval, so it must be shorter than the visibility timeout of the queue
+// unless [WithImmediateExtension] is specified.
+func WithHeartbeatInterval(d time.Duration) HeartbeatOption {
+	return &optionWithHeartbeatInterval{d: d}
+}
+
+type optionWithHeartbeatInterval struct{ d time.Duration }
+
+func (o *optionWithHeartbeatInterval) applyHeartbeatOption(c *heartbeatConfig) { c.interval = o.d }
+
+// WithVisibilityTimeout specifies the visibility timeout each extension sets, truncated to seconds.
+// If not specified or shorter than a second, [DefaultVisibilityTimeout] is used.
+func WithVisibilityTimeout(d time.Duration) HeartbeatOption {
+	return &optionWithVisibilityTimeout{d: d}
+}
+
+type optionWithVisibilityTimeout struct{ d time.Duration }
+
+func (o *optionWithVisibilityTimeout) applyHeartbeatOption(c *heartbeatConfig) {
+	c.visibilityTimeout = o.d
+}
+
+// WithImmediateExtension makes the first extension as soon as the processing starts instead of after the heartbeat interval.
+// Specify it when the visibility timeout of the queue may be shorter than the interval, at the cost of an extra API call for each message.
+func WithImmediateExtension() HeartbeatOption {
+	return &optionWithImmediateExtension{}
+}
+
+type optionWithImmediateExtension struct{}
+
+func (o *optionWithImmediateExtension) applyHeartbeatOption(c *heartbeatConfig) { c.immediate = true }
+
+// WithMaxVisibilityExtension caps how long after the processing starts the message can be kept invisible.
+// Once the cap is reached, the heartbeat stops and the message becomes visible again when the last extension expires.
+// If not specified, [MaxVisibilityExtension] is used.
+//
+// SQS counts its 12 hours limit from the receipt of the message, not from the start of the processing,
+// so messages waiting to be processed after they are received should be given a cap shorter by the wait;
+// otherwise the extensions beyond the limit fail and are recorded as errors.
+func WithMaxVisibilityExtension(d time.Duration) HeartbeatOption {
+	return &optionWithMaxVisibilityExtension{d: d}
+}
+
+type optionWithMaxVisibilityExtension struct{ d time.Duration }
+
+func (o *optionWithMaxVisibilityExtension) applyHeartbeatOption(c *heartbeatConfig) {
+	c.maxExtension = o.d
+}
+
+// ExtendVisibility wraps a [Processor] to periodically extend the visibility timeout of the message
+// with the ChangeMessageVisibility API until the processor returns, so that long-running processing does not cause duplicate deliveries.
+// The heartbeat stops when the receipt handle is no longer valid or the message is no longer in flight.
+// Wrap the returned processor with [WrapProcessor] to record each extension as an event on the process span.
+// queueURL is the URL of the queue the message is received from.
+func ExtendVisibility(f Processor, client VisibilityChanger, queueURL string, opts ...HeartbeatOption) Processor {
+	cfg := heartbeatConfig{}
+	for _, o := range opts {
+		o.applyHeartbeatOption(&cfg)
+	}
+	if cfg.visibilityTimeout < time.Second {
+		cfg.visibilityTimeout = DefaultVisibilityTimeout
+	}
+	if cfg.interval <= 0 {
+		cfg.interval = cfg.visibilityTimeout / 2
+	}
+	if cfg.maxExtension <= 0 {
+		cfg.maxExtension = MaxVisibilityExtension
+	}
+	return func(ctx context.Context, msg *Message) error {
+		if msg == nil || msg.ReceiptHandle == "" {
+			return f(ctx, msg)
+		}
+		hbCtx, cancel := context.WithCancel(ctx)
+		var wg sync.WaitGroup
+		wg.Go(func() { heartbeat(hbCtx, client, queueURL, msg.ReceiptHandle, cfg) })
+		defer wg.Wait()
+		defer cancel()
+		return f(ctx, msg)
+	}
+}
+
+// heartbeat extends the visibility timeout every interval
+// until the context is canceled, the cap is reached or the message can no longer be extended.
+func heartbeat(ctx context.Context, client VisibilityChanger, queueURL, receiptHandle string, cfg heartbeatConfig) {
+	span := trace.SpanFromContext(ctx)
+	deadline := time.Now().Add(cfg.maxExtension)
+	ticker := time.NewTicker(cfg.interval)
+	defer ticker.Stop()
+	for n := 1; ; n++ {
+		if n > 1 || !cfg.immediate {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+		// Never keep the message invisible beyond the cap.
+		timeout := min(cfg.visibilityTimeout, time.Until(deadline)).Truncate(time.Second)
+		if timeout < time.Second {
+			span.AddEvent(eventNameVisibilityCapReached)
+			return
+		}
+		_, err := client.ChangeMessageVisibility(ctx, &sqs.ChangeMessageVisibilityInput{
+			QueueUrl:          &queueURL,
+			ReceiptHandle:     &receiptHandle,
+			VisibilityTimeout: int32(timeout / time.Second),
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		attrs := []attribute.KeyValue{
+			attrKeyVisibilityExtensionNumber.Int(n),
+			attrKeyVisibilityExtensionTimeout.Int(int(timeout / time.Second)),
+		}
+		if err != nil {
+			attrs = append(attrs, errorType(err), semconv.ErrorMessage(err.Error()))
+		}
+		span.AddEvent(eventNameVisibilityExtension, trace.WithAttributes(attrs...))
+		if isStopHeartbeatError(err) {
+			return
+		}
+	}
+}
+
+func isStopHeartbeatError(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && slices.Contains(stopHeartbeatErrorCodes, apiErr.ErrorCode())
+}
+
+func errorType(err error) attribute.KeyValue {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() != "" {
+		return semconv.ErrorTypeKey.String(apiErr.ErrorCode())
+	}
+	return semconv.ErrorType(err)
+}
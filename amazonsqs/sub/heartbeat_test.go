@@ -0,0 +1,230 @@
+package sub_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aereal/otelpubsub/amazonsqs/sub"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/smithy-go"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+const heartbeatQueueURL = "https://sqs.us-east-1.amazonaws.com/1234567890123/queue-1"
+
+func TestExtendVisibility(t *testing.T) {
+	t.Parallel()
+
+	changer := &visibilityChanger{}
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	processor := func(context.Context, *sub.Message) error {
+		time.Sleep(55 * time.Millisecond)
+		return nil
+	}
+	wrapped := sub.WrapProcessor(
+		sub.ExtendVisibility(processor, changer, heartbeatQueueURL, sub.WithHeartbeatInterval(10*time.Millisecond), sub.WithVisibilityTimeout(5*time.Second)),
+		sub.WithTracerProvider(tp))
+	if err := wrapped(t.Context(), &sub.Message{MessageID: "msg-1", ReceiptHandle: "rh-1"}); err != nil {
+		t.Fatal(err)
+	}
+	inputs := changer.calls()
+	if len(inputs) < 3 {
+		t.Fatalf("got %d extensions, want at least 3", len(inputs))
+	}
+	time.Sleep(30 * time.Millisecond)
+	if n := len(changer.calls()); n != len(inputs) {
+		t.Errorf("extended %d times after the processor returned", n-len(inputs))
+	}
+	for _, input := range inputs {
+		if *input.QueueUrl != heartbeatQueueURL || *input.ReceiptHandle != "rh-1" || input.VisibilityTimeout != 5 {
+			t.Errorf("unexpected input: queueURL=%q receiptHandle=%q visibilityTimeout=%d", *input.QueueUrl, *input.ReceiptHandle, input.VisibilityTimeout)
+		}
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(spans))
+	}
+	var events int
+	for i, event := range spans[0].Events {
+		if event.Name != "otelpubsub.visibility_extension" {
+			t.Errorf("events[%d]: unexpected name %q", i, event.Name)
+			continue
+		}
+		events++
+		attrs := attributeMap(event.Attributes)
+		if got := attrs["otelpubsub.visibility_extension.number"]; got != int64(i+1) {
+			t.Errorf("events[%d]: number=%v", i, got)
+		}
+		if got := attrs["otelpubsub.visibility_extension.timeout"]; got != int64(5) {
+			t.Errorf("events[%d]: timeout=%v", i, got)
+		}
+	}
+	if events != len(inputs) {
+		t.Errorf("got %d events, want %d", events, len(inputs))
+	}
+}
+
+func TestExtendVisibility_cap(t *testing.T) {
+	t.Parallel()
+
+	changer := &visibilityChanger{}
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	processor := func(context.Context, *sub.Message) error {
+		time.Sleep(time.Second)
+		return nil
+	}
+	wrapped := sub.WrapProcessor(
+		sub.ExtendVisibility(processor, changer, heartbeatQueueURL,
+			sub.WithHeartbeatInterval(200*time.Millisecond),
+			sub.WithMaxVisibilityExtension(1500*time.Millisecond)),
+		sub.WithTracerProvider(tp))
+	if err := wrapped(t.Context(), &sub.Message{MessageID: "msg-1", ReceiptHandle: "rh-1"}); err != nil {
+		t.Fatal(err)
+	}
+	inputs := changer.calls()
+	if len(inputs) == 0 {
+		t.Fatal("no extensions")
+	}
+	for i, input := range inputs {
+		// The extensions are shortened so as not to exceed the cap.
+		if input.VisibilityTimeout != 1 {
+			t.Errorf("inputs[%d]: visibilityTimeout=%d", i, input.VisibilityTimeout)
+		}
+	}
+	events := exporter.GetSpans()[0].Events
+	if len(events) != len(inputs)+1 {
+		t.Fatalf("got %d events, want %d", len(events), len(inputs)+1)
+	}
+	if got := events[len(events)-1].Name; got != "otelpubsub.visibility_extension.cap_reached" {
+		t.Errorf("last event: %q", got)
+	}
+}
+
+func TestExtendVisibility_immediate(t *testing.T) {
+	t.Parallel()
+
+	changer := &visibilityChanger{}
+	processor := func(context.Context, *sub.Message) error {
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	}
+	// The default interval is longer than the processing, but the visibility timeout is extended as soon as the processing starts.
+	wrapped := sub.ExtendVisibility(processor, changer, heartbeatQueueURL, sub.WithVisibilityTimeout(5*time.Second), sub.WithImmediateExtension())
+	if err := wrapped(t.Context(), &sub.Message{MessageID: "msg-1", ReceiptHandle: "rh-1"}); err != nil {
+		t.Fatal(err)
+	}
+	inputs := changer.calls()
+	if len(inputs) != 1 {
+		t.Fatalf("got %d extensions, want 1", len(inputs))
+	}
+	if inputs[0].VisibilityTimeout != 5 {
+		t.Errorf("visibilityTimeout=%d", inputs[0].VisibilityTimeout)
+	}
+}
+
+func TestExtendVisibility_shortProcessing(t *testing.T) {
+	t.Parallel()
+
+	changer := &visibilityChanger{}
+	processor := func(context.Context, *sub.Message) error {
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	}
+	wrapped := sub.ExtendVisibility(processor, changer, heartbeatQueueURL, sub.WithVisibilityTimeout(5*time.Second))
+	if err := wrapped(t.Context(), &sub.Message{MessageID: "msg-1", ReceiptHandle: "rh-1"}); err != nil {
+		t.Fatal(err)
+	}
+	// The processing finishing within the interval costs no API calls.
+	if n := len(changer.calls()); n != 0 {
+		t.Errorf("got %d extensions, want 0", n)
+	}
+}
+
+func TestExtendVisibility_error(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name        string
+		code        string
+		wantStopped bool
+	}{
+		{name: "receipt handle is invalid", code: "ReceiptHandleIsInvalid", wantStopped: true},
+		{name: "message not in flight", code: "AWS.SimpleQueueService.MessageNotInflight", wantStopped: true},
+		{name: "throttled", code: "RequestThrottled"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			changer := &visibilityChanger{err: &smithy.GenericAPIError{Code: tc.code, Message: "error"}}
+			exporter := tracetest.NewInMemoryExporter()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+			processor := func(context.Context, *sub.Message) error {
+				time.Sleep(45 * time.Millisecond)
+				return nil
+			}
+			wrapped := sub.WrapProcessor(
+				sub.ExtendVisibility(processor, changer, heartbeatQueueURL, sub.WithHeartbeatInterval(10*time.Millisecond)),
+				sub.WithTracerProvider(tp))
+			if err := wrapped(t.Context(), &sub.Message{MessageID: "msg-1", ReceiptHandle: "rh-1"}); err != nil {
+				t.Fatal(err)
+			}
+			events := exporter.GetSpans()[0].Events
+			if len(events) == 0 {
+				t.Fatal("no events")
+			}
+			attrs := attributeMap(events[0].Attributes)
+			if got := attrs["error.type"]; got != tc.code {
+				t.Errorf("error.type=%v", got)
+			}
+			if got := attrs["otelpubsub.visibility_extension.timeout"]; got != int64(30) {
+				t.Errorf("timeout=%v", got)
+			}
+			if n := len(changer.calls()); tc.wantStopped != (n == 1) {
+				t.Errorf("extended %d times: wantStopped=%t", n, tc.wantStopped)
+			}
+			if len(events) != len(changer.calls()) {
+				t.Errorf("got %d events, want %d", len(events), len(changer.calls()))
+			}
+		})
+	}
+}
+
+type visibilityChanger struct {
+	mux    sync.Mutex
+	inputs []*sqs.ChangeMessageVisibilityInput
+	err    error
+}
+
+var _ sub.VisibilityChanger = (*visibilityChanger)(nil)
+
+func (c *visibilityChanger) ChangeMessageVisibility(_ context.Context, params *sqs.ChangeMessageVisibilityInput, _ ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityOutput, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.inputs = append(c.inputs, params)
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &sqs.ChangeMessageVisibilityOutput{}, nil
+}
+
+func (c *visibilityChanger) calls() []*sqs.ChangeMessageVisibilityInput {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return append([]*sqs.ChangeMessageVisibilityInput(nil), c.inputs...)
+}
+
+func attributeMap(attrs []attribute.KeyValue) map[attribute.Key]any {
+	ret := make(map[attribute.Key]any, len(attrs))
+	for _, kv := range attrs {
+		ret[kv.Key] = kv.Value.AsInterface()
+	}
+	return ret
+}
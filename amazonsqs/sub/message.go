@@ -1,6 +1,10 @@
 package sub
 
-import "encoding/json"
+import (
+	"encoding/json"
+
+	"github.com/aereal/otelpubsub/amazonsqs/internal/envelope"
+)
 
 // Message represents an SQS message as delivered by AWS Lambda SQS event source mapping.
 // This structure matches the JSON format of records in an SQSEvent.
@@ -16,3 +20,19 @@ type Message struct {
 	AWSRegion              string            `json:"awsRegion"`
 	Body                   json.RawMessage   `json:"body"`
 }
+
+// UnwrappedBody returns the message body as a string.
+// If the pub package wrapped the body into an envelope to carry the trace context, the original body is returned.
+func (m *Message) UnwrappedBody() string {
+	_, original, _ := envelope.Unwrap(m.bodyString())
+	return original
+}
+
+// bodyString returns the body decoded from a JSON string, or the raw body if it is not a JSON string.
+func (m *Message) bodyString() string {
+	var s string
+	if err := json.Unmarshal(m.Body, &s); err != nil {
+		return string(m.Body)
+	}
+	return s
+}
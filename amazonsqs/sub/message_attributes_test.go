@@ -3,6 +3,7 @@ package sub_test
 import (
 	"testing"
 
+	"github.com/aereal/otelpubsub/amazonsqs/internal/packed"
 	"github.com/aereal/otelpubsub/amazonsqs/sub"
 	"github.com/google/go-cmp/cmp"
 )
@@ -35,3 +36,65 @@ func TestMessageAttributes_carrier(t *testing.T) {
 		t.Errorf("Keys() (-want, +got):\n%s", diff)
 	}
 }
+
+func TestMessageAttributes_packed(t *testing.T) {
+	t.Parallel()
+
+	fields := map[string]string{
+		"traceparent": "00-abcdef121234567890abcdef12345678-1234567890abcdef-01",
+		"tracestate":  "vendor=value",
+	}
+	packedJSON, err := packed.MarshalJSON(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		attrs    sub.MessageAttributes
+		name     string
+		wantKeys []string
+		wantTS   string
+	}{
+		{
+			name:     "JSON",
+			attrs:    sub.MessageAttributes{packed.AttributeName: sub.StringAttributeValue(packedJSON)},
+			wantKeys: []string{"traceparent", "tracestate"},
+			wantTS:   "vendor=value",
+		},
+		{
+			name:     "binary",
+			attrs:    sub.MessageAttributes{packed.AttributeName: sub.BinaryAttributeValue(packed.MarshalBinary(fields))},
+			wantKeys: []string{"traceparent", "tracestate"},
+			wantTS:   "vendor=value",
+		},
+		{
+			name: "individual attribute takes precedence",
+			attrs: sub.MessageAttributes{
+				packed.AttributeName: sub.StringAttributeValue(packedJSON),
+				"tracestate":         sub.StringAttributeValue("other=value"),
+			},
+			wantKeys: []string{"traceparent", "tracestate"},
+			wantTS:   "other=value",
+		},
+		{
+			name:     "corrupted",
+			attrs:    sub.MessageAttributes{packed.AttributeName: sub.StringAttributeValue("{")},
+			wantKeys: []string{},
+			wantTS:   "",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := tc.attrs.Get("tracestate"); got != tc.wantTS {
+				t.Errorf("Get(tracestate): want=%q got=%q", tc.wantTS, got)
+			}
+			if got := tc.attrs.Get(packed.AttributeName); got != "" {
+				t.Errorf("Get(%s): got=%q", packed.AttributeName, got)
+			}
+			if diff := cmp.Diff(tc.wantKeys, tc.attrs.Keys()); diff != "" {
+				t.Errorf("Keys() (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
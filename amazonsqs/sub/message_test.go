@@ -4,8 +4,6 @@ import (
 	"embed"
 	"encoding/json"
 	"fmt"
-	"maps"
-	"slices"
 	"testing"
 
 	"github.com/aereal/otelpubsub/amazonsqs/sub"
@@ -87,10 +85,122 @@ func TestMessage_unmarshal(t *testing.T) {
 		t.Fatal(err)
 	}
 	msg := ev.Records[0]
-	t.Logf("%d message attributes", len(msg.MessageAttributes))
-	for _, key := range slices.Sorted(maps.Keys(msg.MessageAttributes)) {
-		value := msg.MessageAttributes[key]
-		t.Logf("key=%s type=%s", key, value.Type())
+	testCases := []struct {
+		name           string
+		wantType       sub.AttributeType
+		wantString     string
+		wantNumber     string
+		wantBinary     string
+		wantStringList []string
+		wantBinaryList []string
+		wantStringOK   bool
+		wantNumberOK   bool
+		wantBinaryOK   bool
+	}{
+		{
+			name:           "Attribute1",
+			wantType:       sub.AttributeTypeString,
+			wantString:     "AttributeValue1",
+			wantStringOK:   true,
+			wantStringList: []string{},
+			wantBinaryList: []string{},
+		},
+		{
+			name:           "Attribute2",
+			wantType:       sub.AttributeTypeNumber,
+			wantNumber:     "123",
+			wantNumberOK:   true,
+			wantStringList: []string{},
+			wantBinaryList: []string{"MQ==", "MA=="},
+		},
+		{
+			name:           "Attribute3",
+			wantType:       sub.AttributeTypeBinary,
+			wantBinary:     "MTEwMA==",
+			wantBinaryOK:   true,
+			wantStringList: []string{"abc", "123"},
+			wantBinaryList: []string{"MA==", "MQ==", "MA=="},
+		},
+	}
+	if len(msg.MessageAttributes) != len(testCases) {
+		t.Fatalf("got %d message attributes, want %d", len(msg.MessageAttributes), len(testCases))
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			av, ok := msg.MessageAttributes[tc.name]
+			if !ok {
+				t.Fatal("missing attribute")
+			}
+			if av.Type() != tc.wantType {
+				t.Errorf("Type: want=%s got=%s", tc.wantType, av.Type())
+			}
+			t.Run("String", assertValueGetter(av.StringValue, &attributeValueExpectation{value: tc.wantString, ok: tc.wantStringOK}))
+			t.Run("Number", assertValueGetter(av.NumberValue, &attributeValueExpectation{value: tc.wantNumber, ok: tc.wantNumberOK}))
+			t.Run("Binary", assertValueGetter(av.Base64EncodedBinaryValue, &attributeValueExpectation{value: tc.wantBinary, ok: tc.wantBinaryOK}))
+			lav, ok := av.(sub.ListAttributeValue)
+			if !ok {
+				t.Fatalf("%T does not implement ListAttributeValue", av)
+			}
+			if diff := cmp.Diff(tc.wantStringList, lav.StringListValues()); diff != "" {
+				t.Errorf("StringListValues (-want, +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.wantBinaryList, lav.Base64EncodedBinaryListValues()); diff != "" {
+				t.Errorf("Base64EncodedBinaryListValues (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestMessageAttributes_roundTrip(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+		json string
+	}{
+		{
+			name: "lambda event",
+			json: `{"Attribute3":{"binaryValue":"MTEwMA==","stringListValues":["abc","123"],"binaryListValues":["MA==","MQ==","MA=="],"dataType":"Binary"},"Attribute2":{"stringValue":"123","stringListValues":[],"binaryListValues":["MQ==","MA=="],"dataType":"Number"},"Attribute1":{"stringValue":"AttributeValue1","stringListValues":[],"binaryListValues":[],"dataType":"String"}}`,
+		},
+		{
+			name: "custom types",
+			json: `{"requestId":{"stringValue":"6f1d1a7e-7f0e-4b8e-9d5a-1c2b3d4e5f60","stringListValues":[],"binaryListValues":[],"dataType":"String.UUID"},"thumbnail":{"binaryValue":"iVBORw0K","stringListValues":[],"binaryListValues":[],"dataType":"Binary.png"},"price":{"stringValue":"1.5","stringListValues":[],"binaryListValues":[],"dataType":"Number.float"}}`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var ma sub.MessageAttributes
+			if err := json.Unmarshal([]byte(tc.json), &ma); err != nil {
+				t.Fatal(err)
+			}
+			got, err := json.Marshal(ma)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := diffJSONMessage(json.RawMessage(tc.json), got); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestCustomAttributeValue(t *testing.T) {
+	t.Parallel()
+
+	got, err := json.Marshal(sub.MessageAttributes{
+		"requestId": sub.CustomAttributeValue(sub.CustomType(sub.AttributeKindString, "UUID"), "6f1d1a7e-7f0e-4b8e-9d5a-1c2b3d4e5f60"),
+		"thumbnail": sub.CustomAttributeValue(sub.CustomType(sub.AttributeKindBinary, "png"), "iVBORw0K"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"requestId":{"stringValue":"6f1d1a7e-7f0e-4b8e-9d5a-1c2b3d4e5f60","stringListValues":[],"binaryListValues":[],"dataType":"String.UUID"},"thumbnail":{"binaryValue":"iVBORw0K","stringListValues":[],"binaryListValues":[],"dataType":"Binary.png"}}`
+	if err := diffJSONMessage(json.RawMessage(want), got); err != nil {
+		t.Error(err)
 	}
 }
 
@@ -106,3 +216,28 @@ func diffJSONMessage(want, got json.RawMessage) error {
 	}
 	return nil
 }
+
+func TestMessage_UnwrappedBody(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+		body json.RawMessage
+		want string
+	}{
+		{name: "wrapped", body: json.RawMessage(`"{\"otelpubsub.envelope\":1,\"otelpubsub.body\":\"hello\",\"otelpubsub.propagation\":{\"traceparent\":\"00-0123456789abcdef0123456789abcdef-1234567890abcdef-01\"}}"`), want: "hello"},
+		{name: "augmented", body: json.RawMessage(`"{\"id\":1,\"otelpubsub.propagation\":{}}"`), want: `{"id":1,"otelpubsub.propagation":{}}`},
+		{name: "plain", body: json.RawMessage(`"hello"`), want: "hello"},
+		{name: "raw", body: json.RawMessage(`{"id":1}`), want: `{"id":1}`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			msg := &sub.Message{Body: tc.body}
+			if got := msg.UnwrappedBody(); got != tc.want {
+				t.Errorf("want=%q got=%q", tc.want, got)
+			}
+		})
+	}
+}
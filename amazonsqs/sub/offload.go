@@ -0,0 +1,98 @@
+package sub
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/aereal/otelpubsub/amazonsqs/internal/s3pointer"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.39.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// PayloadDownloader downloads the message bodies offloaded to S3.
+// It is typically implemented with the GetObject API of the S3 client, returning the user-defined object metadata.
+type PayloadDownloader interface {
+	DownloadPayload(ctx context.Context, bucket, key string) (body []byte, metadata map[string]string, err error)
+}
+
+// PayloadResolver resolves the message bodies offloaded to S3 by the pub package or the SQS extended client libraries.
+type PayloadResolver struct {
+	downloader PayloadDownloader
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+// NewPayloadResolver returns a [PayloadResolver] that fetches the bodies through the downloader.
+// Only [WithTracerProvider] and [WithPropagator] take effect.
+func NewPayloadResolver(downloader PayloadDownloader, opts ...StartProcessSpanOption) *PayloadResolver {
+	cfg := newConfig(opts)
+	return &PayloadResolver{
+		downloader: downloader,
+		tracer:     cfg.tracerProvider.Tracer(tracerName),
+		propagator: cfg.propagator,
+	}
+}
+
+// Resolve returns a copy of the message with the body fetched from S3 if the body is offloaded, or the message itself otherwise.
+// The fetch is traced with a child span of ctx, linked to the trace context found in the object metadata.
+func (r *PayloadResolver) Resolve(ctx context.Context, msg *Message) (_ *Message, err error) {
+	if msg == nil || !msg.isOffloaded() {
+		return msg, nil
+	}
+	pointer, ok := s3pointer.Decode(msg.bodyString())
+	if !ok {
+		return msg, nil
+	}
+	ctx, span := r.tracer.Start(ctx, "fetch",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.AWSS3Bucket(pointer.Bucket),
+			semconv.AWSS3Key(pointer.Key),
+			semconv.MessagingSystemAWSSQS,
+		),
+	)
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "")
+		}
+		span.End()
+	}()
+	body, metadata, err := r.downloader.DownloadPayload(ctx, pointer.Bucket, pointer.Key)
+	if err != nil {
+		return nil, err
+	}
+	if sc := trace.SpanContextFromContext(r.propagator.Extract(context.Background(), propagation.MapCarrier(metadata))); sc.IsValid() {
+		span.AddLink(trace.Link{SpanContext: sc})
+	}
+	encoded, err := json.Marshal(string(body))
+	if err != nil {
+		return nil, err
+	}
+	resolved := *msg
+	resolved.Body = encoded
+	return &resolved, nil
+}
+
+// resolvePayload resolves the message body with the resolver specified by [WithPayloadResolver], if any.
+func resolvePayload(ctx context.Context, msg *Message, opts []StartProcessSpanOption) (*Message, error) {
+	var cfg config
+	for _, o := range opts {
+		o.applyStartProcessSpanOption(&cfg)
+	}
+	if cfg.payloadResolver == nil {
+		return msg, nil
+	}
+	return cfg.payloadResolver.Resolve(ctx, msg)
+}
+
+// isOffloaded reports whether the message has the attribute the extended client libraries set on the offloaded messages.
+func (m *Message) isOffloaded() bool {
+	if _, ok := m.MessageAttributes[s3pointer.AttributeName]; ok {
+		return true
+	}
+	_, ok := m.MessageAttributes[s3pointer.LegacyAttributeName]
+	return ok
+}
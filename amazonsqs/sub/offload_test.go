@@ -0,0 +1,162 @@
+package sub_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aereal/otelpubsub/amazonsqs/sub"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestPayloadResolver(t *testing.T) {
+	t.Parallel()
+
+	const (
+		producerTraceID = "abcdef121234567890abcdef12345678"
+		producerSpanID  = "1234567890abcdef"
+		pointerBody     = `["software.amazon.payloadoffloading.PayloadS3Pointer",{"s3BucketName":"bucket-1","s3Key":"key-1"}]`
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/bucket-1/key-1" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("x-amz-meta-traceparent", fmt.Sprintf("00-%s-%s-01", producerTraceID, producerSpanID))
+		_, _ = io.WriteString(w, "large body")
+	}))
+	t.Cleanup(srv.Close)
+
+	testCases := []struct {
+		name      string
+		msg       *sub.Message
+		wantBody  string
+		wantFetch bool
+		wantErr   bool
+	}{
+		{
+			name: "offloaded",
+			msg: &sub.Message{
+				MessageAttributes: sub.MessageAttributes{"ExtendedPayloadSize": sub.NumberAttributeValue("10")},
+				Body:              mustMarshalJSON(t, pointerBody),
+			},
+			wantBody:  "large body",
+			wantFetch: true,
+		},
+		{
+			name: "offloaded/legacy attribute",
+			msg: &sub.Message{
+				MessageAttributes: sub.MessageAttributes{"SQSLargePayloadSize": sub.NumberAttributeValue("10")},
+				Body:              mustMarshalJSON(t, pointerBody),
+			},
+			wantBody:  "large body",
+			wantFetch: true,
+		},
+		{
+			name: "offloaded/missing object",
+			msg: &sub.Message{
+				MessageAttributes: sub.MessageAttributes{"ExtendedPayloadSize": sub.NumberAttributeValue("10")},
+				Body:              mustMarshalJSON(t, strings.Replace(pointerBody, "key-1", "key-2", 1)),
+			},
+			wantFetch: true,
+			wantErr:   true,
+		},
+		{
+			name:     "pointer-like body without the attribute",
+			msg:      &sub.Message{Body: mustMarshalJSON(t, pointerBody)},
+			wantBody: pointerBody,
+		},
+		{
+			name:     "not offloaded",
+			msg:      &sub.Message{Body: mustMarshalJSON(t, "small body")},
+			wantBody: "small body",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			exporter := tracetest.NewInMemoryExporter()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+			resolver := sub.NewPayloadResolver(&httpDownloader{endpoint: srv.URL}, sub.WithTracerProvider(tp), sub.WithPropagator(propagation.TraceContext{}))
+			var gotBody string
+			process := sub.WrapProcessor(func(_ context.Context, msg *sub.Message) error {
+				gotBody = msg.UnwrappedBody()
+				return nil
+			}, sub.WithTracerProvider(tp), sub.WithPropagator(propagation.TraceContext{}), sub.WithPayloadResolver(resolver))
+			if err := process(t.Context(), tc.msg); (err != nil) != tc.wantErr {
+				t.Fatalf("error: want=%v got=%v", tc.wantErr, err)
+			}
+			if !tc.wantErr && gotBody != tc.wantBody {
+				t.Errorf("body: want=%q got=%q", tc.wantBody, gotBody)
+			}
+
+			spans := exporter.GetSpans()
+			if !tc.wantFetch {
+				if len(spans) != 1 {
+					t.Errorf("got %d spans, want only the process span", len(spans))
+				}
+				return
+			}
+			if len(spans) != 2 {
+				t.Fatalf("got %d spans, want 2", len(spans))
+			}
+			fetchSpan, processSpan := spans[0], spans[1]
+			if fetchSpan.Name != "fetch" || fetchSpan.SpanKind != trace.SpanKindClient {
+				t.Errorf("fetch span: name=%q kind=%s", fetchSpan.Name, fetchSpan.SpanKind)
+			}
+			if fetchSpan.Parent.SpanID() != processSpan.SpanContext.SpanID() {
+				t.Errorf("the fetch span is not a child of the process span")
+			}
+			if tc.wantErr {
+				if processSpan.Status.Code != codes.Error {
+					t.Errorf("process span status: %s", processSpan.Status.Code)
+				}
+				return
+			}
+			if len(fetchSpan.Links) != 1 {
+				t.Fatalf("got %d links, want 1", len(fetchSpan.Links))
+			}
+			if got := fetchSpan.Links[0].SpanContext; got.TraceID().String() != producerTraceID || got.SpanID().String() != producerSpanID {
+				t.Errorf("link: got %s/%s", got.TraceID(), got.SpanID())
+			}
+		})
+	}
+}
+
+// httpDownloader downloads the objects from an S3 stand-in.
+type httpDownloader struct{ endpoint string }
+
+func (d *httpDownloader) DownloadPayload(ctx context.Context, bucket, key string) ([]byte, map[string]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.endpoint+"/"+bucket+"/"+key, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("GetObject: %s", resp.Status) //nolint:err113
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	metadata := map[string]string{}
+	for name := range resp.Header {
+		if key, ok := strings.CutPrefix(strings.ToLower(name), "x-amz-meta-"); ok {
+			metadata[key] = resp.Header.Get(name)
+		}
+	}
+	return body, metadata, nil
+}
@@ -1,16 +1,36 @@
 package sub
 
 import (
+	"github.com/aereal/otelpubsub/amazonsqs/internal"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/trace"
 )
 
-var _ = otel.GetTracerProvider
-
 type config struct {
-	tracerProvider     trace.TracerProvider
-	startSpanOptions   []trace.SpanStartOption
-	attributeProducers []SQSProcessSpanAttributeProducer
+	tracerProvider      trace.TracerProvider
+	propagator          propagation.TextMapPropagator
+	startSpanOptions    []trace.SpanStartOption
+	attributeProducers  []SQSProcessSpanAttributeProducer
+	traceContextSources []TraceContextSource
+	payloadResolver     *PayloadResolver
+}
+
+func newConfig(opts []StartProcessSpanOption) config {
+	var cfg config
+	for _, o := range opts {
+		o.applyStartProcessSpanOption(&cfg)
+	}
+	if cfg.tracerProvider == nil {
+		cfg.tracerProvider = otel.GetTracerProvider()
+	}
+	if cfg.propagator == nil {
+		cfg.propagator = internal.Propagator
+	}
+	if cfg.traceContextSources == nil {
+		cfg.traceContextSources = defaultTraceContextSources
+	}
+	return cfg
 }
 
 // StartProcessSpanOption configures [StartProcessSpan] behavior.
@@ -28,6 +48,16 @@ type optionWithTracerProvider struct{ tp trace.TracerProvider }
 
 func (o *optionWithTracerProvider) applyStartProcessSpanOption(c *config) { c.tracerProvider = o.tp }
 
+// WithPropagator specifies the [propagation.TextMapPropagator] to extract trace context and baggage from message attributes.
+// If not specified, [otel.GetTextMapPropagator] is used, or W3C Trace Context and Baggage while no global propagator is set.
+func WithPropagator(p propagation.TextMapPropagator) StartProcessSpanOption {
+	return &optionWithPropagator{p: p}
+}
+
+type optionWithPropagator struct{ p propagation.TextMapPropagator }
+
+func (o *optionWithPropagator) applyStartProcessSpanOption(c *config) { c.propagator = o.p }
+
 // WithStartSpanOptions appends additional [trace.SpanStartOption] to the span creation.
 func WithStartSpanOptions(opts ...trace.SpanStartOption) StartProcessSpanOption {
 	return &optionWithStartSpanOptions{opts: opts}
@@ -51,3 +81,29 @@ type optionWithAttributeProducers struct {
 func (o *optionWithAttributeProducers) applyStartProcessSpanOption(c *config) {
 	c.attributeProducers = append(c.attributeProducers, o.producers...)
 }
+
+// WithTraceContextSources specifies where to look for the trace context of the producer, in the order of precedence.
+// The span is linked to the first valid span context found.
+// For example, passing [TraceContextSourceMessageAttributes] then [TraceContextSourceAWSTraceHeader]
+// falls back to AWSTraceHeader only when the message attributes have no trace context.
+// If not specified, [TraceContextSourceMessageAttributes] then [TraceContextSourceBodyEnvelope] are used.
+func WithTraceContextSources(sources ...TraceContextSource) StartProcessSpanOption {
+	return &optionWithTraceContextSources{sources: sources}
+}
+
+type optionWithTraceContextSources struct{ sources []TraceContextSource }
+
+func (o *optionWithTraceContextSources) applyStartProcessSpanOption(c *config) {
+	c.traceContextSources = o.sources
+}
+
+// WithPayloadResolver makes [WrapProcessor] and [WrapYielder] resolve the message bodies offloaded to S3 with the [PayloadResolver]
+// in the process span before calling the wrapped function.
+// It does not affect [StartProcessSpan].
+func WithPayloadResolver(r *PayloadResolver) StartProcessSpanOption {
+	return &optionWithPayloadResolver{r: r}
+}
+
+type optionWithPayloadResolver struct{ r *PayloadResolver }
+
+func (o *optionWithPayloadResolver) applyStartProcessSpanOption(c *config) { c.payloadResolver = o.r }
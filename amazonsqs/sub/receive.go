@@ -0,0 +1,86 @@
+package sub
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"log/slog"
+	"maps"
+
+	"github.com/aereal/otelpubsub/amazonsqs/internal/utils"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// eventSourceSQS is the event source of the messages delivered by the SQS event source mapping.
+const eventSourceSQS = "aws:sqs"
+
+// FromReceivedMessage converts a message received with the ReceiveMessage API into a [Message]
+// in the shape AWS Lambda delivers, so that polling consumers can use [StartProcessSpan] and [WrapProcessor] as Lambda consumers do.
+// queue is the URL or the ARN of the queue the message is received from; EventSourceARN and AWSRegion are derived from it.
+//
+// Attributes are keyed by the message system attribute names, such as SentTimestamp and AWSTraceHeader,
+// which are only returned if requested with MessageSystemAttributeNames of the ReceiveMessage API.
+// Message attributes of unknown data types are dropped.
+func FromReceivedMessage(queue string, msg types.Message) *Message {
+	ret := &Message{
+		Attributes:             maps.Clone(msg.Attributes),
+		MessageID:              deref(msg.MessageId),
+		ReceiptHandle:          deref(msg.ReceiptHandle),
+		MD5OfBody:              deref(msg.MD5OfBody),
+		MD5OfMessageAttributes: deref(msg.MD5OfMessageAttributes),
+		EventSource:            eventSourceSQS,
+	}
+	if ret.Attributes == nil {
+		ret.Attributes = map[string]string{}
+	}
+	if queueARN := utils.QueueARNOf(queue); queueARN != "" {
+		ret.EventSourceARN = queueARN
+		if parsed, err := arn.Parse(queueARN); err == nil {
+			ret.AWSRegion = parsed.Region
+		}
+	}
+	if body, err := json.Marshal(deref(msg.Body)); err == nil {
+		ret.Body = body
+	}
+	if len(msg.MessageAttributes) > 0 {
+		ret.MessageAttributes = make(MessageAttributes, len(msg.MessageAttributes))
+		for name, value := range msg.MessageAttributes {
+			av, err := attributeValueOf(value)
+			if err != nil {
+				slog.Warn("failed to convert message attribute", slog.String("name", name), slog.String("error", err.Error()))
+				continue
+			}
+			ret.MessageAttributes[name] = av
+		}
+	}
+	return ret
+}
+
+// attributeValueOf converts a message attribute value of the SDK into an [AttributeValue].
+func attributeValueOf(value types.MessageAttributeValue) (AttributeValue, error) {
+	dataType, err := parseAttributeType(deref(value.DataType))
+	if err != nil {
+		return nil, err
+	}
+	payload := &attributeValuePayload{
+		DataType:         dataType,
+		StringValue:      value.StringValue,
+		StringListValues: value.StringListValues,
+	}
+	if value.BinaryValue != nil {
+		encoded := base64.StdEncoding.EncodeToString(value.BinaryValue)
+		payload.BinaryValue = &encoded
+	}
+	for _, v := range value.BinaryListValues {
+		payload.BinaryListValues = append(payload.BinaryListValues, base64.StdEncoding.EncodeToString(v))
+	}
+	return &attributeValue{payload: payload}, nil
+}
+
+func deref[V any](ptr *V) V {
+	var zero V
+	if ptr == nil {
+		return zero
+	}
+	return *ptr
+}
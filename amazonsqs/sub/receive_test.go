@@ -0,0 +1,153 @@
+package sub_test
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/aereal/otelpubsub/amazonsqs/internal/utils"
+	"github.com/aereal/otelpubsub/amazonsqs/sub"
+	semconv "github.com/aereal/otelpubsub/amazonsqs/sub/semconv/v1.39.0"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/google/go-cmp/cmp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestFromReceivedMessage(t *testing.T) {
+	t.Parallel()
+
+	received := types.Message{
+		MessageId:              utils.Ptr("059f36b4-87a3-44ab-83d2-661975830a7d"),
+		ReceiptHandle:          utils.Ptr("AQEBwJnKyrHigUMZj6rYigCgxlaS3SLy0a"),
+		Body:                   utils.Ptr("test"),
+		MD5OfBody:              utils.Ptr("098f6bcd4621d373cade4e832627b4f6"),
+		MD5OfMessageAttributes: utils.Ptr("582c92c5c5b6ac403040a4f3ab3115c9"),
+		Attributes: map[string]string{
+			string(types.MessageSystemAttributeNameSentTimestamp):           "1545082649183",
+			string(types.MessageSystemAttributeNameApproximateReceiveCount): "1",
+		},
+		MessageAttributes: map[string]types.MessageAttributeValue{
+			"traceparent": {DataType: utils.Ptr("String"), StringValue: utils.Ptr("00-abcdef121234567890abcdef12345678-1234567890abcdef-01")},
+			"requestId":   {DataType: utils.Ptr("String.UUID"), StringValue: utils.Ptr("6f1d1a7e-7f0e-4b8e-9d5a-1c2b3d4e5f60")},
+			"count":       {DataType: utils.Ptr("Number"), StringValue: utils.Ptr("3")},
+			"thumbnail":   {DataType: utils.Ptr("Binary.png"), BinaryValue: []byte{1, 1, 0, 0}},
+			"unknown":     {DataType: utils.Ptr("Unknown"), StringValue: utils.Ptr("x")},
+		},
+	}
+	got, err := json.Marshal(sub.FromReceivedMessage("https://sqs.us-east-2.amazonaws.com/123456789012/my-queue", received))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{
+		"messageId": "059f36b4-87a3-44ab-83d2-661975830a7d",
+		"receiptHandle": "AQEBwJnKyrHigUMZj6rYigCgxlaS3SLy0a",
+		"body": "test",
+		"attributes": {"SentTimestamp": "1545082649183", "ApproximateReceiveCount": "1"},
+		"messageAttributes": {
+			"traceparent": {"stringValue": "00-abcdef121234567890abcdef12345678-1234567890abcdef-01", "stringListValues": [], "binaryListValues": [], "dataType": "String"},
+			"requestId": {"stringValue": "6f1d1a7e-7f0e-4b8e-9d5a-1c2b3d4e5f60", "stringListValues": [], "binaryListValues": [], "dataType": "String.UUID"},
+			"count": {"stringValue": "3", "stringListValues": [], "binaryListValues": [], "dataType": "Number"},
+			"thumbnail": {"binaryValue": "AQEAAA==", "stringListValues": [], "binaryListValues": [], "dataType": "Binary.png"}
+		},
+		"md5OfBody": "098f6bcd4621d373cade4e832627b4f6",
+		"md5OfMessageAttributes": "582c92c5c5b6ac403040a4f3ab3115c9",
+		"eventSource": "aws:sqs",
+		"eventSourceARN": "arn:aws:sqs:us-east-2:123456789012:my-queue",
+		"awsRegion": "us-east-2"
+	}`
+	if err := diffJSONMessage(json.RawMessage(want), got); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFromReceivedMessage_eventSourceARN(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		queue      string
+		wantARN    string
+		wantRegion string
+	}{
+		{queue: "https://sqs.ap-northeast-1.amazonaws.com/123456789012/queue-1", wantARN: "arn:aws:sqs:ap-northeast-1:123456789012:queue-1", wantRegion: "ap-northeast-1"},
+		{queue: "https://sqs.cn-north-1.amazonaws.com.cn/123456789012/queue-1", wantARN: "arn:aws-cn:sqs:cn-north-1:123456789012:queue-1", wantRegion: "cn-north-1"},
+		{queue: "https://us-west-2.queue.amazonaws.com/123456789012/queue-1", wantARN: "arn:aws:sqs:us-west-2:123456789012:queue-1", wantRegion: "us-west-2"},
+		{queue: "https://queue.amazonaws.com/123456789012/queue-1", wantARN: "arn:aws:sqs:us-east-1:123456789012:queue-1", wantRegion: "us-east-1"},
+		{queue: "arn:aws:sqs:eu-west-1:123456789012:queue-1", wantARN: "arn:aws:sqs:eu-west-1:123456789012:queue-1", wantRegion: "eu-west-1"},
+		{queue: "http://localhost:4566/000000000000/queue-1"},
+		{queue: ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.queue, func(t *testing.T) {
+			t.Parallel()
+
+			msg := sub.FromReceivedMessage(tc.queue, types.Message{})
+			if msg.EventSourceARN != tc.wantARN {
+				t.Errorf("EventSourceARN: want=%q got=%q", tc.wantARN, msg.EventSourceARN)
+			}
+			if msg.AWSRegion != tc.wantRegion {
+				t.Errorf("AWSRegion: want=%q got=%q", tc.wantRegion, msg.AWSRegion)
+			}
+		})
+	}
+}
+
+func TestFromReceivedMessage_sameSpanAsLambda(t *testing.T) {
+	t.Parallel()
+
+	f, err := testdata.Open("testdata/event_traceparent.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = f.Close() })
+	var ev sub.Event
+	if err := json.NewDecoder(f).Decode(&ev); err != nil {
+		t.Fatal(err)
+	}
+	lambdaMsg := &ev.Records[0]
+	received := types.Message{
+		MessageId:     utils.Ptr(lambdaMsg.MessageID),
+		ReceiptHandle: utils.Ptr(lambdaMsg.ReceiptHandle),
+		Body:          utils.Ptr("test"),
+		MD5OfBody:     utils.Ptr(lambdaMsg.MD5OfBody),
+		Attributes:    lambdaMsg.Attributes,
+		MessageAttributes: map[string]types.MessageAttributeValue{
+			"traceparent": {DataType: utils.Ptr("String"), StringValue: utils.Ptr("00-abcdef121234567890abcdef12345678-1234567890abcdef-01")},
+			"requestId":   {DataType: utils.Ptr("String.UUID"), StringValue: utils.Ptr("6f1d1a7e-7f0e-4b8e-9d5a-1c2b3d4e5f60")},
+		},
+	}
+	polledMsg := sub.FromReceivedMessage("https://sqs.us-east-2.amazonaws.com/123456789012/my-queue", received)
+
+	spanOf := func(msg *sub.Message) tracetest.SpanStub {
+		exporter := tracetest.NewInMemoryExporter()
+		tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+		_, span := sub.StartProcessSpan(t.Context(), msg,
+			sub.WithTracerProvider(tp),
+			sub.WithPropagator(propagation.TraceContext{}),
+			sub.WithAttributeProducers(semconv.ProcessSpanAttributeProducer{}),
+		)
+		span.End()
+		return exporter.GetSpans()[0]
+	}
+	want, got := spanOf(lambdaMsg), spanOf(polledMsg)
+	if diff := cmp.Diff(sortedAttributes(want.Attributes), sortedAttributes(got.Attributes), cmp.Comparer(func(a, b attribute.Value) bool { return a.Emit() == b.Emit() })); diff != "" {
+		t.Errorf("attributes (-lambda, +polled):\n%s", diff)
+	}
+	if len(got.Links) != 1 || got.Links[0].SpanContext.TraceID() != want.Links[0].SpanContext.TraceID() || got.Links[0].SpanContext.SpanID() != want.Links[0].SpanContext.SpanID() {
+		t.Errorf("links: lambda=%#v polled=%#v", want.Links, got.Links)
+	}
+}
+
+func sortedAttributes(attrs []attribute.KeyValue) []attribute.KeyValue {
+	return slices.SortedFunc(slices.Values(attrs), func(a, b attribute.KeyValue) int {
+		if a.Key < b.Key {
+			return -1
+		}
+		if a.Key > b.Key {
+			return 1
+		}
+		return 0
+	})
+}
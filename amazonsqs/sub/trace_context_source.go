@@ -0,0 +1,70 @@
+package sub
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/aereal/otelpubsub/amazonsqs/internal/envelope"
+	"github.com/aereal/otelpubsub/amazonsqs/internal/xray"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// AttributeNameAWSTraceHeader is the name of the message system attribute that holds the X-Ray trace header.
+const AttributeNameAWSTraceHeader = "AWSTraceHeader"
+
+// TraceContextSource identifies where [StartProcessSpan] looks for the trace context of the producer.
+type TraceContextSource int
+
+const (
+	// TraceContextSourceMessageAttributes extracts the trace context from the message attributes with the propagator.
+	TraceContextSourceMessageAttributes TraceContextSource = iota + 1
+	// TraceContextSourceAWSTraceHeader parses the AWSTraceHeader message system attribute in the X-Ray format.
+	//
+	// It is set by X-Ray instrumented producers and by SNS or EventBridge active tracing.
+	TraceContextSourceAWSTraceHeader
+	// TraceContextSourceBodyEnvelope extracts the trace context from the envelope the pub package injected into the message body.
+	//
+	// It is for delivery paths that drop message attributes; see the BodyEnvelopeMode of the pub package.
+	TraceContextSourceBodyEnvelope
+)
+
+var defaultTraceContextSources = []TraceContextSource{TraceContextSourceMessageAttributes, TraceContextSourceBodyEnvelope}
+
+// remoteSpanContext returns the first valid span context found in the sources,
+// and the context to take the baggage from.
+// remoteCtx is the context extracted from the message attributes.
+func remoteSpanContext(sources []TraceContextSource, propagator propagation.TextMapPropagator, remoteCtx context.Context, msg *Message) (context.Context, trace.SpanContext) {
+	for _, source := range sources {
+		ctx := remoteCtx
+		var sc trace.SpanContext
+		switch source {
+		case TraceContextSourceMessageAttributes:
+			sc = trace.SpanContextFromContext(remoteCtx)
+		case TraceContextSourceAWSTraceHeader:
+			sc = spanContextFromTraceHeader(msg)
+		case TraceContextSourceBodyEnvelope:
+			if fields, _, ok := envelope.Unwrap(msg.bodyString()); ok {
+				ctx = propagator.Extract(remoteCtx, propagation.MapCarrier(fields))
+				sc = trace.SpanContextFromContext(ctx)
+			}
+		}
+		if sc.IsValid() {
+			return ctx, sc
+		}
+	}
+	return remoteCtx, trace.SpanContext{}
+}
+
+func spanContextFromTraceHeader(msg *Message) trace.SpanContext {
+	header, ok := msg.Attributes[AttributeNameAWSTraceHeader]
+	if !ok {
+		return trace.SpanContext{}
+	}
+	sc, err := xray.ParseHeader(header)
+	if err != nil {
+		slog.Warn("failed to parse AWSTraceHeader", slog.String("error", err.Error()))
+		return trace.SpanContext{}
+	}
+	return sc
+}
@@ -3,18 +3,20 @@ package sub
 import (
 	"context"
 
-	"github.com/aereal/otelpubsub/amazonsqs/internal"
-	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
 )
 
+const tracerName = "github.com/aereal/otelpubsub/amazonsqs/sub"
+
 // Processor is a function type that processes an SQS message.
 type Processor func(context.Context, *Message) error
 
 // WrapProcessor wraps a [Processor] to automatically start and end a span for each message processing.
 // Errors returned from the wrapped function are recorded on the span.
+// See [WithPayloadResolver] to pass the message with the body offloaded to S3 resolved.
 func WrapProcessor(f Processor, opts ...StartProcessSpanOption) Processor {
 	return func(ctx context.Context, msg *Message) (err error) {
 		ctx, span := StartProcessSpan(ctx, msg, opts...)
@@ -26,6 +28,9 @@ func WrapProcessor(f Processor, opts ...StartProcessSpanOption) Processor {
 			span.End()
 		}()
 
+		if msg, err = resolvePayload(ctx, msg, opts); err != nil {
+			return err
+		}
 		return f(ctx, msg)
 	}
 }
@@ -35,6 +40,7 @@ type Yielder[V any] func(context.Context, *Message) (V, error)
 
 // WrapYielder wraps a [Yielder] to automatically start and end a span for each message processing.
 // Errors returned from the wrapped function are recorded on the span.
+// See [WithPayloadResolver] to pass the message with the body offloaded to S3 resolved.
 func WrapYielder[V any](f Yielder[V], opts ...StartProcessSpanOption) Yielder[V] {
 	return func(ctx context.Context, msg *Message) (_ V, err error) {
 		ctx, span := StartProcessSpan(ctx, msg, opts...)
@@ -46,29 +52,38 @@ func WrapYielder[V any](f Yielder[V], opts ...StartProcessSpanOption) Yielder[V]
 			span.End()
 		}()
 
+		if msg, err = resolvePayload(ctx, msg, opts); err != nil {
+			var zero V
+			return zero, err
+		}
 		return f(ctx, msg)
 	}
 }
 
 // StartProcessSpan starts a new span for processing an SQS message.
 // If the message contains trace context in its message attributes, the span is linked to the original trace.
+// If not, the span is linked to the trace context in the envelope the pub package injected into the message body, if any.
+// See [WithTraceContextSources] to also look at the AWSTraceHeader message system attribute.
+// If a relay republished the message keeping the originator's trace context, the span is also linked to the originator.
+// Baggage extracted from the message attributes or the envelope is put into the returned context.
 // The caller is responsible for calling End on the returned span.
 func StartProcessSpan(ctx context.Context, msg *Message, opts ...StartProcessSpanOption) (context.Context, trace.Span) {
-	var cfg config
-	for _, o := range opts {
-		o.applyStartProcessSpanOption(&cfg)
-	}
-	if cfg.tracerProvider == nil {
-		cfg.tracerProvider = otel.GetTracerProvider()
-	}
+	cfg := newConfig(opts)
 	if msg != nil {
-		remoteCtx := internal.Propagator.Extract(ctx, msg.MessageAttributes)
-		link := trace.LinkFromContext(remoteCtx)
-		if link.SpanContext.IsValid() {
-			cfg.startSpanOptions = append(cfg.startSpanOptions, trace.WithLinks(link))
+		// Extract into an empty context so that the active span of ctx is not taken as the producer's.
+		remoteCtx := cfg.propagator.Extract(context.Background(), msg.MessageAttributes)
+		remoteCtx, sc := remoteSpanContext(cfg.traceContextSources, cfg.propagator, remoteCtx, msg)
+		if sc.IsValid() {
+			cfg.startSpanOptions = append(cfg.startSpanOptions, trace.WithLinks(trace.Link{SpanContext: sc}))
+		}
+		if originSC := trace.SpanContextFromContext(cfg.propagator.Extract(context.Background(), msg.MessageAttributes.originAttributes())); originSC.IsValid() && !originSC.Equal(sc) {
+			cfg.startSpanOptions = append(cfg.startSpanOptions, trace.WithLinks(trace.Link{SpanContext: originSC}))
+		}
+		if bag := baggage.FromContext(remoteCtx); bag.Len() > 0 {
+			ctx = baggage.ContextWithBaggage(ctx, bag)
 		}
 	}
-	ctx, span := cfg.tracerProvider.Tracer("github.com/aereal/otelpubsub/amazonsqs/sub").Start(ctx, "process", cfg.startSpanOptions...)
+	ctx, span := cfg.tracerProvider.Tracer(tracerName).Start(ctx, "process", cfg.startSpanOptions...)
 	if msg != nil {
 		var attrs []attribute.KeyValue
 		for _, producer := range cfg.attributeProducers {
@@ -2,6 +2,7 @@ package sub_test
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"iter"
 	"testing"
@@ -10,6 +11,8 @@ import (
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/sdk/instrumentation"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
@@ -60,7 +63,7 @@ func testWrapper(t *testing.T, wrap func(o ...sub.StartProcessSpanOption) func(c
 			"traceparent": sub.StringAttributeValue(fmt.Sprintf("00-%s-%s-01", wantTraceIDHex, wantSpanIDHex)),
 		},
 	}
-	if err := wrap(sub.WithTracerProvider(tp), sub.WithStartSpanOptions(trace.WithSpanKind(trace.SpanKindClient)))(t.Context(), entity); err != nil {
+	if err := wrap(sub.WithTracerProvider(tp), sub.WithPropagator(propagation.TraceContext{}), sub.WithStartSpanOptions(trace.WithSpanKind(trace.SpanKindClient)))(t.Context(), entity); err != nil {
 		t.Fatal(err)
 	}
 	if err := tp.ForceFlush(t.Context()); err != nil {
@@ -148,6 +151,264 @@ func TestStartProcessSpan_WithAttributeProducers(t *testing.T) {
 	}
 }
 
+func TestStartProcessSpan_WithPropagator(t *testing.T) {
+	t.Parallel()
+
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(tracetest.NewInMemoryExporter()))
+	msg := &sub.Message{
+		MessageAttributes: sub.MessageAttributes{
+			"traceparent": sub.StringAttributeValue("00-abcdef121234567890abcdef12345678-1234567890abcdef-01"),
+			"baggage":     sub.StringAttributeValue("tenant=t-1"),
+		},
+	}
+	propagator := propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+	ctx, span := sub.StartProcessSpan(t.Context(), msg, sub.WithTracerProvider(tp), sub.WithPropagator(propagator))
+	span.End()
+
+	if got := baggage.FromContext(ctx).Member("tenant").Value(); got != "t-1" {
+		t.Errorf("baggage member: want=%q got=%q", "t-1", got)
+	}
+	if got := trace.SpanContextFromContext(ctx).TraceID().String(); got == "abcdef121234567890abcdef12345678" {
+		t.Errorf("the process span must not be a child of the remote span: trace ID=%s", got)
+	}
+}
+
+func TestStartProcessSpan_WithTraceContextSources(t *testing.T) {
+	t.Parallel()
+
+	const (
+		w3cTraceID  = "abcdef121234567890abcdef12345678"
+		xrayTraceID = "5759e988bd862e3fe1be46a994272793"
+		bodyTraceID = "0123456789abcdef0123456789abcdef"
+	)
+	traceparent := sub.StringAttributeValue("00-" + w3cTraceID + "-1234567890abcdef-01")
+	traceHeader := "Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1"
+	envelopedBody := mustMarshalJSON(t, `{"otelpubsub.envelope":1,"otelpubsub.body":"hello","otelpubsub.propagation":{"traceparent":"00-`+bodyTraceID+`-1234567890abcdef-01"}}`)
+	testCases := []struct {
+		name        string
+		msg         *sub.Message
+		opts        []sub.StartProcessSpanOption
+		wantTraceID string
+	}{
+		{
+			name: "default ignores AWSTraceHeader",
+			msg: &sub.Message{
+				Attributes: map[string]string{sub.AttributeNameAWSTraceHeader: traceHeader},
+			},
+			wantTraceID: "",
+		},
+		{
+			name: "message attributes take precedence",
+			msg: &sub.Message{
+				Attributes:        map[string]string{sub.AttributeNameAWSTraceHeader: traceHeader},
+				MessageAttributes: sub.MessageAttributes{"traceparent": traceparent},
+			},
+			opts:        []sub.StartProcessSpanOption{sub.WithTraceContextSources(sub.TraceContextSourceMessageAttributes, sub.TraceContextSourceAWSTraceHeader)},
+			wantTraceID: w3cTraceID,
+		},
+		{
+			name: "fallback to AWSTraceHeader",
+			msg: &sub.Message{
+				Attributes: map[string]string{sub.AttributeNameAWSTraceHeader: traceHeader},
+			},
+			opts:        []sub.StartProcessSpanOption{sub.WithTraceContextSources(sub.TraceContextSourceMessageAttributes, sub.TraceContextSourceAWSTraceHeader)},
+			wantTraceID: xrayTraceID,
+		},
+		{
+			name: "AWSTraceHeader takes precedence",
+			msg: &sub.Message{
+				Attributes:        map[string]string{sub.AttributeNameAWSTraceHeader: traceHeader},
+				MessageAttributes: sub.MessageAttributes{"traceparent": traceparent},
+			},
+			opts:        []sub.StartProcessSpanOption{sub.WithTraceContextSources(sub.TraceContextSourceAWSTraceHeader, sub.TraceContextSourceMessageAttributes)},
+			wantTraceID: xrayTraceID,
+		},
+		{
+			name: "malformed AWSTraceHeader",
+			msg: &sub.Message{
+				Attributes: map[string]string{sub.AttributeNameAWSTraceHeader: "Root=broken"},
+			},
+			opts:        []sub.StartProcessSpanOption{sub.WithTraceContextSources(sub.TraceContextSourceAWSTraceHeader)},
+			wantTraceID: "",
+		},
+		{
+			name:        "default falls back to body envelope",
+			msg:         &sub.Message{Body: envelopedBody},
+			wantTraceID: bodyTraceID,
+		},
+		{
+			name: "message attributes take precedence over body envelope",
+			msg: &sub.Message{
+				MessageAttributes: sub.MessageAttributes{"traceparent": traceparent},
+				Body:              envelopedBody,
+			},
+			wantTraceID: w3cTraceID,
+		},
+		{
+			name:        "body envelope not in sources",
+			msg:         &sub.Message{Body: envelopedBody},
+			opts:        []sub.StartProcessSpanOption{sub.WithTraceContextSources(sub.TraceContextSourceMessageAttributes)},
+			wantTraceID: "",
+		},
+		{
+			name:        "body without envelope",
+			msg:         &sub.Message{Body: mustMarshalJSON(t, `{"otelpubsub.envelope":1,"otelpubsub.propagation":"broken"}`)},
+			wantTraceID: "",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			exporter := tracetest.NewInMemoryExporter()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+			opts := append([]sub.StartProcessSpanOption{sub.WithTracerProvider(tp), sub.WithPropagator(propagation.TraceContext{})}, tc.opts...)
+			_, span := sub.StartProcessSpan(t.Context(), tc.msg, opts...)
+			span.End()
+
+			gotSpans := exporter.GetSpans()
+			if len(gotSpans) != 1 {
+				t.Fatalf("got %d spans, want 1", len(gotSpans))
+			}
+			var gotTraceIDs []string
+			for _, link := range gotSpans[0].Links {
+				gotTraceIDs = append(gotTraceIDs, link.SpanContext.TraceID().String())
+			}
+			var wantTraceIDs []string
+			if tc.wantTraceID != "" {
+				wantTraceIDs = []string{tc.wantTraceID}
+			}
+			if diff := cmp.Diff(wantTraceIDs, gotTraceIDs); diff != "" {
+				t.Errorf("linked trace IDs (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestStartProcessSpan_activeParentSpan(t *testing.T) {
+	t.Parallel()
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	ctx, parent := tp.Tracer("test").Start(t.Context(), "handler")
+	defer parent.End()
+	msg := &sub.Message{
+		Attributes: map[string]string{sub.AttributeNameAWSTraceHeader: "Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1"},
+	}
+	_, span := sub.StartProcessSpan(ctx, msg,
+		sub.WithTracerProvider(tp),
+		sub.WithPropagator(propagation.TraceContext{}),
+		sub.WithTraceContextSources(sub.TraceContextSourceMessageAttributes, sub.TraceContextSourceAWSTraceHeader))
+	span.End()
+
+	gotSpans := exporter.GetSpans()
+	if len(gotSpans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(gotSpans))
+	}
+	got := gotSpans[0]
+	if got.Parent.SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("parent: got %s, want %s", got.Parent.SpanID(), parent.SpanContext().SpanID())
+	}
+	var gotLinks []string
+	for _, link := range got.Links {
+		gotLinks = append(gotLinks, link.SpanContext.TraceID().String()+"/"+link.SpanContext.SpanID().String())
+	}
+	if diff := cmp.Diff([]string{"5759e988bd862e3fe1be46a994272793/53995c3f42cd8ad8"}, gotLinks); diff != "" {
+		t.Errorf("links (-want, +got):\n%s", diff)
+	}
+}
+
+func TestStartProcessSpan_originLink(t *testing.T) {
+	t.Parallel()
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	msg := &sub.Message{
+		MessageAttributes: sub.MessageAttributes{
+			"traceparent":             sub.StringAttributeValue("00-0123456789abcdef0123456789abcdef-fedcba0987654321-01"),
+			"otel.origin.traceparent": sub.StringAttributeValue("00-abcdef121234567890abcdef12345678-1234567890abcdef-01"),
+		},
+	}
+	_, span := sub.StartProcessSpan(t.Context(), msg, sub.WithTracerProvider(tp), sub.WithPropagator(propagation.TraceContext{}))
+	span.End()
+
+	gotSpans := exporter.GetSpans()
+	if len(gotSpans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(gotSpans))
+	}
+	var gotTraceIDs []string
+	for _, link := range gotSpans[0].Links {
+		gotTraceIDs = append(gotTraceIDs, link.SpanContext.TraceID().String())
+	}
+	wantTraceIDs := []string{"0123456789abcdef0123456789abcdef", "abcdef121234567890abcdef12345678"}
+	if diff := cmp.Diff(wantTraceIDs, gotTraceIDs); diff != "" {
+		t.Errorf("linked trace IDs (-want, +got):\n%s", diff)
+	}
+}
+
+func mustMarshalJSON(t *testing.T, v any) json.RawMessage {
+	t.Helper()
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
 func processorFunc(ctx context.Context, entity *sub.Message) error { return nil }
 
 func yielderFunc(ctx context.Context, entity *sub.Message) (bool, error) { return true, nil }
+
+func TestStartProcessSpan_lambdaEvent(t *testing.T) {
+	t.Parallel()
+
+	f, err := testdata.Open("testdata/event_traceparent.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = f.Close() })
+	var ev sub.Event
+	if err := json.NewDecoder(f).Decode(&ev); err != nil {
+		t.Fatal(err)
+	}
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	_, span := sub.StartProcessSpan(t.Context(), &ev.Records[0], sub.WithTracerProvider(tp), sub.WithPropagator(propagation.TraceContext{}))
+	span.End()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(spans))
+	}
+	if len(spans[0].Links) != 1 {
+		t.Fatalf("got %d links, want 1", len(spans[0].Links))
+	}
+	if got := spans[0].Links[0].SpanContext; got.TraceID().String() != "abcdef121234567890abcdef12345678" || got.SpanID().String() != "1234567890abcdef" {
+		t.Errorf("link: got %s/%s", got.TraceID(), got.SpanID())
+	}
+}
+
+func TestStartProcessSpan_defaultPropagator(t *testing.T) {
+	t.Parallel()
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	msg := &sub.Message{
+		MessageAttributes: sub.MessageAttributes{
+			"traceparent": sub.StringAttributeValue("00-abcdef121234567890abcdef12345678-1234567890abcdef-01"),
+			"baggage":     sub.StringAttributeValue("tenant=t-1"),
+		},
+	}
+	// no global propagator is set in the tests
+	ctx, span := sub.StartProcessSpan(t.Context(), msg, sub.WithTracerProvider(tp))
+	span.End()
+
+	if got := baggage.FromContext(ctx).Member("tenant").Value(); got != "t-1" {
+		t.Errorf("baggage member: want=%q got=%q", "t-1", got)
+	}
+	links := exporter.GetSpans()[0].Links
+	if len(links) != 1 || links[0].SpanContext.TraceID().String() != "abcdef121234567890abcdef12345678" {
+		t.Errorf("links: %#v", links)
+	}
+}